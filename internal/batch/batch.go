@@ -0,0 +1,305 @@
+// Package batch implements the binary framing used by the /batch/* endpoints.
+//
+// A message is a version byte and an item count followed by the items.
+// All integers are big-endian. Each item is encoded as:
+//
+//	key      uint16 length + bytes
+//	status   uint16 (HTTP status code; 0 in requests)
+//	flags    uint8  (FlagSuperhot, FlagOriginFailed, FlagNegative, FlagStale)
+//	ttl      int64  milliseconds
+//	size     int64  bytes (-1 if unknown)
+//	token    uint8 length + bytes
+//	value    uint32 length + bytes
+//
+// Requests and responses share the format; fields that don't apply to a
+// given endpoint are left zero.
+package batch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/satmihir/justcache/internal/constants"
+)
+
+const (
+	// ContentType is the media type of batch request and response bodies
+	ContentType = "application/x-jc-batch"
+
+	// Version is the framing version written by Encode
+	Version = 1
+
+	// MaxItems is the maximum number of items in a single message
+	MaxItems = 1024
+
+	// MaxValueBytes is the maximum total size of the values in a message
+	MaxValueBytes = constants.MaxValueSizeBytes
+
+	// MaxMessageBytes is the maximum encoded size of a message: MaxValueBytes
+	// of values plus the framing for MaxItems maximum-size keys
+	MaxMessageBytes = headerSize + MaxValueBytes + MaxItems*(constants.MaxKeySizeBytes+itemOverhead)
+
+	// headerSize is the encoded size of the version and item count
+	headerSize = 1 + 4
+
+	// itemOverhead is the encoded size of an item's fixed-width fields and
+	// its largest token
+	itemOverhead = 2 + 2 + 1 + 8 + 8 + 1 + 255 + 4
+)
+
+// Item flags
+const (
+	FlagSuperhot uint8 = 1 << iota
+	FlagOriginFailed
+	FlagNegative
+	FlagStale
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported batch version")
+	ErrTooManyItems       = errors.New("too many items in batch")
+	ErrTooLarge           = errors.New("batch values exceed size limit")
+	ErrMalformed          = errors.New("malformed batch message")
+)
+
+// Item is a single key in a batch request or response
+type Item struct {
+	Key string
+	// Status is the per-key HTTP status code in responses
+	Status int
+	// Superhot is the server's superhot hint for the key
+	Superhot bool
+	// OriginFailed means a promise holder reported an origin failure for the
+	// key (on 404/409); TTL is then how long it lasts
+	OriginFailed bool
+	// Negative marks a negative entry (the origin has no value for the key), on
+	// put and on a hit; Value is then empty
+	Negative bool
+	// Stale marks a hit served from the entry's stale grace window after it
+	// expired; TTL is then 0
+	Stale bool
+	// TTL is the value TTL on put, the remaining TTL of a hit, the promise TTL
+	// on 202/409, or the remaining origin failure TTL
+	TTL time.Duration
+	// Size is the value size (-1 if unknown): the expected size on post, the
+	// stored size on a hit
+	Size int64
+	// Token is the promise token granted on 202 and presented on put
+	Token string
+	// Value is the value bytes on put and on a get hit
+	Value []byte
+}
+
+// Encode writes the items to w as a single batch message
+func Encode(w io.Writer, items []Item) error {
+	if len(items) > MaxItems {
+		return ErrTooManyItems
+	}
+	valueBytes := 0
+	for _, item := range items {
+		valueBytes += len(item.Value)
+	}
+	if valueBytes > MaxValueBytes {
+		return ErrTooLarge
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteByte(Version)
+	writeUint32(bw, uint32(len(items)))
+
+	for _, item := range items {
+		if len(item.Key) > constants.MaxKeySizeBytes || len(item.Token) > 255 ||
+			len(item.Value) > constants.MaxValueSizeBytes {
+			return fmt.Errorf("%w: item %q exceeds field limits", ErrMalformed, item.Key)
+		}
+
+		var flags uint8
+		if item.Superhot {
+			flags |= FlagSuperhot
+		}
+		if item.OriginFailed {
+			flags |= FlagOriginFailed
+		}
+		if item.Negative {
+			flags |= FlagNegative
+		}
+		if item.Stale {
+			flags |= FlagStale
+		}
+
+		writeUint16(bw, uint16(len(item.Key)))
+		bw.WriteString(item.Key)
+		writeUint16(bw, uint16(item.Status))
+		bw.WriteByte(flags)
+		writeUint64(bw, uint64(item.TTL.Milliseconds()))
+		writeUint64(bw, uint64(item.Size))
+		bw.WriteByte(uint8(len(item.Token)))
+		bw.WriteString(item.Token)
+		writeUint32(bw, uint32(len(item.Value)))
+		bw.Write(item.Value)
+	}
+
+	return bw.Flush()
+}
+
+// Decode reads a single batch message from r.
+// Field lengths and the total size of the values are validated against the
+// protocol limits before allocating, so a message from an untrusted peer
+// can't make Decode allocate much more than MaxMessageBytes.
+func Decode(r io.Reader) ([]Item, error) {
+	br := bufio.NewReader(r)
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	count, err := readUint32(br)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if count > MaxItems {
+		return nil, ErrTooManyItems
+	}
+
+	items := make([]Item, count)
+	valueBytes := uint32(MaxValueBytes)
+	for i := range items {
+		if err := decodeItem(br, &items[i], &valueBytes); err != nil {
+			if errors.Is(err, ErrTooLarge) {
+				return nil, err
+			}
+			return nil, malformed(err)
+		}
+	}
+	return items, nil
+}
+
+// decodeItem reads one item, taking its value from the remaining valueBytes
+func decodeItem(br *bufio.Reader, item *Item, valueBytes *uint32) error {
+	keyLen, err := readUint16(br)
+	if err != nil {
+		return err
+	}
+	if int(keyLen) > constants.MaxKeySizeBytes {
+		return fmt.Errorf("key length %d exceeds limit", keyLen)
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(br, key); err != nil {
+		return err
+	}
+	item.Key = string(key)
+
+	status, err := readUint16(br)
+	if err != nil {
+		return err
+	}
+	item.Status = int(status)
+
+	flags, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	item.Superhot = flags&FlagSuperhot != 0
+	item.OriginFailed = flags&FlagOriginFailed != 0
+	item.Negative = flags&FlagNegative != 0
+	item.Stale = flags&FlagStale != 0
+
+	ttlMs, err := readUint64(br)
+	if err != nil {
+		return err
+	}
+	item.TTL = time.Duration(int64(ttlMs)) * time.Millisecond
+
+	size, err := readUint64(br)
+	if err != nil {
+		return err
+	}
+	item.Size = int64(size)
+
+	tokenLen, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	token := make([]byte, tokenLen)
+	if _, err := io.ReadFull(br, token); err != nil {
+		return err
+	}
+	item.Token = string(token)
+
+	valueLen, err := readUint32(br)
+	if err != nil {
+		return err
+	}
+	if valueLen > constants.MaxValueSizeBytes {
+		return fmt.Errorf("value length %d exceeds limit", valueLen)
+	}
+	if valueLen > *valueBytes {
+		return ErrTooLarge
+	}
+	*valueBytes -= valueLen
+	if valueLen > 0 {
+		item.Value = make([]byte, valueLen)
+		if _, err := io.ReadFull(br, item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// malformed wraps a decoding error, reporting a short read as truncation
+func malformed(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrMalformed, err)
+}
+
+func writeUint16(w *bufio.Writer, v uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	w.Write(buf[:])
+}
+
+func writeUint32(w *bufio.Writer, v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	w.Write(buf[:])
+}
+
+func writeUint64(w *bufio.Writer, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	w.Write(buf[:])
+}
+
+func readUint16(r io.Reader) (uint16, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(buf[:]), nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
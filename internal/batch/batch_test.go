@@ -0,0 +1,110 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/constants"
+)
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	items := []Item{
+		{Key: "a", Size: -1},
+		{Key: "b", Status: 200, Superhot: true, TTL: 1500 * time.Millisecond, Size: 5, Value: []byte("hello")},
+		{Key: "c", Status: 202, TTL: 30 * time.Second, Size: -1, Token: "0123456789abcdef"},
+		{Key: "d", Status: 409, OriginFailed: true, TTL: 5 * time.Second, Size: -1},
+		{Key: "e", Status: 200, Negative: true, TTL: time.Minute, Size: 0},
+		{Key: "f", Status: 200, Stale: true, Size: 3, Value: []byte("old")},
+		{Key: strings.Repeat("k", constants.MaxKeySizeBytes), Status: 404},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, items); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("Decode() = %+v, want %+v", got, items)
+	}
+}
+
+func TestEncodeDecode_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, nil); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Decode() returned %d items, want 0", len(got))
+	}
+}
+
+func TestEncode_Limits(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, make([]Item, MaxItems+1)); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("Encode() with too many items error = %v, want ErrTooManyItems", err)
+	}
+
+	tooLong := []Item{{Key: strings.Repeat("k", constants.MaxKeySizeBytes+1)}}
+	if err := Encode(&bytes.Buffer{}, tooLong); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Encode() with long key error = %v, want ErrMalformed", err)
+	}
+
+	value := make([]byte, MaxValueBytes/2+1)
+	tooLarge := []Item{{Key: "a", Value: value}, {Key: "b", Value: value}}
+	if err := Encode(&bytes.Buffer{}, tooLarge); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Encode() with large values error = %v, want ErrTooLarge", err)
+	}
+}
+
+// valuesTooLarge encodes a one-byte value followed by the header of a
+// MaxValueBytes value, which together exceed the limit
+func valuesTooLarge() []byte {
+	data := []byte{Version, 0, 0, 0, 2}
+	data = append(data, 0, 1, 'a')
+	data = append(data, make([]byte, 2+1+8+8+1)...) // status, flags, ttl, size, token
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = append(data, 'v')
+	data = append(data, 0, 1, 'b')
+	data = append(data, make([]byte, 2+1+8+8+1)...)
+	return binary.BigEndian.AppendUint32(data, MaxValueBytes)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	var valid bytes.Buffer
+	Encode(&valid, []Item{{Key: "key", Value: []byte("value")}})
+	encoded := valid.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrMalformed},
+		{"wrong version", append([]byte{Version + 1}, encoded[1:]...), ErrUnsupportedVersion},
+		{"truncated header", encoded[:3], ErrMalformed},
+		{"truncated item", encoded[:len(encoded)-2], ErrMalformed},
+		{"too many items", []byte{Version, 0xff, 0xff, 0xff, 0xff}, ErrTooManyItems},
+		{"key too long", []byte{Version, 0, 0, 0, 1, 0xff, 0xff}, ErrMalformed},
+		{"values too large", valuesTooLarge(), ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(bytes.NewReader(tt.data)); !errors.Is(err, tt.want) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
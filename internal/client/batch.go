@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/satmihir/justcache/internal/batch"
+)
+
+// GetMulti retrieves several keys with batched requests.
+// Returns the entries of the keys that were found; misses are omitted.
+// Keys held by the near cache aren't requested, and values that don't fit in
+// a batch response are read with Get.
+func (c *Client) GetMulti(ctx context.Context, keys []string) (map[string]*Entry, error) {
+	entries := make(map[string]*Entry, len(keys))
+	items := make([]batch.Item, 0, len(keys))
+	for _, key := range keys {
+		if entry := c.near.get(key); entry != nil {
+			entries[key] = entry
+			continue
+		}
+		items = append(items, batch.Item{Key: key, Size: -1})
+	}
+	if len(items) == 0 {
+		return entries, nil
+	}
+
+	results, err := c.doBatch(ctx, "get", items)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case http.StatusOK:
+			entry := itemEntry(result)
+			c.near.add(result.Key, entry)
+			entries[result.Key] = entry
+		case http.StatusRequestEntityTooLarge:
+			entry, err := c.Get(ctx, result.Key)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entries[result.Key] = entry
+		}
+	}
+	return entries, nil
+}
+
+// SetMulti stores several values with the same TTL using batched requests.
+// This handles the full POST+PUT flow: promises for all keys are requested in
+// one batch, and the values are uploaded for the keys that were granted one.
+// Keys that already exist count as stored.
+//
+// Returns the errors of the keys that weren't stored (ErrConflict,
+// ErrInsufficientStorage, ...); the map is empty if every key was stored.
+// The error is non-nil if a batch request failed as a whole.
+func (c *Client) SetMulti(ctx context.Context, values map[string][]byte, ttl time.Duration) (map[string]error, error) {
+	promises := make([]batch.Item, 0, len(values))
+	for key, value := range values {
+		c.near.remove(key)
+		promises = append(promises, batch.Item{Key: key, Size: int64(len(value))})
+	}
+
+	results, err := c.doBatch(ctx, "post", promises)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]error)
+	var uploads []batch.Item
+	for _, result := range results {
+		switch result.Status {
+		case http.StatusOK:
+			// Key already exists - treat as success (idempotent)
+		case http.StatusAccepted:
+			uploads = append(uploads, batch.Item{
+				Key:   result.Key,
+				TTL:   ttl,
+				Size:  -1,
+				Token: result.Token,
+				Value: values[result.Key],
+			})
+		case http.StatusConflict:
+			failed[result.Key] = ErrConflict
+		case http.StatusInsufficientStorage:
+			failed[result.Key] = ErrInsufficientStorage
+		default:
+			failed[result.Key] = statusError(result.Status)
+		}
+	}
+	if len(uploads) == 0 {
+		return failed, nil
+	}
+
+	results, err = c.doBatch(ctx, "put", uploads)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		switch result.Status {
+		case http.StatusOK:
+		case http.StatusConflict:
+			failed[result.Key] = ErrNoPromise
+		case http.StatusRequestEntityTooLarge:
+			failed[result.Key] = ErrPayloadTooLarge
+		case http.StatusInsufficientStorage:
+			failed[result.Key] = ErrInsufficientStorage
+		default:
+			failed[result.Key] = statusError(result.Status)
+		}
+	}
+	return failed, nil
+}
+
+// doBatch sends the items to POST /batch/{op}, split into as many requests as
+// the message limits require, and returns the result items in order
+func (c *Client) doBatch(ctx context.Context, op string, items []batch.Item) ([]batch.Item, error) {
+	results := make([]batch.Item, 0, len(items))
+	for start := 0; start < len(items); {
+		end, valueBytes := start, 0
+		for end < len(items) && end-start < batch.MaxItems &&
+			(end == start || valueBytes+len(items[end].Value) <= batch.MaxValueBytes) {
+			valueBytes += len(items[end].Value)
+			end++
+		}
+
+		chunk, err := c.sendBatch(ctx, op, items[start:end])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, chunk...)
+		start = end
+	}
+	return results, nil
+}
+
+// sendBatch sends a single batch request
+func (c *Client) sendBatch(ctx context.Context, op string, items []batch.Item) ([]batch.Item, error) {
+	var body bytes.Buffer
+	if err := batch.Encode(&body, items); err != nil {
+		return nil, fmt.Errorf("encoding batch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/batch/"+op, &body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", batch.ContentType)
+
+	resp, err := c.do("batch_"+op, req)
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, ErrBadRequest
+	case http.StatusRequestEntityTooLarge:
+		return nil, ErrPayloadTooLarge
+	default:
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	results, err := batch.Decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding batch: %w", err)
+	}
+	if len(results) != len(items) {
+		return nil, fmt.Errorf("batch returned %d results for %d items", len(results), len(items))
+	}
+	return results, nil
+}
+
+// itemEntry converts a batch hit to an Entry
+func itemEntry(item batch.Item) *Entry {
+	size := int(item.Size)
+	if item.Size < 0 {
+		size = len(item.Value)
+	}
+	return &Entry{
+		Value:        item.Value,
+		Size:         size,
+		RemainingTTL: item.TTL,
+		Superhot:     item.Superhot,
+		Negative:     item.Negative,
+		Stale:        item.Stale,
+	}
+}
+
+// statusError maps an unexpected per-key batch status to an error
+func statusError(status int) error {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	return fmt.Errorf("unexpected status: %d", status)
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/batch"
+	"github.com/satmihir/justcache/internal/remote"
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+func TestClient_SetMultiAndGetMulti(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	values := map[string][]byte{
+		"a": []byte("alpha"),
+		"b": []byte("beta"),
+		"c": []byte("gamma"),
+	}
+	failed, err := client.SetMulti(ctx, values, time.Hour)
+	if err != nil {
+		t.Fatalf("SetMulti error = %v", err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("SetMulti failed keys = %v, want none", failed)
+	}
+
+	entries, err := client.GetMulti(ctx, []string{"a", "b", "c", "missing"})
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("GetMulti returned %d entries, want 3", len(entries))
+	}
+	for key, value := range values {
+		entry, ok := entries[key]
+		if !ok {
+			t.Errorf("GetMulti missing %q", key)
+			continue
+		}
+		if string(entry.Value) != string(value) {
+			t.Errorf("GetMulti[%q] = %q, want %q", key, entry.Value, value)
+		}
+		if entry.RemainingTTL <= 0 {
+			t.Errorf("GetMulti[%q] RemainingTTL = %v, want positive", key, entry.RemainingTTL)
+		}
+	}
+}
+
+func TestClient_SetMultiReportsPerKeyFailures(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "exists", []byte("original"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+	other := New(ts.URL)
+	other.Post(ctx, "held", 0, time.Minute, false)
+
+	failed, err := client.SetMulti(ctx, map[string][]byte{
+		"exists": []byte("new"),
+		"held":   []byte("new"),
+		"fresh":  []byte("new"),
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("SetMulti error = %v", err)
+	}
+	if len(failed) != 1 || !errors.Is(failed["held"], ErrConflict) {
+		t.Errorf("SetMulti failed = %v, want only held: ErrConflict", failed)
+	}
+
+	entry, _ := client.Get(ctx, "exists")
+	if string(entry.Value) != "original" {
+		t.Errorf("existing value = %q, want it untouched", entry.Value)
+	}
+}
+
+func TestClient_GetMultiSplitsLargeBatches(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	if err := client.Set(ctx, keys[2499], []byte("last"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	entries, err := client.GetMulti(ctx, keys)
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	if len(entries) != 1 || string(entries[keys[2499]].Value) != "last" {
+		t.Errorf("GetMulti = %v, want only the last key", entries)
+	}
+}
+
+func TestClient_GetMultiReadsValuesOverTheResponseLimit(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(3*batch.MaxValueBytes))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL)
+	ctx := context.Background()
+
+	// Both values don't fit in one batch response
+	value := make([]byte, batch.MaxValueBytes/2+1)
+	for _, key := range []string{"a", "b"} {
+		if err := client.Set(ctx, key, value, time.Hour); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	entries, err := client.GetMulti(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if entry, ok := entries[key]; !ok || len(entry.Value) != len(value) {
+			t.Errorf("GetMulti missing the whole value of %q", key)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/satmihir/justcache/internal/retry"
@@ -17,12 +18,37 @@ import (
 
 // Header names used by the protocol
 const (
-	headerSize       = "x-jc-size"
-	headerTTL        = "x-jc-ttl"
-	headerSuperhot   = "x-jc-superhot"
-	headerPromiseTTL = "x-jc-promise-ttl"
-	headerDryRun     = "x-jc-dryrun"
-	headerRetryAfter = "Retry-After"
+	headerSize          = "x-jc-size"
+	headerTTL           = "x-jc-ttl"
+	headerSuperhot      = "x-jc-superhot"
+	headerPromiseTTL    = "x-jc-promise-ttl"
+	headerPromiseToken  = "x-jc-promise-token"
+	headerPromiseAction = "x-jc-promise-action"
+	headerFailureTTL    = "x-jc-failure-ttl"
+	headerNegative      = "x-jc-negative"
+	headerStale         = "x-jc-stale"
+	headerRefresh       = "x-jc-refresh"
+	headerDryRun        = "x-jc-dryrun"
+	headerWait          = "x-jc-wait"
+	headerRetryAfter    = "Retry-After"
+	headerRange         = "Range"
+)
+
+const (
+	// Server default promise TTL, assumed when a 202 doesn't say otherwise
+	defaultPromiseTTL = 30 * time.Second
+
+	// Default time to long-poll for another client's upload
+	defaultLongPollWait = 10 * time.Second
+
+	// Maximum number of stale entries a client refreshes in the background at once
+	maxBackgroundRefreshes = 16
+
+	// Time limit of a background refresh when the HTTP client has no timeout
+	defaultRefreshTimeout = time.Minute
+
+	// Interval at which expired promise tokens are pruned
+	tokenPruneInterval = time.Minute
 )
 
 // Errors returned by the client
@@ -35,6 +61,14 @@ var (
 	ErrPayloadTooLarge     = errors.New("payload exceeds maximum size")
 	ErrLengthRequired      = errors.New("content-length header required")
 	ErrBadRequest          = errors.New("bad request")
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+	ErrUnavailable         = errors.New("server unavailable: shutting down")
+	ErrOriginFailure       = errors.New("origin failure reported by the loading client")
+
+	// ErrOriginNotFound is returned by a Loader, possibly wrapped, when the
+	// origin has no value for the key. GetOrLoad then caches a negative entry
+	// with the TTL the loader returned.
+	ErrOriginNotFound = errors.New("key not found at origin")
 )
 
 // Entry represents a cached value with metadata
@@ -43,8 +77,23 @@ type Entry struct {
 	Size         int
 	RemainingTTL time.Duration
 	Superhot     bool
+	// Negative means the origin has no value for the key; Value is empty
+	Negative bool
+	// Stale means the entry expired and is served from the server's stale
+	// grace window until it's refreshed; RemainingTTL is 0
+	Stale bool
+
+	// refreshTTL is the TTL of the promise to refresh a stale entry, if this
+	// client was granted it
+	refreshTTL time.Duration
 }
 
+// Loader fetches a value from the origin.
+// It returns the value and the TTL to cache it with (0 for the server default).
+// If the origin has no value, it returns ErrOriginNotFound and the TTL to
+// cache that with.
+type Loader func(ctx context.Context) ([]byte, time.Duration, error)
+
 // PostResult represents the result of a POST (promise) request
 type PostResult struct {
 	// Status indicates the outcome
@@ -53,6 +102,12 @@ type PostResult struct {
 	PromiseTTL time.Duration
 	// RetryAfter is the suggested backoff (on Conflict)
 	RetryAfter time.Duration
+	// FailureTTL is how long an origin failure reported by the last promise
+	// holder keeps new promises from being granted (on Conflict). 0 if none.
+	FailureTTL time.Duration
+	// PromiseToken identifies this client as the promise holder (on Accepted).
+	// The client remembers it and presents it on the following Put automatically.
+	PromiseToken string
 	// Entry contains metadata if Status is Exists.
 	// NOTE: Entry.Value will be empty; use Get() to fetch the actual value.
 	Entry *Entry
@@ -75,9 +130,27 @@ const (
 
 // Client is a JustCache client for a single server
 type Client struct {
-	baseURL     string
-	httpClient  *http.Client
-	retryConfig retry.Config
+	baseURL      string
+	httpClient   *http.Client
+	retryConfig  retry.Config
+	longPollWait time.Duration
+	failureTTL   time.Duration
+	metrics      Metrics
+	near         *nearCache
+
+	// refreshes holds a slot for each background refresh in flight
+	refreshes chan struct{}
+
+	// Promise tokens granted by POST, presented on the following PUT
+	tokensMu     sync.Mutex
+	tokens       map[string]heldPromise
+	tokensPruned time.Time
+}
+
+// heldPromise is a promise granted to this client
+type heldPromise struct {
+	token     string
+	expiresAt time.Time
 }
 
 // Option configures the client
@@ -104,6 +177,33 @@ func WithRetryConfig(config retry.Config) Option {
 	}
 }
 
+// WithLongPollWait sets how long a GET may block on the server waiting for
+// another client's in-flight upload. 0 disables long-polling, in which case
+// conflicts are retried with client-side backoff. The wait is capped to half
+// the HTTP client timeout.
+func WithLongPollWait(d time.Duration) Option {
+	return func(client *Client) {
+		client.longPollWait = d
+	}
+}
+
+// WithFailureTTL sets how long an origin failure reported by GetOrLoad keeps
+// other clients from loading the key. 0 uses the server default.
+func WithFailureTTL(d time.Duration) Option {
+	return func(client *Client) {
+		client.failureTTL = d
+	}
+}
+
+// pollWait returns how long a GET long-polls, capped to half the HTTP client
+// timeout so the server answers before the request times out
+func (c *Client) pollWait() time.Duration {
+	if timeout := c.httpClient.Timeout; timeout > 0 && c.longPollWait > timeout/2 {
+		return timeout / 2
+	}
+	return c.longPollWait
+}
+
 // New creates a new Client for the given server address
 func New(serverAddr string, opts ...Option) *Client {
 	c := &Client{
@@ -111,7 +211,10 @@ func New(serverAddr string, opts ...Option) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		retryConfig: retry.DefaultConfig(),
+		retryConfig:  retry.DefaultConfig(),
+		longPollWait: defaultLongPollWait,
+		refreshes:    make(chan struct{}, maxBackgroundRefreshes),
+		tokens:       make(map[string]heldPromise),
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -120,29 +223,149 @@ func New(serverAddr string, opts ...Option) *Client {
 }
 
 // Get retrieves a value from the cache.
-// Returns ErrNotFound if the key doesn't exist.
+// Returns ErrNotFound if the key doesn't exist. If the last load of the key
+// failed at the origin, the error also matches ErrOriginFailure.
+// The returned Value may be shared with the near cache and other callers
+// (see WithNearCache), so it must not be modified.
 func (c *Client) Get(ctx context.Context, key string) (*Entry, error) {
+	return c.get(ctx, key, 0, false)
+}
+
+// GetStream retrieves a value from the cache as a stream, without buffering it.
+// The caller must close the returned reader. The Entry carries metadata only;
+// its Value is nil. Returns ErrNotFound if the key doesn't exist.
+func (c *Client) GetStream(ctx context.Context, key string) (io.ReadCloser, *Entry, error) {
+	req, err := c.newGetRequest(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.doGet(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, parseEntry(resp, nil), nil
+}
+
+// GetRange retrieves length bytes of a value starting at offset off.
+// A length <= 0 reads to the end of the value. The returned Entry's Value
+// holds only the requested bytes, while Size is the size of the whole value.
+// Returns ErrNotFound if the key doesn't exist and ErrRangeNotSatisfiable if
+// off is past the end of the value.
+func (c *Client) GetRange(ctx context.Context, key string, off, length int64) (*Entry, error) {
+	if off < 0 {
+		return nil, ErrBadRequest
+	}
+
+	req, err := c.newGetRequest(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set(headerRange, fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	} else {
+		req.Header.Set(headerRange, fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := c.doGet(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	value, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// A server that ignores Range sends the whole value; slice it here
+	if resp.StatusCode == http.StatusOK {
+		if off >= int64(len(value)) {
+			return nil, ErrRangeNotSatisfiable
+		}
+		end := int64(len(value))
+		if length > 0 {
+			end = min(off+length, end)
+		}
+		entry := parseEntry(resp, value[off:end])
+		entry.Size = len(value)
+		return entry, nil
+	}
+	return parseEntry(resp, value), nil
+}
+
+// get issues a GET, asking the server to wait up to the given duration for an
+// in-flight promise on a miss (0 to return immediately). With refresh, it
+// asks for the promise to refresh a stale entry, and holds it if granted.
+// The near cache, if any, is checked first and keeps admitted hits.
+func (c *Client) get(ctx context.Context, key string, wait time.Duration, refresh bool) (*Entry, error) {
+	if entry := c.near.get(key); entry != nil {
+		return entry, nil
+	}
+
+	req, err := c.newGetRequest(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		req.Header.Set(headerWait, strconv.FormatInt(wait.Milliseconds(), 10))
+	}
+	if refresh {
+		req.Header.Set(headerRefresh, "true")
+	}
+
+	resp, err := c.doGet(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	value, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	entry := parseEntry(resp, value)
+	if token := resp.Header.Get(headerPromiseToken); token != "" && entry.Stale {
+		entry.refreshTTL = parsePromiseTTL(resp)
+		if entry.refreshTTL <= 0 {
+			entry.refreshTTL = defaultPromiseTTL
+		}
+		c.holdPromise(key, token, entry.refreshTTL)
+	}
+	c.near.add(key, entry)
+	return entry, nil
+}
+
+// newGetRequest creates a GET request for the key
+func (c *Client) newGetRequest(ctx context.Context, key string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(key), nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	return req, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// doGet executes a GET and returns the response on a hit (200 or 206).
+// The caller must close the response body.
+func (c *Client) doGet(req *http.Request) (*http.Response, error) {
+	resp, err := c.do("get", req)
 	if err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	switch resp.StatusCode {
-	case http.StatusOK:
-		value, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("reading response body: %w", err)
-		}
-		return parseEntry(resp, value), nil
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
 	case http.StatusNotFound:
+		resp.Body.Close()
+		if failureTTL := parseFailureTTL(resp); failureTTL > 0 {
+			return nil, originFailure(failureTTL)
+		}
 		return nil, ErrNotFound
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, ErrRangeNotSatisfiable
 	default:
+		resp.Body.Close()
 		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 }
@@ -173,10 +396,63 @@ func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Dur
 	}
 }
 
+// SetNegative stores a negative entry: a record that the origin has no value
+// for the key, so readers don't query it again until ttl (0 for the server
+// default) runs out. Like Set, it succeeds if the key already exists.
+// Returns ErrConflict if another client is uploading the same key.
+func (c *Client) SetNegative(ctx context.Context, key string, ttl time.Duration) error {
+	result, err := c.Post(ctx, key, 0, 0, false)
+	if err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case PostAccepted:
+		return c.PutNegative(ctx, key, ttl)
+	case PostExists:
+		return nil
+	case PostConflict:
+		return ErrConflict
+	case PostInsufficientStorage:
+		return ErrInsufficientStorage
+	default:
+		return fmt.Errorf("unexpected POST status: %d", result.Status)
+	}
+}
+
+// SetStream stores a value read from r in the cache, without buffering it.
+// size must be the exact number of bytes r yields; it is announced in the POST
+// so the server can reject values that don't fit before any bytes are sent.
+// Returns ErrConflict if another client is uploading the same key.
+func (c *Client) SetStream(ctx context.Context, key string, r io.Reader, size int64, ttl time.Duration) error {
+	result, err := c.Post(ctx, key, size, 0, false)
+	if err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case PostAccepted:
+		return c.PutStream(ctx, key, r, size, ttl)
+	case PostExists:
+		// Key already exists - treat as success (idempotent)
+		return nil
+	case PostConflict:
+		return ErrConflict
+	case PostInsufficientStorage:
+		return ErrInsufficientStorage
+	default:
+		return fmt.Errorf("unexpected POST status: %d", result.Status)
+	}
+}
+
 // SetWithRetry stores a value with automatic retry on conflict.
-// It uses exponential backoff with jitter, respecting server-provided Retry-After hints.
+// On conflict it long-polls for the other client's upload and treats that value
+// landing as success. Otherwise it uses exponential backoff with jitter,
+// respecting server-provided Retry-After hints.
 func (c *Client) SetWithRetry(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	attempt := c.retryObserver("set")
 	_, err := retry.DoWithHint(ctx, c.retryConfig, func() (struct{}, error, bool, time.Duration) {
+		attempt()
 		result, err := c.Post(ctx, key, int64(len(value)), 0, false)
 		if err != nil {
 			// Network/transport errors are retryable
@@ -198,8 +474,16 @@ func (c *Client) SetWithRetry(ctx context.Context, key string, value []byte, ttl
 			return struct{}{}, nil, false, 0
 
 		case PostConflict:
-			// Another client has the promise - retry with server hint
-			return struct{}{}, ErrConflict, true, result.RetryAfter
+			if c.longPollWait <= 0 || result.FailureTTL > 0 {
+				// Another client has the promise, or its load just failed -
+				// retry with server hint
+				return struct{}{}, ErrConflict, true, result.RetryAfter
+			}
+			// Wait for the other client's upload; once it lands the key exists
+			if _, err := c.get(ctx, key, c.pollWait(), false); err == nil {
+				return struct{}{}, nil, false, 0
+			}
+			return struct{}{}, ErrConflict, true, 0
 
 		case PostInsufficientStorage:
 			// Terminal error - don't retry
@@ -213,9 +497,12 @@ func (c *Client) SetWithRetry(ctx context.Context, key string, value []byte, ttl
 }
 
 // GetWithRetry retrieves a value with automatic retry on transient errors.
+// If another client is uploading the key, it long-polls for the upload.
 func (c *Client) GetWithRetry(ctx context.Context, key string) (*Entry, error) {
+	attempt := c.retryObserver("get")
 	return retry.Do(ctx, c.retryConfig, func() (*Entry, error, bool) {
-		entry, err := c.Get(ctx, key)
+		attempt()
+		entry, err := c.get(ctx, key, c.pollWait(), false)
 		if err != nil {
 			// NotFound is not retryable
 			if errors.Is(err, ErrNotFound) {
@@ -228,6 +515,173 @@ func (c *Client) GetWithRetry(ctx context.Context, key string) (*Entry, error) {
 	})
 }
 
+// GetOrLoad retrieves a value, loading it from the origin on a miss.
+//
+// On a miss it POSTs for a promise. If the promise is granted, the loader is
+// called and its result uploaded (best-effort; the loaded value is returned
+// even if the upload fails). The promise is renewed while the loader runs, and
+// given up if the loader fails: reported as an origin failure (see
+// WithFailureTTL), or abandoned if ctx is done. A loader returning
+// ErrOriginNotFound caches a negative entry instead, which is returned.
+// If another client holds the promise, it long-polls for that upload, or waits
+// using the server's Retry-After/promise TTL hints when long-polling is
+// disabled, and retries. If that client reports an origin failure, it returns
+// an error matching ErrOriginFailure instead of loading the key itself.
+//
+// A stale entry is returned right away. If this client is the first to ask
+// to refresh it, the loader runs in the background (without ctx's
+// cancellation, but within the HTTP client timeout) and its result replaces
+// the stale entry.
+func (c *Client) GetOrLoad(ctx context.Context, key string, loader Loader) (*Entry, error) {
+	attempt := c.retryObserver("get_or_load")
+	return retry.DoWithHint(ctx, c.retryConfig, func() (*Entry, error, bool, time.Duration) {
+		attempt()
+		entry, err := c.get(ctx, key, 0, true)
+		if err == nil {
+			if entry.refreshTTL > 0 {
+				c.refreshInBackground(ctx, key, loader, entry.refreshTTL)
+			}
+			return entry, nil, false, 0
+		}
+		if errors.Is(err, ErrOriginFailure) {
+			return nil, err, false, 0
+		}
+		if !errors.Is(err, ErrNotFound) {
+			// Network/transport errors are retryable
+			return nil, err, true, 0
+		}
+
+		result, err := c.Post(ctx, key, 0, 0, false)
+		if err != nil {
+			return nil, err, true, 0
+		}
+
+		switch result.Status {
+		case PostAccepted:
+			// We hold the promise: fetch from origin and upload
+			entry, err := c.load(ctx, key, loader, result.PromiseTTL)
+			if err != nil {
+				return nil, err, false, 0
+			}
+			return entry, nil, false, 0
+
+		case PostExists:
+			// The key appeared during the race - fetch it
+			entry, err := c.Get(ctx, key)
+			if err != nil {
+				return nil, err, true, 0
+			}
+			return entry, nil, false, 0
+
+		case PostConflict:
+			if result.FailureTTL > 0 {
+				// The last load failed at the origin; don't add to its load
+				return nil, originFailure(result.FailureTTL), false, 0
+			}
+			// Another client is loading - wait for it and re-GET
+			if c.longPollWait <= 0 {
+				return nil, ErrConflict, true, conflictBackoff(result)
+			}
+			entry, err := c.get(ctx, key, c.pollWait(), false)
+			if err == nil {
+				return entry, nil, false, 0
+			}
+			if errors.Is(err, ErrOriginFailure) {
+				return nil, err, false, 0
+			}
+			return nil, ErrConflict, true, 0
+
+		case PostInsufficientStorage:
+			// The server can't hold the value; serve it straight from origin
+			value, ttl, err := loader(ctx)
+			if errors.Is(err, ErrOriginNotFound) {
+				return &Entry{RemainingTTL: ttl, Negative: true}, nil, false, 0
+			}
+			if err != nil {
+				return nil, err, false, 0
+			}
+			return &Entry{Value: value, Size: len(value), RemainingTTL: ttl}, nil, false, 0
+
+		default:
+			return nil, fmt.Errorf("unexpected POST status: %d", result.Status), false, 0
+		}
+	})
+}
+
+// refreshInBackground reloads a stale key whose refresh promise this client
+// holds, without waiting for it. The load ignores ctx's cancellation but is
+// bounded by the HTTP client timeout. If too many refreshes are running, the
+// promise is abandoned so another client can refresh the key.
+func (c *Client) refreshInBackground(ctx context.Context, key string, loader Loader, promiseTTL time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	select {
+	case c.refreshes <- struct{}{}:
+	default:
+		go c.AbandonPromise(ctx, key)
+		return
+	}
+
+	timeout := c.httpClient.Timeout
+	if timeout <= 0 {
+		timeout = defaultRefreshTimeout
+	}
+	go func() {
+		defer func() { <-c.refreshes }()
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		c.load(ctx, key, loader, promiseTTL)
+	}()
+}
+
+// load calls the loader for a key whose promise this client holds, keeping
+// the promise alive however long the origin takes, and uploads the result
+// (best-effort). A loader returning ErrOriginNotFound caches a negative entry,
+// which is returned. If the loader fails, the promise is given up so waiting
+// clients don't sit it out.
+func (c *Client) load(ctx context.Context, key string, loader Loader, promiseTTL time.Duration) (*Entry, error) {
+	stop := c.renewWhileLoading(ctx, key, promiseTTL)
+	value, ttl, err := loader(ctx)
+	stop()
+	if errors.Is(err, ErrOriginNotFound) {
+		c.PutNegative(ctx, key, ttl)
+		return &Entry{RemainingTTL: ttl, Negative: true}, nil
+	}
+	if err != nil {
+		c.giveUpPromise(ctx, key)
+		return nil, err
+	}
+	c.Put(ctx, key, value, ttl)
+	return &Entry{Value: value, Size: len(value), RemainingTTL: ttl}, nil
+}
+
+// Delete removes a key from the cache.
+// Returns ErrNotFound if the key doesn't exist.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	c.near.remove(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(key), nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := c.do("delete", req)
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	default:
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
 // PostOptions configures a POST request
 type PostOptions struct {
 	// Size is the expected value size (optional but recommended)
@@ -243,6 +697,7 @@ type PostOptions struct {
 //
 // If the key already exists (PostExists), Entry contains metadata but NOT the value.
 // Call Get() to retrieve the actual value.
+// Returns ErrUnavailable if the server is shutting down.
 func (c *Client) Post(ctx context.Context, key string, size int64, promiseTTL time.Duration, dryRun bool) (*PostResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(key), nil)
 	if err != nil {
@@ -259,7 +714,7 @@ func (c *Client) Post(ctx context.Context, key string, size int64, promiseTTL ti
 		req.Header.Set(headerDryRun, "true")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("post", req)
 	if err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
@@ -278,10 +733,18 @@ func (c *Client) Post(ctx context.Context, key string, size int64, promiseTTL ti
 		result.Entry = parseEntry(resp, value)
 	case http.StatusAccepted:
 		result.Status = PostAccepted
+		result.PromiseToken = resp.Header.Get(headerPromiseToken)
+		if result.PromiseToken != "" {
+			c.holdPromise(key, result.PromiseToken, result.PromiseTTL)
+		}
 	case http.StatusConflict:
 		result.Status = PostConflict
+		result.FailureTTL = parseFailureTTL(resp)
 	case http.StatusInsufficientStorage:
 		result.Status = PostInsufficientStorage
+	case http.StatusServiceUnavailable:
+		// The server is draining; other hosts (or a retry) may take the key
+		return nil, ErrUnavailable
 	default:
 		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
@@ -290,24 +753,60 @@ func (c *Client) Post(ctx context.Context, key string, size int64, promiseTTL ti
 }
 
 // Put uploads a value after a successful POST.
+// The promise token from that POST is sent automatically.
 // This is the low-level method; most callers should use Set.
 func (c *Client) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(key), bytes.NewReader(value))
+	return c.PutStream(ctx, key, bytes.NewReader(value), int64(len(value)), ttl)
+}
+
+// PutStream is like Put but streams size bytes from r.
+// This is the low-level method; most callers should use SetStream.
+func (c *Client) PutStream(ctx context.Context, key string, r io.Reader, size int64, ttl time.Duration) error {
+	return c.put(ctx, key, r, size, ttl, false)
+}
+
+// PutNegative stores a negative entry after a successful POST.
+// This is the low-level method; most callers should use SetNegative.
+func (c *Client) PutNegative(ctx context.Context, key string, ttl time.Duration) error {
+	return c.put(ctx, key, nil, 0, ttl, true)
+}
+
+// put uploads size bytes from r, or a negative entry, under the held promise
+func (c *Client) put(ctx context.Context, key string, r io.Reader, size int64, ttl time.Duration, negative bool) error {
+	c.near.remove(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(key), r)
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
 
-	req.ContentLength = int64(len(value))
+	// The server requires Content-Length, so never fall back to chunked encoding
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
 	if ttl > 0 {
 		req.Header.Set(headerTTL, strconv.FormatInt(ttl.Milliseconds(), 10))
 	}
+	if negative {
+		req.Header.Set(headerNegative, "true")
+	}
+	if token := c.promiseToken(key); token != "" {
+		req.Header.Set(headerPromiseToken, token)
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("put", req)
 	if err != nil {
 		return fmt.Errorf("executing request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	// The server releases the promise on success and on terminal rejections
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusConflict, http.StatusRequestEntityTooLarge:
+		c.dropPromise(key)
+	}
+
 	switch resp.StatusCode {
 	case http.StatusOK:
 		return nil
@@ -326,6 +825,96 @@ func (c *Client) Put(ctx context.Context, key string, value []byte, ttl time.Dur
 	}
 }
 
+// holdPromise remembers a promise token granted for the key.
+// Expired tokens are pruned once per tokenPruneInterval so abandoned promises
+// don't accumulate.
+func (c *Client) holdPromise(key, token string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultPromiseTTL
+	}
+	now := time.Now()
+
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	if now.Sub(c.tokensPruned) >= tokenPruneInterval {
+		for k, held := range c.tokens {
+			if held.expiresAt.Before(now) {
+				delete(c.tokens, k)
+			}
+		}
+		c.tokensPruned = now
+	}
+	c.tokens[key] = heldPromise{token: token, expiresAt: now.Add(ttl)}
+}
+
+// promiseToken returns the token of the promise held for the key, if any.
+// An expired token is pruned.
+func (c *Client) promiseToken(key string) string {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	held, ok := c.tokens[key]
+	if !ok {
+		return ""
+	}
+	if held.expiresAt.Before(time.Now()) {
+		delete(c.tokens, key)
+		return ""
+	}
+	return held.token
+}
+
+// dropPromise forgets the promise held for the key
+func (c *Client) dropPromise(key string) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+	delete(c.tokens, key)
+}
+
+// extendPromise sets the promise held for the key to expire ttl from now, if
+// it still has the token. A promise dropped or replaced meanwhile, e.g. by a
+// concurrent Put, is left alone.
+func (c *Client) extendPromise(key, token string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultPromiseTTL
+	}
+
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	if held, ok := c.tokens[key]; ok && held.token == token {
+		c.tokens[key] = heldPromise{token: token, expiresAt: time.Now().Add(ttl)}
+	}
+}
+
+// forgetPromise forgets the promise held for the key if it still has the token
+func (c *Client) forgetPromise(key, token string) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	if held, ok := c.tokens[key]; ok && held.token == token {
+		delete(c.tokens, key)
+	}
+}
+
+// readBody reads a response body into a single buffer sized from
+// Content-Length when it's known
+func readBody(resp *http.Response) ([]byte, error) {
+	var value []byte
+	var err error
+	if resp.ContentLength >= 0 {
+		value = make([]byte, resp.ContentLength)
+		_, err = io.ReadFull(resp.Body, value)
+	} else {
+		value, err = io.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return value, nil
+}
+
 // url constructs the full URL for a cache key
 func (c *Client) url(key string) string {
 	return c.baseURL + "/cache/" + url.PathEscape(key)
@@ -351,6 +940,8 @@ func parseEntry(resp *http.Response, value []byte) *Entry {
 	}
 
 	entry.Superhot = resp.Header.Get(headerSuperhot) == "true"
+	entry.Negative = resp.Header.Get(headerNegative) == "true"
+	entry.Stale = resp.Header.Get(headerStale) == "true"
 
 	return entry
 }
@@ -365,6 +956,22 @@ func parsePromiseTTL(resp *http.Response) time.Duration {
 	return 0
 }
 
+// parseFailureTTL extracts x-jc-failure-ttl from response headers
+func parseFailureTTL(resp *http.Response) time.Duration {
+	if ttlStr := resp.Header.Get(headerFailureTTL); ttlStr != "" {
+		if ttlMs, err := strconv.ParseInt(ttlStr, 10, 64); err == nil {
+			return time.Duration(ttlMs) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// originFailure returns the error for a key whose last load failed at the
+// origin. It matches both ErrOriginFailure and ErrNotFound.
+func originFailure(retryAfter time.Duration) error {
+	return fmt.Errorf("%w (retry after %v): %w", ErrOriginFailure, retryAfter, ErrNotFound)
+}
+
 // parseRetryAfter extracts Retry-After from response headers
 func parseRetryAfter(resp *http.Response) time.Duration {
 	if retryStr := resp.Header.Get(headerRetryAfter); retryStr != "" {
@@ -374,3 +981,12 @@ func parseRetryAfter(resp *http.Response) time.Duration {
 	}
 	return 0
 }
+
+// conflictBackoff returns how long to wait before retrying after a conflict.
+// Retry-After is rounded up to whole seconds, so the promise TTL is used when shorter.
+func conflictBackoff(result *PostResult) time.Duration {
+	if result.PromiseTTL > 0 && (result.RetryAfter <= 0 || result.PromiseTTL < result.RetryAfter) {
+		return result.PromiseTTL
+	}
+	return result.RetryAfter
+}
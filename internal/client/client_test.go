@@ -1,9 +1,14 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -338,3 +343,779 @@ func TestClient_GetWithRetry_NotFound(t *testing.T) {
 		t.Errorf("Error = %v, want ErrNotFound", err)
 	}
 }
+
+func TestClient_GetOrLoad_MissLoadsAndCaches(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		return []byte("origin"), time.Hour, nil
+	}
+
+	entry, err := client.GetOrLoad(ctx, "loadkey", loader)
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if string(entry.Value) != "origin" {
+		t.Errorf("Value = %q, want %q", entry.Value, "origin")
+	}
+
+	// Value was uploaded
+	entry, err = client.Get(ctx, "loadkey")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if string(entry.Value) != "origin" {
+		t.Errorf("Value = %q, want %q", entry.Value, "origin")
+	}
+
+	// Second call hits the cache
+	if _, err := client.GetOrLoad(ctx, "loadkey", loader); err != nil {
+		t.Fatalf("second GetOrLoad error = %v", err)
+	}
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestClient_GetOrLoad_WaitsOnConflict(t *testing.T) {
+	cs, ts, _ := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	// Another client holds a short promise and uploads shortly
+	other := New(ts.URL)
+	result, _ := other.Post(ctx, "herdkey", 0, 300*time.Millisecond, false)
+	if result.Status != PostAccepted {
+		t.Fatalf("Post status = %v, want PostAccepted", result.Status)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		other.Put(ctx, "herdkey", []byte("other"), time.Hour)
+	}()
+
+	client := New(ts.URL, WithRetryConfig(fastRetryConfig()))
+	entry, err := client.GetOrLoad(ctx, "herdkey", func(ctx context.Context) ([]byte, time.Duration, error) {
+		t.Error("loader should not be called while another client holds the promise")
+		return []byte("origin"), time.Hour, nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if string(entry.Value) != "other" {
+		t.Errorf("Value = %q, want %q", entry.Value, "other")
+	}
+}
+
+func TestClient_GetOrLoad_LoaderError(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+
+	originErr := errors.New("origin down")
+	_, err := client.GetOrLoad(context.Background(), "errkey", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return nil, 0, originErr
+	})
+	if !errors.Is(err, originErr) {
+		t.Errorf("GetOrLoad error = %v, want %v", err, originErr)
+	}
+}
+
+func TestClient_GetOrLoad_LoaderErrorReportsFailure(t *testing.T) {
+	cs, ts, _ := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	client := New(ts.URL, WithFailureTTL(time.Minute))
+	client.GetOrLoad(ctx, "failkey", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return nil, 0, errors.New("origin down")
+	})
+
+	// Other clients back off instead of loading it again
+	other := New(ts.URL, WithRetryConfig(fastRetryConfig()))
+	_, err := other.GetOrLoad(ctx, "failkey", func(ctx context.Context) ([]byte, time.Duration, error) {
+		t.Error("loader should not be called after an origin failure")
+		return []byte("origin"), time.Hour, nil
+	})
+	if !errors.Is(err, ErrOriginFailure) {
+		t.Errorf("GetOrLoad error = %v, want ErrOriginFailure", err)
+	}
+
+	result, _ := other.Post(ctx, "failkey", 0, 0, false)
+	if result.Status != PostConflict || result.FailureTTL < 50*time.Second {
+		t.Errorf("Post = %v with FailureTTL %v, want PostConflict with about a minute", result.Status, result.FailureTTL)
+	}
+}
+
+func TestClient_GetOrLoad_CanceledLoadAbandonsPromise(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.GetOrLoad(ctx, "cancelkey", func(ctx context.Context) ([]byte, time.Duration, error) {
+		cancel()
+		return nil, 0, ctx.Err()
+	})
+
+	// A canceled load isn't an origin failure; another client can load it
+	result, err := New(ts.URL).Post(context.Background(), "cancelkey", 0, 0, false)
+	if err != nil {
+		t.Fatalf("Post error = %v", err)
+	}
+	if result.Status != PostAccepted {
+		t.Errorf("Status = %v, want PostAccepted", result.Status)
+	}
+}
+
+func TestClient_ReportFailureWakesWaiters(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if err := client.ReportFailure(ctx, "failkey", time.Second); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("ReportFailure without a promise error = %v, want ErrNoPromise", err)
+	}
+
+	client.Post(ctx, "failkey", 0, 0, false)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.ReportFailure(ctx, "failkey", time.Second)
+	}()
+
+	start := time.Now()
+	_, err := New(ts.URL).get(ctx, "failkey", 5*time.Second, false)
+	if !errors.Is(err, ErrOriginFailure) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("get error = %v, want ErrOriginFailure and ErrNotFound", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("get returned after %v, want shortly after the failure", elapsed)
+	}
+}
+
+func TestClient_RenewPromise(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if _, err := client.RenewPromise(ctx, "renewkey", time.Minute); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("RenewPromise without a promise error = %v, want ErrNoPromise", err)
+	}
+
+	client.Post(ctx, "renewkey", 0, 100*time.Millisecond, false)
+	remaining, err := client.RenewPromise(ctx, "renewkey", time.Minute)
+	if err != nil {
+		t.Fatalf("RenewPromise error = %v", err)
+	}
+	if remaining < 50*time.Second {
+		t.Errorf("remaining = %v, want about a minute", remaining)
+	}
+
+	// The renewed promise outlives its original TTL, on the server and client
+	time.Sleep(150 * time.Millisecond)
+	if err := client.Put(ctx, "renewkey", []byte("value"), time.Hour); err != nil {
+		t.Errorf("Put after renewal error = %v", err)
+	}
+}
+
+func TestClient_RenewDoesNotRestoreDroppedPromise(t *testing.T) {
+	var client *Client
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A Put completes while the renewal is in flight
+		client.dropPromise("key")
+		w.Header().Set(headerPromiseTTL, "60000")
+	}))
+	defer ts.Close()
+	client = New(ts.URL)
+	client.holdPromise("key", "token", time.Minute)
+
+	if _, err := client.RenewPromise(context.Background(), "key", time.Minute); err != nil {
+		t.Fatalf("RenewPromise error = %v", err)
+	}
+	if _, ok := client.tokens["key"]; ok {
+		t.Error("a dropped promise should not be held again after renewal")
+	}
+}
+
+func TestClient_RenewExpiredPromise(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	client.Post(ctx, "expiredkey", 0, 50*time.Millisecond, false)
+	token := client.promiseToken("expiredkey")
+	time.Sleep(100 * time.Millisecond)
+
+	// Pretend the client still believes it holds the promise
+	client.holdPromise("expiredkey", token, time.Minute)
+	if _, err := client.RenewPromise(ctx, "expiredkey", time.Minute); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("RenewPromise error = %v, want ErrNoPromise", err)
+	}
+	if client.promiseToken("expiredkey") != "" {
+		t.Error("lost promise should be forgotten")
+	}
+}
+
+func TestClient_AbandonPromise(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	client.Post(ctx, "abandonkey", 0, 0, false)
+	if err := client.AbandonPromise(ctx, "abandonkey"); err != nil {
+		t.Fatalf("AbandonPromise error = %v", err)
+	}
+	if err := client.AbandonPromise(ctx, "abandonkey"); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("second AbandonPromise error = %v, want ErrNoPromise", err)
+	}
+	if err := client.Put(ctx, "abandonkey", []byte("value"), time.Hour); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("Put after abandoning error = %v, want ErrNoPromise", err)
+	}
+
+	result, _ := New(ts.URL).Post(ctx, "abandonkey", 0, 0, false)
+	if result.Status != PostAccepted {
+		t.Errorf("Status = %v, want PostAccepted", result.Status)
+	}
+}
+
+func TestClient_RenewWhileLoading(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	client.Post(ctx, "slowkey", 0, 100*time.Millisecond, false)
+	stop := client.renewWhileLoading(ctx, "slowkey", 100*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	stop()
+
+	if err := client.Put(ctx, "slowkey", []byte("value"), time.Hour); err != nil {
+		t.Errorf("Put after a slow load error = %v", err)
+	}
+}
+
+func TestClient_GetOrLoad_CachesOriginMiss(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		return nil, time.Minute, fmt.Errorf("user 42: %w", ErrOriginNotFound)
+	}
+
+	entry, err := client.GetOrLoad(ctx, "missing", loader)
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if !entry.Negative {
+		t.Error("GetOrLoad should return a negative entry")
+	}
+
+	entry, err = client.GetOrLoad(ctx, "missing", loader)
+	if err != nil {
+		t.Fatalf("second GetOrLoad error = %v", err)
+	}
+	if !entry.Negative || entry.RemainingTTL <= 0 || entry.RemainingTTL > time.Minute {
+		t.Errorf("second GetOrLoad = %+v, want the cached negative entry", entry)
+	}
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestClient_SetNegative(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if err := client.SetNegative(ctx, "missing", time.Minute); err != nil {
+		t.Fatalf("SetNegative error = %v", err)
+	}
+	entry, err := client.Get(ctx, "missing")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if !entry.Negative || len(entry.Value) != 0 || entry.Size != 0 {
+		t.Errorf("Get = %+v, want an empty negative entry", entry)
+	}
+
+	// Values aren't negative
+	client.Set(ctx, "present", []byte("value"), time.Minute)
+	if entry, _ := client.Get(ctx, "present"); entry.Negative {
+		t.Error("a value should not be negative")
+	}
+}
+
+func TestConflictBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		result PostResult
+		want   time.Duration
+	}{
+		{"retry after only", PostResult{RetryAfter: time.Second}, time.Second},
+		{"promise ttl only", PostResult{PromiseTTL: 200 * time.Millisecond}, 200 * time.Millisecond},
+		{"promise ttl shorter", PostResult{RetryAfter: time.Second, PromiseTTL: 200 * time.Millisecond}, 200 * time.Millisecond},
+		{"retry after shorter", PostResult{RetryAfter: time.Second, PromiseTTL: 5 * time.Second}, time.Second},
+		{"no hints", PostResult{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conflictBackoff(&tt.result); got != tt.want {
+				t.Errorf("conflictBackoff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "delkey", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	if err := client.Delete(ctx, "delkey"); err != nil {
+		t.Fatalf("Delete error = %v", err)
+	}
+	if _, err := client.Get(ctx, "delkey"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := client.Delete(ctx, "delkey"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_PostReturnsPromiseToken(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+
+	result, err := client.Post(context.Background(), "tokenkey", 5, 0, false)
+	if err != nil {
+		t.Fatalf("Post error = %v", err)
+	}
+	if result.PromiseToken == "" {
+		t.Error("PromiseToken should be set on PostAccepted")
+	}
+	if client.promiseToken("tokenkey") != result.PromiseToken {
+		t.Error("client should remember the promise token")
+	}
+}
+
+func TestClient_PutWithoutOwnPromise(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	// Another client holds the promise
+	result, _ := client.Post(ctx, "ownedkey", 0, 0, false)
+	if result.Status != PostAccepted {
+		t.Fatalf("Post status = %v, want PostAccepted", result.Status)
+	}
+
+	// A client that never called POST can't inject a value
+	intruder := New(ts.URL)
+	if err := intruder.Put(ctx, "ownedkey", []byte("injected"), time.Hour); !errors.Is(err, ErrNoPromise) {
+		t.Errorf("intruder Put error = %v, want ErrNoPromise", err)
+	}
+
+	if err := client.Put(ctx, "ownedkey", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("holder Put error = %v", err)
+	}
+	if client.promiseToken("ownedkey") != "" {
+		t.Error("token should be forgotten after a successful Put")
+	}
+
+	entry, _ := client.Get(ctx, "ownedkey")
+	if string(entry.Value) != "value" {
+		t.Errorf("Value = %q, want %q", entry.Value, "value")
+	}
+}
+
+func TestClient_ExpiredTokensArePruned(t *testing.T) {
+	client := New("http://unused")
+
+	client.holdPromise("old", "t1", time.Millisecond)
+	client.holdPromise("other", "t2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// Looking up an expired token prunes it
+	if client.promiseToken("old") != "" {
+		t.Error("expired token should not be returned")
+	}
+	if _, ok := client.tokens["old"]; ok {
+		t.Error("expired token should be pruned on lookup")
+	}
+
+	// Holding a promise only sweeps once per interval
+	client.holdPromise("new", "t3", time.Minute)
+	if _, ok := client.tokens["other"]; !ok {
+		t.Error("expired token should be kept until the next sweep")
+	}
+	client.tokensPruned = time.Now().Add(-tokenPruneInterval)
+	client.holdPromise("new", "t3", time.Minute)
+	if _, ok := client.tokens["other"]; ok {
+		t.Error("expired token should be pruned by the sweep")
+	}
+	if client.promiseToken("new") != "t3" {
+		t.Error("live token should be kept")
+	}
+}
+
+func TestClient_SetWithRetry_LongPollsOnConflict(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	// Another client holds a long promise and uploads shortly
+	other := New(ts.URL)
+	result, _ := other.Post(ctx, "pollkey", 0, time.Minute, false)
+	if result.Status != PostAccepted {
+		t.Fatalf("Post status = %v, want PostAccepted", result.Status)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		other.Put(ctx, "pollkey", []byte("other"), time.Hour)
+	}()
+
+	// Returns as soon as the upload lands, not after the Retry-After backoff
+	start := time.Now()
+	if err := client.SetWithRetry(ctx, "pollkey", []byte("mine"), time.Hour); err != nil {
+		t.Fatalf("SetWithRetry error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("SetWithRetry took %v, want to return when the upload lands", elapsed)
+	}
+
+	entry, err := client.Get(ctx, "pollkey")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if string(entry.Value) != "other" {
+		t.Errorf("Value = %q, want %q", entry.Value, "other")
+	}
+}
+
+func TestClient_GetWithRetry_LongPollsInFlightKey(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	other := New(ts.URL)
+	other.Post(ctx, "pollkey", 0, time.Minute, false)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		other.Put(ctx, "pollkey", []byte("other"), time.Hour)
+	}()
+
+	entry, err := client.GetWithRetry(ctx, "pollkey")
+	if err != nil {
+		t.Fatalf("GetWithRetry error = %v", err)
+	}
+	if string(entry.Value) != "other" {
+		t.Errorf("Value = %q, want %q", entry.Value, "other")
+	}
+}
+
+func TestClient_GetWithRetry_LongPollDisabled(t *testing.T) {
+	cs, ts, _ := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	other := New(ts.URL)
+	other.Post(ctx, "pollkey", 0, time.Minute, false)
+
+	client := New(ts.URL, WithLongPollWait(0))
+	if _, err := client.GetWithRetry(ctx, "pollkey"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetWithRetry error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_GetWithRetry_LongPollWithinTimeout(t *testing.T) {
+	cs, ts, other := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	other.Post(ctx, "pollkey", 0, time.Minute, false)
+
+	// The long-poll ends before the request times out
+	client := New(ts.URL, WithTimeout(200*time.Millisecond))
+	if _, err := client.GetWithRetry(ctx, "pollkey"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetWithRetry error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_SetStreamAndGetStream(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	value := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := client.SetStream(ctx, "streamkey", bytes.NewReader(value), int64(len(value)), time.Hour); err != nil {
+		t.Fatalf("SetStream error = %v", err)
+	}
+
+	body, entry, err := client.GetStream(ctx, "streamkey")
+	if err != nil {
+		t.Fatalf("GetStream error = %v", err)
+	}
+	defer body.Close()
+
+	if entry.Size != len(value) {
+		t.Errorf("Size = %d, want %d", entry.Size, len(value))
+	}
+	if entry.Value != nil {
+		t.Error("GetStream entry should not carry the value")
+	}
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading stream error = %v", err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("streamed %d bytes, want the %d stored", len(got), len(value))
+	}
+}
+
+func TestClient_GetStreamNotFound(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+
+	if _, _, err := client.GetStream(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetStream error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_SetStreamSizeRejected(t *testing.T) {
+	store := storage.NewInMemoryStorage(100)
+	cs := remote.NewCacheServer(":0", store)
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL)
+
+	value := make([]byte, 200)
+	err := client.SetStream(context.Background(), "bigkey", bytes.NewReader(value), int64(len(value)), time.Hour)
+	if !errors.Is(err, ErrInsufficientStorage) {
+		t.Errorf("SetStream error = %v, want ErrInsufficientStorage", err)
+	}
+}
+
+func TestClient_GetRange(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "rangekey", []byte("0123456789"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	entry, err := client.GetRange(ctx, "rangekey", 3, 4)
+	if err != nil {
+		t.Fatalf("GetRange error = %v", err)
+	}
+	if string(entry.Value) != "3456" {
+		t.Errorf("Value = %q, want %q", entry.Value, "3456")
+	}
+	if entry.Size != 10 {
+		t.Errorf("Size = %d, want 10 (whole value)", entry.Size)
+	}
+
+	// Length past the end is clamped; length <= 0 reads to the end
+	for _, length := range []int64{100, 0} {
+		entry, err = client.GetRange(ctx, "rangekey", 7, length)
+		if err != nil {
+			t.Fatalf("GetRange(7, %d) error = %v", length, err)
+		}
+		if string(entry.Value) != "789" {
+			t.Errorf("GetRange(7, %d) Value = %q, want %q", length, entry.Value, "789")
+		}
+	}
+
+	if _, err := client.GetRange(ctx, "rangekey", 10, 1); !errors.Is(err, ErrRangeNotSatisfiable) {
+		t.Errorf("GetRange past end error = %v, want ErrRangeNotSatisfiable", err)
+	}
+	if _, err := client.GetRange(ctx, "missing", 0, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRange missing key error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_PostUnavailableDuringShutdown(t *testing.T) {
+	cs, ts, client := newTestServerAndClient()
+	defer ts.Close()
+
+	cs.Shutdown(context.Background())
+
+	if _, err := client.Post(context.Background(), "key", 5, 0, false); err != ErrUnavailable {
+		t.Errorf("Post() error = %v, want ErrUnavailable", err)
+	}
+	if err := client.Set(context.Background(), "key", []byte("value"), time.Minute); err != ErrUnavailable {
+		t.Errorf("Set() error = %v, want ErrUnavailable", err)
+	}
+}
+
+// waitForValue polls the key until it holds a fresh copy of want
+func waitForValue(t *testing.T, client *Client, key, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if entry, err := client.Get(context.Background(), key); err == nil && !entry.Stale && string(entry.Value) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("key %q was not refreshed to %q", key, want)
+}
+
+func TestClient_GetOrLoad_StaleRefreshesInBackground(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000, storage.StorageOptions{StaleGrace: time.Hour}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL)
+	ctx := context.Background()
+
+	client.Set(ctx, "key", []byte("old"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	loader := func(ctx context.Context) ([]byte, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		return []byte("new"), time.Minute, nil
+	}
+
+	// Both callers get the stale value right away; only the first refreshes it
+	for i := 0; i < 2; i++ {
+		entry, err := New(ts.URL).GetOrLoad(ctx, "key", loader)
+		if err != nil {
+			t.Fatalf("GetOrLoad error = %v", err)
+		}
+		if !entry.Stale || string(entry.Value) != "old" || entry.RemainingTTL != 0 {
+			t.Errorf("GetOrLoad = %+v, want the stale value", entry)
+		}
+	}
+
+	close(release)
+	waitForValue(t, client, "key", "new")
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+}
+
+func TestClient_GetOrLoad_BackgroundRefreshBounded(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000, storage.StorageOptions{StaleGrace: time.Hour}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL, WithTimeout(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client.Set(ctx, "key", []byte("old"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	// The refresh outlives the caller's context but not the client timeout
+	deadlines := make(chan bool, 1)
+	client.GetOrLoad(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return []byte("new"), time.Minute, nil
+	})
+	cancel()
+	if !<-deadlines {
+		t.Error("background refresh should have a deadline")
+	}
+	waitForValue(t, client, "key", "new")
+}
+
+func TestClient_GetOrLoad_BackgroundRefreshesCapped(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000, storage.StorageOptions{StaleGrace: time.Hour}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL)
+	ctx := context.Background()
+
+	client.Set(ctx, "key", []byte("old"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	// With every refresh slot taken, the promise is given back instead
+	for i := 0; i < maxBackgroundRefreshes; i++ {
+		client.refreshes <- struct{}{}
+	}
+	var calls atomic.Int32
+	entry, err := client.GetOrLoad(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		calls.Add(1)
+		return []byte("new"), time.Minute, nil
+	})
+	if err != nil || !entry.Stale {
+		t.Fatalf("GetOrLoad = %+v, %v, want the stale value", entry, err)
+	}
+
+	other := New(ts.URL)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if entry, _ := other.get(ctx, "key", 0, true); entry != nil && entry.refreshTTL > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh promise was not abandoned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("loader called %d times, want 0", n)
+	}
+}
+
+func TestClient_GetStale(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000, storage.StorageOptions{StaleGrace: time.Hour}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL)
+	ctx := context.Background()
+
+	client.Set(ctx, "key", []byte("old"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	entry, err := client.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if !entry.Stale || string(entry.Value) != "old" {
+		t.Errorf("Get = %+v, want the stale value", entry)
+	}
+
+	// Plain reads don't take the refresh promise
+	if err := client.Set(ctx, "key", []byte("new"), time.Minute); err != nil {
+		t.Fatalf("Set over a stale entry error = %v", err)
+	}
+	waitForValue(t, client, "key", "new")
+}
@@ -0,0 +1,634 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/satmihir/justcache/internal/rendezvous"
+	"github.com/satmihir/justcache/internal/retry"
+)
+
+// Default number of hosts (primary + replicas) a key is stored on
+const defaultReplicas = 2
+
+// ErrNoNodes is returned when the router has no nodes for a key
+var ErrNoNodes = errors.New("no cache nodes available")
+
+// ClusterClient is a JustCache client for a cluster of servers.
+// It implements the "smart" client semantics from spec/cache_client.md on top
+// of a rendezvous.Router and one Client per node.
+type ClusterClient struct {
+	router      rendezvous.Router
+	replicas    int
+	writeBack   bool
+	retryConfig retry.Config
+	nodeAddr    func(node *rendezvous.Node) string
+	nodeOpts    []Option
+	metrics     Metrics
+
+	mu      sync.Mutex
+	clients map[string]*Client // keyed by node identity
+}
+
+// ClusterOption configures the cluster client
+type ClusterOption func(*ClusterClient)
+
+// WithReplicas sets the number of hosts (primary + replicas) used per key
+func WithReplicas(n int) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.replicas = n
+	}
+}
+
+// WithWriteBack enables best-effort write-back of replica hits to the
+// higher-ranked hosts that missed
+func WithWriteBack(enabled bool) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.writeBack = enabled
+	}
+}
+
+// WithClusterRetryConfig sets the retry configuration for herd-control waits
+func WithClusterRetryConfig(config retry.Config) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.retryConfig = config
+	}
+}
+
+// WithNodeAddr sets the function that maps a node to its server base URL.
+// The default is "http://{id}:{port}".
+func WithNodeAddr(fn func(node *rendezvous.Node) string) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.nodeAddr = fn
+	}
+}
+
+// WithNodeOptions sets the options used to create the per-node clients
+func WithNodeOptions(opts ...Option) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.nodeOpts = opts
+	}
+}
+
+// WithClusterMetrics sets the hook that receives the request and retry
+// measurements of every node client. A GetOrLoad retried because of a
+// conflict is reported against the conflicting node.
+func WithClusterMetrics(m Metrics) ClusterOption {
+	return func(cc *ClusterClient) {
+		cc.metrics = m
+	}
+}
+
+// NewClusterClient creates a new ClusterClient that routes keys with the given router.
+// If the router is a rendezvous.LoadRecorder, every request sent to a node is
+// recorded with it.
+func NewClusterClient(router rendezvous.Router, opts ...ClusterOption) *ClusterClient {
+	cc := &ClusterClient{
+		router:      router,
+		replicas:    defaultReplicas,
+		retryConfig: retry.DefaultConfig(),
+		nodeAddr:    defaultNodeAddr,
+		clients:     make(map[string]*Client),
+	}
+	for _, opt := range opts {
+		opt(cc)
+	}
+	if cc.replicas <= 0 {
+		cc.replicas = defaultReplicas
+	}
+	return cc
+}
+
+// Get retrieves a value from the cluster.
+// Hosts are queried serially in rendezvous order, continuing past misses and
+// transport failures. Returns ErrNotFound if no host has the key.
+// As with Client.Get, the returned Value must not be modified.
+func (cc *ClusterClient) Get(ctx context.Context, key string) (*Entry, error) {
+	nodes := cc.readNodesFor(key)
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	entry, _, err := cc.get(ctx, key, nodes, false)
+	return entry, err
+}
+
+// Set stores a value on the hosts for the key.
+// It issues parallel POSTs and then PUTs the value to exactly the hosts that
+// granted a promise. Returns nil if the value was stored on (or already exists
+// on) at least one host.
+func (cc *ClusterClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	nodes := cc.nodesFor(key)
+	if len(nodes) == 0 {
+		return ErrNoNodes
+	}
+
+	accepted, outcome := cc.promise(ctx, key, int64(len(value)), nodes)
+	if len(accepted) > 0 {
+		if stored, err := cc.putAll(ctx, key, &Entry{Value: value, RemainingTTL: ttl}, accepted); stored == 0 {
+			return err
+		}
+		return nil
+	}
+	return outcome.err()
+}
+
+// SetNegative stores a negative entry for the key on all of its hosts, as
+// Set does for a value. See Client.SetNegative.
+func (cc *ClusterClient) SetNegative(ctx context.Context, key string, ttl time.Duration) error {
+	nodes := cc.nodesFor(key)
+	if len(nodes) == 0 {
+		return ErrNoNodes
+	}
+
+	accepted, outcome := cc.promise(ctx, key, 0, nodes)
+	if len(accepted) > 0 {
+		if stored, err := cc.putAll(ctx, key, &Entry{RemainingTTL: ttl, Negative: true}, accepted); stored == 0 {
+			return err
+		}
+		return nil
+	}
+	return outcome.err()
+}
+
+// GetOrLoad retrieves a value from the cluster, loading it from the origin on a miss.
+//
+// It follows the full read/populate flow: serial GETs in rendezvous order,
+// then parallel POSTs for herd control. If any host grants a promise, the
+// loader is called and the value is uploaded to exactly those hosts. If other
+// clients hold the promises, it long-polls a conflicting host for the upload
+// (or waits using the server hints) and retries. If no host grants a promise
+// and one reports an origin failure, it returns an error matching
+// ErrOriginFailure. A stale entry is returned right away and, if this client
+// gets the promise to refresh it, reloaded on that host in the background.
+func (cc *ClusterClient) GetOrLoad(ctx context.Context, key string, loader Loader) (*Entry, error) {
+	nodes := cc.nodesFor(key)
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	readNodes := cc.readNodesFor(key)
+
+	// The node whose conflict caused the retry, reported when it starts
+	var retryNode *Client
+	return retry.DoWithHint(ctx, cc.retryConfig, func() (*Entry, error, bool, time.Duration) {
+		if retryNode != nil && cc.metrics != nil {
+			cc.metrics.ObserveRetry(retryNode.baseURL, "get_or_load")
+		}
+
+		if entry, c, err := cc.get(ctx, key, readNodes, true); err == nil {
+			if entry.refreshTTL > 0 {
+				c.refreshInBackground(ctx, key, loader, entry.refreshTTL)
+			}
+			return entry, nil, false, 0
+		}
+
+		accepted, outcome := cc.promise(ctx, key, 0, nodes)
+
+		// The key appeared during the race; read it from those hosts first
+		for _, node := range outcome.exists {
+			if entry, err := cc.clientFor(node).Get(ctx, key); err == nil {
+				return entry, nil, false, 0
+			}
+		}
+
+		// The last load failed at the origin; don't add to its load
+		if len(accepted) == 0 && outcome.failureTTL > 0 {
+			return nil, originFailure(outcome.failureTTL), false, 0
+		}
+
+		// Another client is populating every reachable host; wait and re-GET
+		if len(accepted) == 0 && len(outcome.conflicts) > 0 {
+			c := cc.clientFor(outcome.conflicts[0])
+			retryNode = c
+			if c.longPollWait <= 0 {
+				return nil, ErrConflict, true, outcome.backoff
+			}
+			entry, err := c.get(ctx, key, c.pollWait(), false)
+			if err == nil {
+				return entry, nil, false, 0
+			}
+			if errors.Is(err, ErrOriginFailure) {
+				return nil, err, false, 0
+			}
+			return nil, ErrConflict, true, 0
+		}
+
+		// Keep the promises alive while the origin is slow, and give them up
+		// if it fails so waiting clients back off together
+		stops := make([]func(), len(accepted))
+		for i, node := range accepted {
+			stops[i] = cc.clientFor(node).renewWhileLoading(ctx, key, 0)
+		}
+		value, ttl, err := loader(ctx)
+		for _, stop := range stops {
+			stop()
+		}
+		if errors.Is(err, ErrOriginNotFound) {
+			entry := &Entry{RemainingTTL: ttl, Negative: true}
+			cc.putAll(ctx, key, entry, accepted)
+			return entry, nil, false, 0
+		}
+		if err != nil {
+			for _, node := range accepted {
+				cc.clientFor(node).giveUpPromise(ctx, key)
+			}
+			return nil, err, false, 0
+		}
+
+		// Best-effort upload; the caller gets the value either way
+		entry := &Entry{Value: value, Size: len(value), RemainingTTL: ttl}
+		cc.putAll(ctx, key, entry, accepted)
+
+		return entry, nil, false, 0
+	})
+}
+
+// Delete removes a key from all of its hosts in parallel.
+// Hosts that don't have the key are not an error. Returns the joined errors of
+// the hosts that could not be reached, since they may still serve the old value.
+func (cc *ClusterClient) Delete(ctx context.Context, key string) error {
+	nodes := cc.readNodesFor(key)
+	if len(nodes) == 0 {
+		return ErrNoNodes
+	}
+
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *rendezvous.Node) {
+			defer wg.Done()
+			if err := cc.clientFor(node).Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+				errs[i] = fmt.Errorf("node %s: %w", node, err)
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// GetMulti retrieves several keys from the cluster with batched requests.
+// Keys are grouped by their primary host and the batches are sent in parallel;
+// keys that miss (or whose host fails) are then regrouped by their next host
+// in rendezvous order, and so on.
+//
+// Returns the entries of the keys that were found; misses are omitted. The
+// error is non-nil if some keys could not be checked because every one of
+// their hosts failed.
+func (cc *ClusterClient) GetMulti(ctx context.Context, keys []string) (map[string]*Entry, error) {
+	found := make(map[string]*Entry, len(keys))
+	nodes := make(map[string][]*rendezvous.Node, len(keys))
+	// answered records the keys at least one host responded for
+	answered := make(map[string]bool, len(keys))
+
+	var pending []string
+	for _, key := range keys {
+		if _, ok := nodes[key]; !ok {
+			nodes[key] = cc.readNodesFor(key)
+			if len(nodes[key]) == 0 {
+				return nil, ErrNoNodes
+			}
+			pending = append(pending, key)
+		}
+	}
+
+	var errs []error
+	for rank := 0; len(pending) > 0; rank++ {
+		groups := groupByNode(pending, func(key string) []*rendezvous.Node {
+			if rank < len(nodes[key]) {
+				return nodes[key][rank : rank+1]
+			}
+			return nil
+		})
+		if len(groups) == 0 {
+			break
+		}
+
+		results := make([]map[string]*Entry, len(groups))
+		groupErrs := make([]error, len(groups))
+
+		var wg sync.WaitGroup
+		for i, group := range groups {
+			wg.Add(1)
+			go func(i int, group nodeKeys) {
+				defer wg.Done()
+				results[i], groupErrs[i] = cc.clientFor(group.node).GetMulti(ctx, group.keys)
+			}(i, group)
+		}
+		wg.Wait()
+
+		pending = pending[:0]
+		for i, group := range groups {
+			if groupErrs[i] != nil {
+				if ctx.Err() != nil {
+					return found, ctx.Err()
+				}
+				// Transient host failure: fall back to the next host
+				errs = append(errs, fmt.Errorf("node %s: %w", group.node, groupErrs[i]))
+				pending = append(pending, group.keys...)
+				continue
+			}
+			for _, key := range group.keys {
+				answered[key] = true
+				entry, ok := results[i][key]
+				if !ok {
+					pending = append(pending, key)
+					continue
+				}
+				found[key] = entry
+				if cc.writeBack && rank > 0 {
+					go cc.writeBackTo(key, entry, nodes[key][:rank])
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		for key := range nodes {
+			if !answered[key] {
+				return found, errors.Join(errs...)
+			}
+		}
+	}
+	return found, nil
+}
+
+// SetMulti stores several values on the hosts for their keys using batched
+// requests. Keys are grouped by host and each host gets a single batched
+// POST+PUT flow, in parallel with the others.
+//
+// A key counts as stored if it was stored on (or already exists on) at least
+// one of its hosts. Returns the errors of the keys that weren't stored
+// anywhere; the map is empty if every key was stored.
+func (cc *ClusterClient) SetMulti(ctx context.Context, values map[string][]byte, ttl time.Duration) (map[string]error, error) {
+	keys := make([]string, 0, len(values))
+	nodes := make(map[string][]*rendezvous.Node, len(values))
+	for key := range values {
+		keys = append(keys, key)
+		nodes[key] = cc.nodesFor(key)
+		if len(nodes[key]) == 0 {
+			return nil, ErrNoNodes
+		}
+	}
+
+	// Each key is sent to all of its hosts
+	groups := groupByNode(keys, func(key string) []*rendezvous.Node {
+		return nodes[key]
+	})
+
+	failures := make([]map[string]error, len(groups))
+	groupErrs := make([]error, len(groups))
+
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group nodeKeys) {
+			defer wg.Done()
+			groupValues := make(map[string][]byte, len(group.keys))
+			for _, key := range group.keys {
+				groupValues[key] = values[key]
+			}
+			failures[i], groupErrs[i] = cc.clientFor(group.node).SetMulti(ctx, groupValues, ttl)
+		}(i, group)
+	}
+	wg.Wait()
+
+	stored := make(map[string]bool, len(keys))
+	keyErrs := make(map[string][]error)
+	for i, group := range groups {
+		for _, key := range group.keys {
+			err := groupErrs[i]
+			if err == nil {
+				err = failures[i][key]
+			}
+			if err == nil {
+				stored[key] = true
+				continue
+			}
+			keyErrs[key] = append(keyErrs[key], fmt.Errorf("node %s: %w", group.node, err))
+		}
+	}
+
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if !stored[key] {
+			failed[key] = errors.Join(keyErrs[key]...)
+		}
+	}
+	return failed, nil
+}
+
+// nodeKeys is a group of keys sent to the same node
+type nodeKeys struct {
+	node *rendezvous.Node
+	keys []string
+}
+
+// groupByNode adds each key to the group of every node nodesOf returns for it,
+// preserving the order in which nodes are first seen
+func groupByNode(keys []string, nodesOf func(key string) []*rendezvous.Node) []nodeKeys {
+	var groups []nodeKeys
+	index := make(map[string]int)
+	for _, key := range keys {
+		for _, node := range nodesOf(key) {
+			i, ok := index[node.String()]
+			if !ok {
+				i = len(groups)
+				index[node.String()] = i
+				groups = append(groups, nodeKeys{node: node})
+			}
+			groups[i].keys = append(groups[i].keys, key)
+		}
+	}
+	return groups
+}
+
+// get issues GETs serially in rendezvous order until a host returns a hit,
+// and returns the client of that host. With refresh, it asks for the promise
+// to refresh a stale entry; see Client.get.
+func (cc *ClusterClient) get(ctx context.Context, key string, nodes []*rendezvous.Node, refresh bool) (*Entry, *Client, error) {
+	var lastErr error
+	missed := false
+	for i, node := range nodes {
+		c := cc.clientFor(node)
+		entry, err := c.get(ctx, key, 0, refresh)
+		if err == nil {
+			if cc.writeBack && i > 0 {
+				go cc.writeBackTo(key, entry, nodes[:i])
+			}
+			return entry, c, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			missed = true
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		// Transient host failure: fall back to the next host
+		lastErr = fmt.Errorf("node %s: %w", node, err)
+	}
+
+	if missed || lastErr == nil {
+		return nil, nil, ErrNotFound
+	}
+	return nil, nil, lastErr
+}
+
+// postOutcome aggregates the results of a parallel POST round
+type postOutcome struct {
+	exists       []*rendezvous.Node
+	conflicts    []*rendezvous.Node
+	insufficient []*rendezvous.Node
+	errs         []error
+	// backoff is the longest server-suggested wait among conflicting hosts
+	backoff time.Duration
+	// failureTTL is the longest origin failure reported by conflicting hosts
+	failureTTL time.Duration
+}
+
+// err summarizes an outcome in which no host granted a promise
+func (o *postOutcome) err() error {
+	switch {
+	case len(o.exists) > 0:
+		return nil
+	case len(o.conflicts) > 0:
+		return ErrConflict
+	case len(o.insufficient) > 0:
+		return ErrInsufficientStorage
+	default:
+		return errors.Join(o.errs...)
+	}
+}
+
+// promise issues parallel POSTs to the nodes and returns the nodes that
+// granted a promise, along with the aggregated outcome for the rest
+func (cc *ClusterClient) promise(ctx context.Context, key string, size int64, nodes []*rendezvous.Node) ([]*rendezvous.Node, *postOutcome) {
+	results := make([]*PostResult, len(nodes))
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *rendezvous.Node) {
+			defer wg.Done()
+			results[i], errs[i] = cc.clientFor(node).Post(ctx, key, size, 0, false)
+		}(i, node)
+	}
+	wg.Wait()
+
+	var accepted []*rendezvous.Node
+	outcome := &postOutcome{}
+	for i, node := range nodes {
+		if errs[i] != nil {
+			outcome.errs = append(outcome.errs, fmt.Errorf("node %s: %w", node, errs[i]))
+			continue
+		}
+		switch results[i].Status {
+		case PostAccepted:
+			accepted = append(accepted, node)
+		case PostExists:
+			outcome.exists = append(outcome.exists, node)
+		case PostConflict:
+			outcome.conflicts = append(outcome.conflicts, node)
+			if hint := conflictBackoff(results[i]); hint > outcome.backoff {
+				outcome.backoff = hint
+			}
+			outcome.failureTTL = max(outcome.failureTTL, results[i].FailureTTL)
+		case PostInsufficientStorage:
+			outcome.insufficient = append(outcome.insufficient, node)
+		}
+	}
+	return accepted, outcome
+}
+
+// putAll uploads the entry's value, or a negative entry, to the nodes in
+// parallel with the entry's RemainingTTL as the TTL.
+// Returns the number of nodes that stored the value and the joined errors of the rest.
+func (cc *ClusterClient) putAll(ctx context.Context, key string, entry *Entry, nodes []*rendezvous.Node) (int, error) {
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *rendezvous.Node) {
+			defer wg.Done()
+			c := cc.clientFor(node)
+			var err error
+			if entry.Negative {
+				err = c.PutNegative(ctx, key, entry.RemainingTTL)
+			} else {
+				err = c.Put(ctx, key, entry.Value, entry.RemainingTTL)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("node %s: %w", node, err)
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	stored := 0
+	for _, err := range errs {
+		if err == nil {
+			stored++
+		}
+	}
+	return stored, errors.Join(errs...)
+}
+
+// writeBackTo best-effort uploads a replica hit to the hosts that missed
+func (cc *ClusterClient) writeBackTo(key string, entry *Entry, nodes []*rendezvous.Node) {
+	if entry.RemainingTTL <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), entry.RemainingTTL)
+	defer cancel()
+
+	accepted, _ := cc.promise(ctx, key, int64(len(entry.Value)), nodes)
+	cc.putAll(ctx, key, entry, accepted)
+}
+
+// nodesFor returns the hosts to write a key to in rendezvous order
+func (cc *ClusterClient) nodesFor(key string) []*rendezvous.Node {
+	return cc.router.GetNodes([]byte(key), cc.replicas)
+}
+
+// readNodesFor returns the hosts to read or delete a key from in rendezvous
+// order. If the router is a rendezvous.ReadRouter, these may include hosts
+// that aren't written to but may still hold the key.
+func (cc *ClusterClient) readNodesFor(key string) []*rendezvous.Node {
+	if reader, ok := cc.router.(rendezvous.ReadRouter); ok {
+		return reader.GetReadNodes([]byte(key), cc.replicas)
+	}
+	return cc.nodesFor(key)
+}
+
+// clientFor returns the client for a node, creating it on first use
+func (cc *ClusterClient) clientFor(node *rendezvous.Node) *Client {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	c, ok := cc.clients[node.String()]
+	if !ok {
+		opts := cc.nodeOpts
+		metrics := cc.metrics
+		if recorder, ok := cc.router.(rendezvous.LoadRecorder); ok {
+			metrics = &loadMetrics{node: node, recorder: recorder, next: metrics}
+		}
+		if metrics != nil {
+			opts = append(opts[:len(opts):len(opts)], WithMetrics(metrics))
+		}
+		c = New(cc.nodeAddr(node), opts...)
+		cc.clients[node.String()] = c
+	}
+	return c
+}
+
+// defaultNodeAddr maps a node to a plain HTTP base URL
+func defaultNodeAddr(node *rendezvous.Node) string {
+	return "http://" + node.String()
+}
@@ -0,0 +1,530 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/remote"
+	"github.com/satmihir/justcache/internal/rendezvous"
+	"github.com/satmihir/justcache/internal/retry"
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+type testCluster struct {
+	servers []*remote.CacheServer
+	https   []*httptest.Server
+	nodes   []*rendezvous.Node
+	router  *rendezvous.RendezvousRouter
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	t.Helper()
+	return newTestClusterWithStorage(t, size, storage.StorageOptions{})
+}
+
+// newTestClusterWithStorage starts a cluster whose servers use the given
+// storage options
+func newTestClusterWithStorage(t *testing.T, size int, opts storage.StorageOptions) *testCluster {
+	t.Helper()
+	tc := &testCluster{}
+	for i := 0; i < size; i++ {
+		cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000, opts))
+		ts := httptest.NewServer(cs.Handler())
+		host, portStr, _ := net.SplitHostPort(ts.Listener.Addr().String())
+		port, _ := strconv.Atoi(portStr)
+
+		tc.servers = append(tc.servers, cs)
+		tc.https = append(tc.https, ts)
+		tc.nodes = append(tc.nodes, rendezvous.NewNode(host, port))
+	}
+	tc.router = rendezvous.NewRendezvousRouter(tc.nodes, nil)
+	t.Cleanup(tc.close)
+	return tc
+}
+
+func (tc *testCluster) close() {
+	for i := range tc.servers {
+		tc.https[i].Close()
+		tc.servers[i].Stop()
+	}
+}
+
+// direct returns a single-server client for the given node
+func (tc *testCluster) direct(node *rendezvous.Node) *Client {
+	return New("http://" + node.String())
+}
+
+// stop shuts down the server behind the given node
+func (tc *testCluster) stop(node *rendezvous.Node) {
+	for i, n := range tc.nodes {
+		if n == node {
+			tc.https[i].Close()
+		}
+	}
+}
+
+func fastRetryConfig() retry.Config {
+	return retry.Config{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		MaxAttempts:  10,
+	}
+}
+
+func TestClusterClient_GetNotFound(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+
+	_, err := cc.Get(context.Background(), "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClusterClient_NoNodes(t *testing.T) {
+	cc := NewClusterClient(rendezvous.NewRendezvousRouter(nil, nil))
+
+	if _, err := cc.Get(context.Background(), "key"); !errors.Is(err, ErrNoNodes) {
+		t.Errorf("Get error = %v, want ErrNoNodes", err)
+	}
+	if err := cc.Set(context.Background(), "key", []byte("v"), time.Hour); !errors.Is(err, ErrNoNodes) {
+		t.Errorf("Set error = %v, want ErrNoNodes", err)
+	}
+}
+
+func TestClusterClient_SetStoresOnReplicas(t *testing.T) {
+	tc := newTestCluster(t, 4)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	if err := cc.Set(ctx, "mykey", []byte("myvalue"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	owners := tc.router.GetNodes([]byte("mykey"), 2)
+	holders := 0
+	for _, node := range tc.nodes {
+		if _, err := tc.direct(node).Get(ctx, "mykey"); err == nil {
+			holders++
+			if node != owners[0] && node != owners[1] {
+				t.Errorf("value stored on non-owner node %s", node)
+			}
+		}
+	}
+	if holders != 2 {
+		t.Errorf("value stored on %d nodes, want 2", holders)
+	}
+
+	entry, err := cc.Get(ctx, "mykey")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if string(entry.Value) != "myvalue" {
+		t.Errorf("Value = %q, want %q", entry.Value, "myvalue")
+	}
+}
+
+func TestClusterClient_SetSkipsConflictingHost(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	owners := tc.router.GetNodes([]byte("key"), 2)
+
+	// Another client holds the promise on the primary
+	if result, _ := tc.direct(owners[0]).Post(ctx, "key", 0, 0, false); result.Status != PostAccepted {
+		t.Fatalf("Post status = %v, want PostAccepted", result.Status)
+	}
+
+	if err := cc.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	if _, err := tc.direct(owners[0]).Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("primary Get error = %v, want ErrNotFound", err)
+	}
+	if _, err := tc.direct(owners[1]).Get(ctx, "key"); err != nil {
+		t.Errorf("replica Get error = %v", err)
+	}
+}
+
+func TestClusterClient_GetFallsBackPastFailedHost(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	if err := cc.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	tc.stop(tc.router.GetNodes([]byte("key"), 1)[0])
+
+	entry, err := cc.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+	if string(entry.Value) != "value" {
+		t.Errorf("Value = %q, want %q", entry.Value, "value")
+	}
+}
+
+func TestClusterClient_GetAllHostsDown(t *testing.T) {
+	tc := newTestCluster(t, 2)
+	cc := NewClusterClient(tc.router)
+
+	for _, node := range tc.nodes {
+		tc.stop(node)
+	}
+
+	_, err := cc.Get(context.Background(), "key")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get error = %v, want transport error", err)
+	}
+}
+
+func TestClusterClient_WriteBack(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router, WithWriteBack(true))
+	ctx := context.Background()
+
+	owners := tc.router.GetNodes([]byte("key"), 2)
+	replica := tc.direct(owners[1])
+	if err := replica.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("replica Set error = %v", err)
+	}
+
+	if _, err := cc.Get(ctx, "key"); err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := tc.direct(owners[0]).Get(ctx, "key"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("value was not written back to the primary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterClient_GetOrLoad(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context) ([]byte, time.Duration, error) {
+		loads.Add(1)
+		return []byte("origin"), time.Hour, nil
+	}
+
+	entry, err := cc.GetOrLoad(ctx, "key", loader)
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if string(entry.Value) != "origin" {
+		t.Errorf("Value = %q, want %q", entry.Value, "origin")
+	}
+
+	// Value was uploaded to both owners
+	for _, node := range tc.router.GetNodes([]byte("key"), 2) {
+		if _, err := tc.direct(node).Get(ctx, "key"); err != nil {
+			t.Errorf("node %s Get error = %v", node, err)
+		}
+	}
+
+	// Second call is served from the cache
+	if _, err := cc.GetOrLoad(ctx, "key", loader); err != nil {
+		t.Fatalf("second GetOrLoad error = %v", err)
+	}
+	if loads.Load() != 1 {
+		t.Errorf("loader called %d times, want 1", loads.Load())
+	}
+}
+
+func TestClusterClient_GetOrLoadWaitsOnConflict(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router, WithClusterRetryConfig(fastRetryConfig()))
+	ctx := context.Background()
+
+	// Another client holds promises on every owner and uploads shortly
+	owners := tc.router.GetNodes([]byte("key"), 2)
+	others := make([]*Client, len(owners))
+	for i, node := range owners {
+		others[i] = tc.direct(node)
+		result, _ := others[i].Post(ctx, "key", 0, 300*time.Millisecond, false)
+		if result.Status != PostAccepted {
+			t.Fatalf("Post status = %v, want PostAccepted", result.Status)
+		}
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for _, other := range others {
+			other.Put(ctx, "key", []byte("other"), time.Hour)
+		}
+	}()
+
+	entry, err := cc.GetOrLoad(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		t.Error("loader should not be called while another client populates")
+		return []byte("origin"), time.Hour, nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if string(entry.Value) != "other" {
+		t.Errorf("Value = %q, want %q", entry.Value, "other")
+	}
+}
+
+func TestClusterClient_GetOrLoadLoaderError(t *testing.T) {
+	tc := newTestCluster(t, 2)
+	cc := NewClusterClient(tc.router)
+
+	originErr := errors.New("origin down")
+	_, err := cc.GetOrLoad(context.Background(), "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return nil, 0, originErr
+	})
+	if !errors.Is(err, originErr) {
+		t.Errorf("GetOrLoad error = %v, want %v", err, originErr)
+	}
+
+	// The failure was reported to every owner, so others back off
+	_, err = cc.GetOrLoad(context.Background(), "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		t.Error("loader should not be called after an origin failure")
+		return []byte("origin"), time.Hour, nil
+	})
+	if !errors.Is(err, ErrOriginFailure) {
+		t.Errorf("second GetOrLoad error = %v, want ErrOriginFailure", err)
+	}
+	for _, node := range tc.router.GetNodes([]byte("key"), 2) {
+		result, _ := tc.direct(node).Post(context.Background(), "key", 0, 0, false)
+		if result.Status != PostConflict || result.FailureTTL <= 0 {
+			t.Errorf("node %s Post = %v with FailureTTL %v, want a reported failure", node, result.Status, result.FailureTTL)
+		}
+	}
+}
+
+func TestClusterClient_GetOrLoadCachesOriginMiss(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	entry, err := cc.GetOrLoad(ctx, "missing", func(ctx context.Context) ([]byte, time.Duration, error) {
+		return nil, time.Minute, ErrOriginNotFound
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if !entry.Negative {
+		t.Error("GetOrLoad should return a negative entry")
+	}
+
+	// The negative entry was stored on both owners
+	for _, node := range tc.router.GetNodes([]byte("missing"), 2) {
+		entry, err := tc.direct(node).Get(ctx, "missing")
+		if err != nil || !entry.Negative {
+			t.Errorf("node %s Get = %+v, %v; want a negative entry", node, entry, err)
+		}
+	}
+}
+
+func TestClusterClient_DeleteFansOut(t *testing.T) {
+	tc := newTestCluster(t, 4)
+	cc := NewClusterClient(tc.router, WithReplicas(3))
+	ctx := context.Background()
+
+	if err := cc.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+
+	if err := cc.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete error = %v", err)
+	}
+	for _, node := range tc.nodes {
+		if _, err := tc.direct(node).Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("node %s Get after Delete error = %v, want ErrNotFound", node, err)
+		}
+	}
+
+	// Deleting a key nobody holds is not an error
+	if err := cc.Delete(ctx, "key"); err != nil {
+		t.Errorf("Delete of missing key error = %v", err)
+	}
+}
+
+func TestClusterClient_DeleteReportsUnreachableHost(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+
+	tc.stop(tc.router.GetNodes([]byte("key"), 1)[0])
+
+	if err := cc.Delete(context.Background(), "key"); err == nil {
+		t.Error("Delete should report the unreachable host")
+	}
+}
+
+func TestClusterClient_SetMultiAndGetMulti(t *testing.T) {
+	tc := newTestCluster(t, 4)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	values := make(map[string][]byte)
+	keys := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		values[key] = []byte("value-" + key)
+		keys = append(keys, key)
+	}
+
+	failed, err := cc.SetMulti(ctx, values, time.Hour)
+	if err != nil {
+		t.Fatalf("SetMulti error = %v", err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("SetMulti failed keys = %v, want none", failed)
+	}
+
+	// Every key landed on exactly its owners
+	for _, key := range keys[:5] {
+		for _, node := range tc.router.GetNodes([]byte(key), 2) {
+			if _, err := tc.direct(node).Get(ctx, key); err != nil {
+				t.Errorf("owner %s of %q Get error = %v", node, key, err)
+			}
+		}
+	}
+
+	entries, err := cc.GetMulti(ctx, append(keys, "missing"))
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	if len(entries) != len(keys) {
+		t.Errorf("GetMulti returned %d entries, want %d", len(entries), len(keys))
+	}
+	for _, key := range keys {
+		if entry, ok := entries[key]; !ok || string(entry.Value) != string(values[key]) {
+			t.Errorf("GetMulti[%q] = %v, want %q", key, entry, values[key])
+		}
+	}
+}
+
+func TestClusterClient_GetMultiFallsBackToReplicas(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	cc := NewClusterClient(tc.router)
+	ctx := context.Background()
+
+	if err := cc.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+	tc.stop(tc.router.GetNodes([]byte("key"), 1)[0])
+
+	entries, err := cc.GetMulti(ctx, []string{"key"})
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	if string(entries["key"].Value) != "value" {
+		t.Errorf("GetMulti = %v, want the replica's value", entries)
+	}
+}
+
+func TestClusterClient_GetMultiAllHostsDown(t *testing.T) {
+	tc := newTestCluster(t, 2)
+	cc := NewClusterClient(tc.router)
+
+	for _, node := range tc.nodes {
+		tc.stop(node)
+	}
+
+	if _, err := cc.GetMulti(context.Background(), []string{"key"}); err == nil {
+		t.Error("GetMulti should report that no host could be reached")
+	}
+}
+
+func TestClusterClient_GetOrLoad_StaleRefreshesInBackground(t *testing.T) {
+	tc := newTestClusterWithStorage(t, 3, storage.StorageOptions{StaleGrace: time.Hour})
+	cc := NewClusterClient(tc.router, WithReplicas(1))
+	ctx := context.Background()
+
+	cc.Set(ctx, "key", []byte("old"), 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+
+	loaded := make(chan struct{})
+	entry, err := cc.GetOrLoad(ctx, "key", func(ctx context.Context) ([]byte, time.Duration, error) {
+		defer close(loaded)
+		return []byte("new"), time.Minute, nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad error = %v", err)
+	}
+	if !entry.Stale || string(entry.Value) != "old" {
+		t.Errorf("GetOrLoad = %+v, want the stale value", entry)
+	}
+
+	<-loaded
+	waitForValue(t, tc.direct(tc.router.GetNodes([]byte("key"), 1)[0]), "key", "new")
+}
+
+func TestClusterClient_OverloadedNodeOnlyRead(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	router := rendezvous.NewBoundedLoadRouter(tc.nodes, nil, rendezvous.BoundedLoadConfig{MinLoad: 1, DecayInterval: time.Hour})
+	cc := NewClusterClient(router, WithReplicas(1))
+	ctx := context.Background()
+	prefs := rendezvous.NewRendezvousRouter(tc.nodes, nil).GetNodes([]byte("key"), 2)
+
+	// The key is stored on its preferred node, which then goes over its bound
+	if err := cc.Set(ctx, "key", []byte("old"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		router.RecordRequest(prefs[0])
+	}
+
+	// Reads still find it there
+	if entry, err := cc.Get(ctx, "key"); err != nil || string(entry.Value) != "old" {
+		t.Fatalf("Get = %+v, %v, want the value from the preferred node", entry, err)
+	}
+
+	// Writes go to the next node only
+	if err := cc.Set(ctx, "key", []byte("new"), time.Hour); err != nil {
+		t.Fatalf("Set error = %v", err)
+	}
+	if entry, _ := tc.direct(prefs[0]).Get(ctx, "key"); entry == nil || string(entry.Value) != "old" {
+		t.Errorf("overloaded node entry = %+v, want it not written to", entry)
+	}
+	if entry, err := tc.direct(prefs[1]).Get(ctx, "key"); err != nil || string(entry.Value) != "new" {
+		t.Errorf("next node Get = %+v, %v, want the new value", entry, err)
+	}
+}
+
+func TestClusterClient_RecordsLoad(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	router := rendezvous.NewBoundedLoadRouter(tc.nodes, nil, rendezvous.BoundedLoadConfig{MinLoad: 1})
+	metrics := &recordingMetrics{}
+	cc := NewClusterClient(router, WithReplicas(1), WithClusterMetrics(metrics))
+	ctx := context.Background()
+
+	// Drive one key's traffic; the bound spreads it across nodes
+	cc.Set(ctx, "hot", []byte("value"), time.Minute)
+	served := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		served[router.GetNodes([]byte("hot"), 1)[0].String()] = true
+		cc.Get(ctx, "hot")
+	}
+	if len(served) < 2 {
+		t.Errorf("hot key routed to %d node(s), want the load spread", len(served))
+	}
+
+	// Measurements still reach the cluster metrics hook
+	if len(metrics.requests) == 0 {
+		t.Error("requests should still be reported to the metrics hook")
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/satmihir/justcache/internal/rendezvous"
+)
+
+// Metrics receives measurements from a Client, e.g. to export them to a
+// monitoring system. Implementations must be safe for concurrent use and
+// should return quickly, as they're called on the request path.
+//
+// node is the base URL of the server. op names the request: "get", "post",
+// "put", "delete", "renew", "abandon", "fail", "batch_get", "batch_post" or "batch_put".
+type Metrics interface {
+	// ObserveRequest is called after each HTTP request with the response
+	// status, or 0 and the error if no response was received. The latency
+	// runs until the response headers arrive, and includes long-poll waits.
+	ObserveRequest(node, op string, status int, latency time.Duration, err error)
+	// ObserveRetry is called each time an operation is retried against a
+	// node. op is "get", "set" or "get_or_load".
+	ObserveRetry(node, op string)
+}
+
+// WithMetrics sets the hook that receives request and retry measurements
+func WithMetrics(m Metrics) Option {
+	return func(client *Client) {
+		client.metrics = m
+	}
+}
+
+// do executes the request, reporting it to the metrics hook
+func (c *Client) do(op string, req *http.Request) (*http.Response, error) {
+	if c.metrics == nil {
+		return c.httpClient.Do(req)
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	c.metrics.ObserveRequest(c.baseURL, op, status, time.Since(start), err)
+	return resp, err
+}
+
+// retryObserver returns a function to call at the start of every attempt of
+// a retried operation. It reports all attempts after the first as retries.
+func (c *Client) retryObserver(op string) func() {
+	attempts := 0
+	return func() {
+		attempts++
+		if attempts > 1 && c.metrics != nil {
+			c.metrics.ObserveRetry(c.baseURL, op)
+		}
+	}
+}
+
+// loadMetrics reports every request sent to a node to a load-aware router,
+// passing measurements on to the next hook, if any
+type loadMetrics struct {
+	node     *rendezvous.Node
+	recorder rendezvous.LoadRecorder
+	next     Metrics
+}
+
+func (m *loadMetrics) ObserveRequest(node, op string, status int, latency time.Duration, err error) {
+	m.recorder.RecordRequest(m.node)
+	if m.next != nil {
+		m.next.ObserveRequest(node, op, status, latency, err)
+	}
+}
+
+func (m *loadMetrics) ObserveRetry(node, op string) {
+	if m.next != nil {
+		m.next.ObserveRetry(node, op)
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observedRequest struct {
+	node, op string
+	status   int
+	failed   bool
+}
+
+// recordingMetrics records what it observes
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []observedRequest
+	retries  []string // node + " " + op
+}
+
+func (m *recordingMetrics) ObserveRequest(node, op string, status int, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, observedRequest{node: node, op: op, status: status, failed: err != nil})
+}
+
+func (m *recordingMetrics) ObserveRetry(node, op string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries = append(m.retries, node+" "+op)
+}
+
+func TestMetrics_ObserveRequests(t *testing.T) {
+	cs, ts, _ := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+
+	m := &recordingMetrics{}
+	client := New(ts.URL, WithMetrics(m))
+	ctx := context.Background()
+
+	client.Set(ctx, "key", []byte("value"), time.Minute)
+	client.Get(ctx, "key")
+	client.Get(ctx, "missing")
+	client.GetMulti(ctx, []string{"key"})
+
+	expected := []observedRequest{
+		{ts.URL, "post", http.StatusAccepted, false},
+		{ts.URL, "put", http.StatusOK, false},
+		{ts.URL, "get", http.StatusOK, false},
+		{ts.URL, "get", http.StatusNotFound, false},
+		{ts.URL, "batch_get", http.StatusOK, false},
+	}
+	if len(m.requests) != len(expected) {
+		t.Fatalf("requests = %v, want %v", m.requests, expected)
+	}
+	for i := range expected {
+		if m.requests[i] != expected[i] {
+			t.Errorf("request %d = %+v, want %+v", i, m.requests[i], expected[i])
+		}
+	}
+	if len(m.retries) != 0 {
+		t.Errorf("retries = %v, want none", m.retries)
+	}
+}
+
+func TestMetrics_TransportErrorAndRetries(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	m := &recordingMetrics{}
+	config := fastRetryConfig()
+	config.MaxAttempts = 3
+	client := New(ts.URL, WithMetrics(m), WithRetryConfig(config))
+
+	if _, err := client.GetWithRetry(context.Background(), "key"); err == nil {
+		t.Fatal("GetWithRetry() against a closed server succeeded")
+	}
+
+	if len(m.requests) != 3 {
+		t.Fatalf("requests = %v, want 3", m.requests)
+	}
+	for _, req := range m.requests {
+		if req.status != 0 || !req.failed {
+			t.Errorf("request = %+v, want status 0 and an error", req)
+		}
+	}
+	if len(m.retries) != 2 || m.retries[0] != ts.URL+" get" {
+		t.Errorf("retries = %v, want 2 for %q", m.retries, ts.URL+" get")
+	}
+}
+
+func TestMetrics_ClusterNodes(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	m := &recordingMetrics{}
+	cc := NewClusterClient(tc.router, WithClusterMetrics(m))
+
+	if err := cc.Set(context.Background(), "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// A POST and a PUT to each of the two hosts of the key
+	nodes := make(map[string]int)
+	for _, req := range m.requests {
+		nodes[req.node]++
+	}
+	if len(m.requests) != 4 || len(nodes) != 2 {
+		t.Errorf("requests = %v, want a POST and a PUT on 2 nodes", m.requests)
+	}
+	for _, node := range cc.nodesFor("key") {
+		if nodes[defaultNodeAddr(node)] != 2 {
+			t.Errorf("node %s saw %d requests, want 2", node, nodes[defaultNodeAddr(node)])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+const (
+	// Default near cache budget (16 MB)
+	defaultNearCacheBytes = 16 * 1024 * 1024
+
+	// Default cap on how long the near cache keeps an entry
+	defaultNearCacheMaxTTL = time.Second
+)
+
+// Near cached values are stored behind a header keeping what the server said
+// about the entry, so a near hit reports the server's TTL rather than MaxTTL:
+//
+//	flags (uint8) | server expiry (int64 unix nanos) | value
+const (
+	nearHeaderSize = 1 + 8
+
+	nearFlagSuperhot = 1 << 0
+	nearFlagNegative = 1 << 1
+)
+
+// NearCacheConfig configures the in-process near cache (see WithNearCache)
+type NearCacheConfig struct {
+	// MaxBytes is the memory budget for keys and values.
+	// Default: 16 MB.
+	MaxBytes uint64
+	// MaxTTL caps how long an entry is kept, whatever its remaining TTL on
+	// the server. This bounds how long the near cache can serve a value that
+	// was changed or deleted by another client.
+	// Default: 1 second.
+	MaxTTL time.Duration
+	// EvictionPolicy selects how entries are evicted when the budget is full.
+	// Default: storage.EvictionLRU.
+	EvictionPolicy storage.EvictionPolicyType
+	// Admit decides whether a fetched entry is kept.
+	// Default: keep superhot entries.
+	Admit func(key string, entry *Entry) bool
+}
+
+// WithNearCache keeps entries read from the server in an in-process cache,
+// so repeated reads of hot keys don't cost a network hop. Only entries that
+// the config admits (by default, superhot ones) are kept, for at most their
+// remaining TTL capped at MaxTTL; a near hit reports the server's remaining
+// TTL and superhot flag as of the fetch. Writes and deletes through this
+// client invalidate the key.
+//
+// For a ClusterClient, pass it with WithNodeOptions; each host's client then
+// has its own near cache and budget.
+func WithNearCache(config NearCacheConfig) Option {
+	return func(client *Client) {
+		client.near = newNearCache(config)
+	}
+}
+
+// nearCache is the in-process cache behind WithNearCache.
+// A nil nearCache keeps nothing.
+type nearCache struct {
+	store  *storage.InMemoryStorage
+	maxTTL time.Duration
+	admit  func(key string, entry *Entry) bool
+}
+
+// newNearCache creates a near cache, applying the config defaults
+func newNearCache(config NearCacheConfig) *nearCache {
+	if config.MaxBytes == 0 {
+		config.MaxBytes = defaultNearCacheBytes
+	}
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = defaultNearCacheMaxTTL
+	}
+	if config.Admit == nil {
+		config.Admit = func(key string, entry *Entry) bool { return entry.Superhot }
+	}
+	return &nearCache{
+		store:  storage.NewInMemoryStorage(config.MaxBytes, storage.StorageOptions{EvictionPolicy: config.EvictionPolicy}),
+		maxTTL: config.MaxTTL,
+		admit:  config.Admit,
+	}
+}
+
+// get returns the entry kept for the key, or nil.
+// The Value is shared with other readers and must not be modified.
+func (n *nearCache) get(key string) *Entry {
+	if n == nil {
+		return nil
+	}
+	cached, err := n.store.Get(key)
+	if err != nil || len(cached.Value) < nearHeaderSize {
+		return nil
+	}
+
+	flags := cached.Value[0]
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(cached.Value[1:nearHeaderSize])))
+	remaining := time.Until(expiresAt)
+	if remaining <= 0 {
+		return nil
+	}
+	entry := &Entry{
+		RemainingTTL: remaining,
+		Superhot:     flags&nearFlagSuperhot != 0,
+		Negative:     flags&nearFlagNegative != 0,
+	}
+	if !entry.Negative {
+		entry.Value = cached.Value[nearHeaderSize:]
+		entry.Size = len(entry.Value)
+	}
+	return entry
+}
+
+// add keeps a whole entry fetched from the server if it's admitted.
+// Stale entries and entries without a remaining TTL are never kept.
+func (n *nearCache) add(key string, entry *Entry) {
+	if n == nil || entry.Stale || entry.RemainingTTL <= 0 || !n.admit(key, entry) {
+		return
+	}
+
+	// Partial reads don't hold the whole value
+	if !entry.Negative && len(entry.Value) != entry.Size {
+		return
+	}
+
+	var flags byte
+	if entry.Superhot {
+		flags |= nearFlagSuperhot
+	}
+	if entry.Negative {
+		flags |= nearFlagNegative
+	}
+	value := make([]byte, nearHeaderSize+len(entry.Value))
+	value[0] = flags
+	binary.BigEndian.PutUint64(value[1:], uint64(time.Now().Add(entry.RemainingTTL).UnixNano()))
+	copy(value[nearHeaderSize:], entry.Value)
+	n.store.Put(key, value, min(entry.RemainingTTL, n.maxTTL))
+}
+
+// remove drops the key, e.g. because this client wrote or deleted it
+func (n *nearCache) remove(key string) {
+	if n == nil {
+		return
+	}
+	n.store.Delete(key)
+}
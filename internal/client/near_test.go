@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/remote"
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// admitAll keeps every entry in the near cache
+func admitAll(key string, entry *Entry) bool { return true }
+
+func TestNearCache_ServesLocally(t *testing.T) {
+	cs, ts, other := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL, WithNearCache(NearCacheConfig{MaxTTL: time.Minute, Admit: admitAll}))
+	ctx := context.Background()
+
+	other.Set(ctx, "key", []byte("value"), time.Minute)
+	if _, err := client.Get(ctx, "key"); err != nil {
+		t.Fatalf("Get error = %v", err)
+	}
+
+	// Another client's delete isn't seen until the near entry expires
+	other.Delete(ctx, "key")
+	entry, err := client.Get(ctx, "key")
+	if err != nil || string(entry.Value) != "value" {
+		t.Fatalf("Get = %+v, %v, want the near cached value", entry, err)
+	}
+	if entry.RemainingTTL <= 0 || entry.RemainingTTL > time.Minute {
+		t.Errorf("RemainingTTL = %v, want within the server TTL", entry.RemainingTTL)
+	}
+}
+
+func TestNearCache_InvalidatedByWrites(t *testing.T) {
+	cs, ts, other := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL, WithNearCache(NearCacheConfig{MaxTTL: time.Minute, Admit: admitAll}))
+	ctx := context.Background()
+
+	client.Set(ctx, "key", []byte("old"), time.Minute)
+	client.Get(ctx, "key")
+	client.Delete(ctx, "key")
+	if _, err := client.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+
+	// The near cache still holds the old value after another client's delete
+	client.Set(ctx, "key", []byte("old"), time.Minute)
+	client.Get(ctx, "key")
+	other.Delete(ctx, "key")
+	client.Set(ctx, "key", []byte("new"), time.Minute)
+	if entry, _ := client.Get(ctx, "key"); entry == nil || string(entry.Value) != "new" {
+		t.Errorf("Get after Set = %+v, want the new value", entry)
+	}
+}
+
+func TestNearCache_MaxTTL(t *testing.T) {
+	cs, ts, other := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL, WithNearCache(NearCacheConfig{MaxTTL: 20 * time.Millisecond, Admit: admitAll}))
+	ctx := context.Background()
+
+	other.Set(ctx, "key", []byte("value"), time.Minute)
+	client.Get(ctx, "key")
+	other.Delete(ctx, "key")
+
+	time.Sleep(40 * time.Millisecond)
+	if _, err := client.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after MaxTTL error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNearCache_KeepsServerTTLAndSuperhot(t *testing.T) {
+	near := newNearCache(NearCacheConfig{MaxTTL: 20 * time.Millisecond})
+
+	near.add("key", &Entry{Value: []byte("value"), Size: 5, RemainingTTL: time.Minute, Superhot: true})
+	entry := near.get("key")
+	if entry == nil || string(entry.Value) != "value" || !entry.Superhot {
+		t.Fatalf("near entry = %+v, want the superhot value", entry)
+	}
+	// A write-back from a near hit must not shorten the TTL to MaxTTL
+	if entry.RemainingTTL <= time.Second || entry.RemainingTTL > time.Minute {
+		t.Errorf("RemainingTTL = %v, want the server TTL", entry.RemainingTTL)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if near.get("key") != nil {
+		t.Error("entry should be dropped after MaxTTL")
+	}
+}
+
+func TestNearCache_DefaultAdmitsSuperhot(t *testing.T) {
+	cs := remote.NewCacheServer(":0", storage.NewInMemoryStorage(100000),
+		remote.WithSuperhotConfig(remote.SuperhotConfig{MinHits: 2}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+	other := New(ts.URL)
+	client := New(ts.URL, WithNearCache(NearCacheConfig{MaxTTL: time.Minute}))
+	ctx := context.Background()
+
+	other.Set(ctx, "key", []byte("value"), time.Minute)
+
+	// Read until the server reports the key superhot
+	for i := 0; i < 10; i++ {
+		entry, err := client.Get(ctx, "key")
+		if err != nil {
+			t.Fatalf("Get error = %v", err)
+		}
+		if entry.Superhot {
+			break
+		}
+		if client.near.get("key") != nil {
+			t.Fatal("an entry that isn't superhot should not be near cached")
+		}
+	}
+
+	other.Delete(ctx, "key")
+	if _, err := client.Get(ctx, "key"); err != nil {
+		t.Errorf("Get of a superhot key error = %v, want the near cached value", err)
+	}
+}
+
+func TestNearCache_GetMulti(t *testing.T) {
+	cs, ts, other := newTestServerAndClient()
+	defer ts.Close()
+	defer cs.Stop()
+	client := New(ts.URL, WithNearCache(NearCacheConfig{MaxTTL: time.Minute, Admit: admitAll}))
+	ctx := context.Background()
+
+	other.Set(ctx, "a", []byte("1"), time.Minute)
+	other.Set(ctx, "b", []byte("2"), time.Minute)
+	client.GetMulti(ctx, []string{"a", "b"})
+	other.Delete(ctx, "a")
+
+	entries, err := client.GetMulti(ctx, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("GetMulti error = %v", err)
+	}
+	if len(entries) != 2 || string(entries["a"].Value) != "1" {
+		t.Errorf("GetMulti = %v, want a and b, a from the near cache", entries)
+	}
+}
+
+func TestNearCache_SkipsPartialAndStaleEntries(t *testing.T) {
+	near := newNearCache(NearCacheConfig{Admit: admitAll})
+
+	near.add("range", &Entry{Value: []byte("va"), Size: 5, RemainingTTL: time.Minute})
+	near.add("stale", &Entry{Value: []byte("value"), Size: 5, Stale: true})
+	for _, key := range []string{"range", "stale"} {
+		if near.get(key) != nil {
+			t.Errorf("%s entry should not be near cached", key)
+		}
+	}
+
+	near.add("negative", &Entry{RemainingTTL: time.Minute, Negative: true})
+	if entry := near.get("negative"); entry == nil || !entry.Negative {
+		t.Errorf("negative entry = %+v, want it near cached", entry)
+	}
+}
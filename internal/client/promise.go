@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Values of the x-jc-promise-action header
+const (
+	promiseActionRenew   = "renew"
+	promiseActionAbandon = "abandon"
+	promiseActionFail    = "fail"
+)
+
+// RenewPromise extends the promise this client holds for the key to expire
+// ttl from now (the server default if ttl <= 0), e.g. while a slow origin
+// fetch is still running. Returns the new remaining TTL.
+// Returns ErrNoPromise if the client holds no promise for the key, or the
+// server no longer has it (e.g. it expired).
+func (c *Client) RenewPromise(ctx context.Context, key string, ttl time.Duration) (time.Duration, error) {
+	token := c.promiseToken(key)
+	resp, err := c.promiseAction(ctx, key, token, promiseActionRenew, headerPromiseTTL, ttl)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	remaining := parsePromiseTTL(resp)
+	c.extendPromise(key, token, remaining)
+	return remaining, nil
+}
+
+// AbandonPromise gives up the promise this client holds for the key, e.g.
+// because the origin failed, so clients waiting on it don't have to sit out
+// its TTL. Returns ErrNoPromise if the client holds no promise for the key,
+// or the server no longer has it.
+func (c *Client) AbandonPromise(ctx context.Context, key string) error {
+	token := c.promiseToken(key)
+	resp, err := c.promiseAction(ctx, key, token, promiseActionAbandon, "", 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.forgetPromise(key, token)
+	return nil
+}
+
+// ReportFailure gives up the promise this client holds for the key because
+// the origin failed, and keeps other clients from loading the key for
+// retryAfter (the server default if retryAfter <= 0). Clients waiting on the
+// promise get ErrOriginFailure instead of all retrying the origin.
+// Returns ErrNoPromise if the client holds no promise for the key, or the
+// server no longer has it.
+func (c *Client) ReportFailure(ctx context.Context, key string, retryAfter time.Duration) error {
+	token := c.promiseToken(key)
+	resp, err := c.promiseAction(ctx, key, token, promiseActionFail, headerFailureTTL, retryAfter)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.forgetPromise(key, token)
+	return nil
+}
+
+// promiseAction sends a POST with x-jc-promise-action for the promise with
+// the token, read by the caller before the request, and the TTL in the
+// ttlHeader if ttl > 0.
+// Returns the response on 200; the caller must close its body.
+func (c *Client) promiseAction(ctx context.Context, key, token, action, ttlHeader string, ttl time.Duration) (*http.Response, error) {
+	if token == "" {
+		return nil, ErrNoPromise
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set(headerPromiseAction, action)
+	req.Header.Set(headerPromiseToken, token)
+	if ttl > 0 {
+		req.Header.Set(ttlHeader, strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+
+	resp, err := c.do(action, req)
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusConflict:
+		resp.Body.Close()
+		c.forgetPromise(key, token)
+		return nil, ErrNoPromise
+	case http.StatusBadRequest:
+		resp.Body.Close()
+		return nil, ErrBadRequest
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+// renewWhileLoading renews the promise held for the key every half TTL (the
+// server default if ttl <= 0) until the returned function is called, so it
+// doesn't expire while the value is being loaded. Renewal stops early if the
+// promise is lost.
+func (c *Client) renewWhileLoading(ctx context.Context, key string, ttl time.Duration) (stop func()) {
+	if ttl <= 0 {
+		ttl = defaultPromiseTTL
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := c.RenewPromise(ctx, key, ttl); errors.Is(err, ErrNoPromise) {
+					return
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// giveUpPromise gives up the promise held for the key after the loader failed.
+// A canceled load says nothing about the origin, so the promise is just
+// abandoned; otherwise the failure is reported. It's best-effort and runs even
+// if ctx is done.
+func (c *Client) giveUpPromise(ctx context.Context, key string) {
+	if ctx.Err() != nil {
+		c.AbandonPromise(context.WithoutCancel(ctx), key)
+		return
+	}
+	c.ReportFailure(ctx, key, c.failureTTL)
+}
@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/satmihir/justcache/internal/batch"
+	"github.com/satmihir/justcache/internal/constants"
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// Path prefix for batch operations
+const batchPathPrefix = "/batch/"
+
+// handleBatch routes POST /batch/{get,post,put}.
+// The request and response bodies are batch messages with one item per key,
+// and each response item carries its own status code.
+func (s *CacheServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var handle func(item batch.Item) batch.Item
+	switch r.URL.Path {
+	case batchPathPrefix + "get":
+		handle = s.batchGet
+	case batchPathPrefix + "post":
+		handle = s.batchPost
+	case batchPathPrefix + "put":
+		handle = s.batchPut
+	default:
+		http.Error(w, "invalid path: must be /batch/get, /batch/post or /batch/put", http.StatusNotFound)
+		return
+	}
+
+	items, err := batch.Decode(http.MaxBytesReader(w, r.Body, batch.MaxMessageBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || errors.Is(err, batch.ErrTooManyItems) || errors.Is(err, batch.ErrTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batch.Item, len(items))
+	valueBytes := 0
+	for i, item := range items {
+		if len(item.Key) == 0 || len(item.Key) > constants.MaxKeySizeBytes {
+			results[i] = batch.Item{Key: item.Key, Status: http.StatusBadRequest}
+			continue
+		}
+		results[i] = handle(item)
+
+		// The response holds at most MaxValueBytes of values; hits that don't
+		// fit are left for the client to GET on their own
+		if valueBytes+len(results[i].Value) > batch.MaxValueBytes {
+			results[i] = batch.Item{Key: item.Key, Status: http.StatusRequestEntityTooLarge, Size: results[i].Size}
+			continue
+		}
+		valueBytes += len(results[i].Value)
+	}
+
+	w.Header().Set("Content-Type", batch.ContentType)
+	w.WriteHeader(http.StatusOK)
+	batch.Encode(w, results)
+}
+
+// batchGet reads one key, as GET does.
+// Status: 200 with the value, 404 on a miss.
+func (s *CacheServer) batchGet(item batch.Item) batch.Item {
+	entry, err := s.storage.Get(item.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			out := batch.Item{Key: item.Key, Status: http.StatusNotFound}
+			if failureTTL := s.promises.FailureTTL(item.Key); failureTTL > 0 {
+				out.OriginFailed = true
+				out.TTL = failureTTL
+			}
+			return out
+		}
+		return batch.Item{Key: item.Key, Status: http.StatusInternalServerError}
+	}
+
+	return batch.Item{
+		Key:      item.Key,
+		Status:   http.StatusOK,
+		Superhot: s.hotKeys.Record(item.Key),
+		Negative: entry.Negative,
+		Stale:    entry.Stale,
+		TTL:      entry.RemainingTTL,
+		Size:     int64(entry.Size),
+		Value:    entry.Value,
+	}
+}
+
+// batchPost requests a promise for one key, as POST does. The item's Size is
+// the expected value size (-1 if unknown) and its TTL the promise TTL (0 for
+// the default).
+// Status: 200 if the key exists, 202 with a token, 409, 507 or 503.
+func (s *CacheServer) batchPost(item batch.Item) batch.Item {
+	promiseTTL := item.TTL
+	if promiseTTL == 0 {
+		promiseTTL = defaultPromiseTTL
+	}
+	if promiseTTL < 0 || item.Size < -1 {
+		return batch.Item{Key: item.Key, Status: http.StatusBadRequest}
+	}
+
+	result, err := s.requestPromise(item.Key, item.Size, promiseTTL, false)
+	if err != nil {
+		return batch.Item{Key: item.Key, Status: http.StatusInternalServerError}
+	}
+
+	out := batch.Item{Key: item.Key, Status: result.status, Size: -1}
+	switch result.status {
+	case http.StatusOK:
+		out.Superhot = s.hotKeys.IsHot(item.Key)
+		out.Negative = result.entry.Negative
+		out.TTL = result.entry.RemainingTTL
+		out.Size = int64(result.entry.Size)
+	case http.StatusAccepted, http.StatusConflict:
+		out.TTL = result.promiseTTL
+		out.Token = result.token
+		if result.failureTTL > 0 {
+			out.OriginFailed = true
+			out.TTL = result.failureTTL
+		}
+	}
+	return out
+}
+
+// batchPut uploads one value under a promise, as PUT does. The item's Token
+// must be the one granted by /batch/post or POST, and its TTL is the value TTL
+// (0 for the default). A Negative item stores a negative entry; its Value must
+// be empty.
+// Status: 200, 400, 409, 413 or 507.
+func (s *CacheServer) batchPut(item batch.Item) batch.Item {
+	out := batch.Item{Key: item.Key, Size: -1}
+
+	promise := s.promises.Get(item.Key)
+	if promise == nil || !promise.OwnedBy(item.Token) {
+		out.Status = http.StatusConflict
+		return out
+	}
+
+	if item.Negative && len(item.Value) != 0 {
+		out.Status = http.StatusBadRequest
+		return out
+	}
+
+	// Check size matches if promise specified a size
+	if !item.Negative && promise.Size >= 0 && int64(len(item.Value)) != promise.Size {
+		// Terminal error: size mismatch - release promise for other writers
+		s.promises.Release(item.Key, item.Token)
+		out.Status = http.StatusConflict
+		return out
+	}
+
+	ttl := item.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+		if item.Negative {
+			ttl = defaultNegativeTTL
+		}
+	}
+	if ttl < 0 {
+		// Transient error: invalid TTL can be fixed by client
+		out.Status = http.StatusBadRequest
+		return out
+	}
+
+	var err error
+	if item.Negative {
+		err = s.storage.PutNegative(item.Key, ttl)
+	} else {
+		err = s.storage.Put(item.Key, item.Value, ttl)
+	}
+	if err != nil {
+		status, terminal := storeErrorStatus(err)
+		if terminal {
+			s.promises.Release(item.Key, item.Token)
+		}
+		out.Status = status
+		return out
+	}
+
+	s.promises.Complete(item.Key, item.Token)
+	out.Status = http.StatusOK
+	return out
+}
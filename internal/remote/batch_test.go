@@ -0,0 +1,209 @@
+package remote
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/batch"
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+func doBatch(t *testing.T, ts *httptest.Server, op string, items []batch.Item) []batch.Item {
+	t.Helper()
+	var body bytes.Buffer
+	if err := batch.Encode(&body, items); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	resp, err := http.Post(ts.URL+"/batch/"+op, batch.ContentType, &body)
+	if err != nil {
+		t.Fatalf("POST /batch/%s failed: %v", op, err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	results, err := batch.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("got %d results, want %d", len(results), len(items))
+	}
+	return results
+}
+
+func assertItemStatus(t *testing.T, item batch.Item, expected int) {
+	t.Helper()
+	if item.Status != expected {
+		t.Errorf("key %q status = %d, want %d", item.Key, item.Status, expected)
+	}
+}
+
+func TestBatchGet(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("hit", []byte("value"), time.Hour)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	results := doBatch(t, ts, "get", []batch.Item{{Key: "hit"}, {Key: "miss"}, {Key: ""}})
+
+	assertItemStatus(t, results[0], http.StatusOK)
+	if string(results[0].Value) != "value" {
+		t.Errorf("value = %q, want %q", results[0].Value, "value")
+	}
+	if results[0].Size != 5 || results[0].TTL <= 0 {
+		t.Errorf("metadata = size %d ttl %v, want size 5 and positive ttl", results[0].Size, results[0].TTL)
+	}
+	assertItemStatus(t, results[1], http.StatusNotFound)
+	assertItemStatus(t, results[2], http.StatusBadRequest)
+}
+
+func TestBatchPostAndPut(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("exists", []byte("value"), time.Hour)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	// Another client holds a promise on one key
+	held := doPost(t, ts, "held")
+	held.Body.Close()
+
+	results := doBatch(t, ts, "post", []batch.Item{
+		{Key: "new", Size: 3},
+		{Key: "exists", Size: -1},
+		{Key: "held", Size: -1},
+		{Key: "huge", Size: 5000},
+	})
+	assertItemStatus(t, results[0], http.StatusAccepted)
+	if results[0].Token == "" {
+		t.Error("202 should carry a promise token")
+	}
+	assertItemStatus(t, results[1], http.StatusOK)
+	assertItemStatus(t, results[2], http.StatusConflict)
+	if results[2].TTL <= 0 {
+		t.Error("409 should carry the remaining promise TTL")
+	}
+	assertItemStatus(t, results[3], http.StatusInsufficientStorage)
+
+	results = doBatch(t, ts, "put", []batch.Item{
+		{Key: "new", Token: results[0].Token, Value: []byte("abc")},
+		{Key: "held", Token: "wrong", Value: []byte("abc")},
+	})
+	assertItemStatus(t, results[0], http.StatusOK)
+	assertItemStatus(t, results[1], http.StatusConflict)
+
+	resp := doGet(t, ts, "new")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "abc" {
+		t.Errorf("body = %q, want %q", body, "abc")
+	}
+}
+
+func TestBatchPut_SizeMismatchReleasesPromise(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	results := doBatch(t, ts, "post", []batch.Item{{Key: "key", Size: 3}})
+	results = doBatch(t, ts, "put", []batch.Item{{Key: "key", Token: results[0].Token, Value: []byte("toolong")}})
+	assertItemStatus(t, results[0], http.StatusConflict)
+
+	if cs.promises.Exists("key") {
+		t.Error("size mismatch should release the promise")
+	}
+}
+
+func TestBatch_OriginFailure(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	token, _ := cs.promises.CreateWithToken("failed", -1, time.Minute)
+	cs.promises.Fail("failed", token, time.Minute)
+
+	results := doBatch(t, ts, "post", []batch.Item{{Key: "failed", Size: -1}, {Key: "other", Size: -1}})
+	assertItemStatus(t, results[0], http.StatusConflict)
+	if !results[0].OriginFailed || results[0].TTL <= 0 {
+		t.Errorf("409 = %+v, want the origin failure and its TTL", results[0])
+	}
+	if results[1].OriginFailed {
+		t.Error("other keys should not carry the origin failure")
+	}
+
+	results = doBatch(t, ts, "get", []batch.Item{{Key: "failed"}})
+	assertItemStatus(t, results[0], http.StatusNotFound)
+	if !results[0].OriginFailed {
+		t.Error("404 should carry the origin failure")
+	}
+}
+
+func TestBatch_NegativeEntries(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	results := doBatch(t, ts, "post", []batch.Item{{Key: "neg", Size: 3}, {Key: "bad", Size: -1}})
+	results = doBatch(t, ts, "put", []batch.Item{
+		{Key: "neg", Token: results[0].Token, Negative: true},
+		{Key: "bad", Token: results[1].Token, Negative: true, Value: []byte("abc")},
+	})
+	assertItemStatus(t, results[0], http.StatusOK)
+	assertItemStatus(t, results[1], http.StatusBadRequest)
+
+	results = doBatch(t, ts, "get", []batch.Item{{Key: "neg"}})
+	assertItemStatus(t, results[0], http.StatusOK)
+	if !results[0].Negative || len(results[0].Value) != 0 {
+		t.Errorf("get = %+v, want a negative entry", results[0])
+	}
+
+	results = doBatch(t, ts, "post", []batch.Item{{Key: "neg", Size: -1}})
+	assertItemStatus(t, results[0], http.StatusOK)
+	if !results[0].Negative {
+		t.Error("post of a negative entry should report it")
+	}
+}
+
+func TestBatch_InvalidRequests(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/batch/get", batch.ContentType, bytes.NewReader([]byte{0xff}))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	resp, err = http.Post(ts.URL+"/batch/unknown", batch.ContentType, nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+
+	resp, err = http.Get(ts.URL + "/batch/get")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusMethodNotAllowed)
+}
+
+func TestBatchGet_Stale(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000, storage.StorageOptions{StaleGrace: time.Hour})
+	store.Put("stale", []byte("value"), 10*time.Millisecond)
+	store.Put("fresh", []byte("value"), time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	results := doBatch(t, ts, "get", []batch.Item{{Key: "stale"}, {Key: "fresh"}})
+	assertItemStatus(t, results[0], http.StatusOK)
+	if !results[0].Stale || results[0].TTL != 0 || string(results[0].Value) != "value" {
+		t.Errorf("stale item = %+v, want stale value with zero TTL", results[0])
+	}
+	if results[1].Stale {
+		t.Error("fresh item should not be stale")
+	}
+}
@@ -0,0 +1,251 @@
+package remote
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// Default number of keys tracked for superhot detection
+	defaultSuperhotCapacity = 1024
+	// Default GETs within the decay window for a key to be superhot
+	defaultSuperhotMinHits = 1000
+	// Default interval after which all access counts are halved
+	defaultSuperhotDecayInterval = 10 * time.Second
+)
+
+// SuperhotConfig configures superhot key detection
+type SuperhotConfig struct {
+	// Capacity is the number of keys tracked by the heavy-hitters structure.
+	// Only the most frequently accessed keys can be superhot.
+	// Default: 1024
+	Capacity int
+	// MinHits is the guaranteed number of GETs (after decay) for a key to be superhot.
+	// Default: 1000
+	MinHits uint64
+	// DecayInterval is how often all access counts are halved, so that keys
+	// stop being superhot once their traffic drops.
+	// Default: 10s
+	DecayInterval time.Duration
+}
+
+// DefaultSuperhotConfig returns a SuperhotConfig with sensible defaults
+func DefaultSuperhotConfig() SuperhotConfig {
+	return SuperhotConfig{
+		Capacity:      defaultSuperhotCapacity,
+		MinHits:       defaultSuperhotMinHits,
+		DecayInterval: defaultSuperhotDecayInterval,
+	}
+}
+
+// hotCounter is a Space-Saving counter for one key
+type hotCounter struct {
+	key   string
+	count uint64 // estimated accesses (never under-counts)
+	err   uint64 // maximum over-count inherited from the replaced key
+	index int    // position in the heap
+}
+
+// guaranteed returns the number of accesses the key is known to have had
+func (c *hotCounter) guaranteed() uint64 {
+	return c.count - c.err
+}
+
+// hotHeap is a min-heap of counters ordered by count
+type hotHeap []*hotCounter
+
+func (h hotHeap) Len() int           { return len(h) }
+func (h hotHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hotHeap) Push(x any) {
+	c := x.(*hotCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *hotHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
+
+// HotKeyTracker detects superhot keys using the Space-Saving heavy-hitters
+// algorithm (Metwally et al.) with periodic exponential decay.
+//
+// It tracks at most Capacity keys. When a new key arrives and the tracker is
+// full, it replaces the least counted key and inherits its count as error, so
+// counts never under-estimate and the guaranteed count (count - error) never
+// over-estimates.
+//
+// Keys are hashed into shards that each track their share of Capacity under
+// their own lock, so concurrent GETs of different keys rarely contend.
+type HotKeyTracker struct {
+	config SuperhotConfig
+	shards []*hotKeyShard
+}
+
+// hotKeyShard is the Space-Saving state for the keys hashed to one shard
+type hotKeyShard struct {
+	mu        sync.Mutex
+	capacity  int
+	minHits   uint64
+	decay     time.Duration
+	counters  map[string]*hotCounter
+	heap      hotHeap
+	lastDecay time.Time
+}
+
+const (
+	// Maximum number of shards in a HotKeyTracker
+	maxHotKeyShards = 16
+	// Minimum number of keys tracked per shard, so that small trackers
+	// aren't split into shards too small to find heavy hitters
+	minHotKeysPerShard = 64
+)
+
+// NewHotKeyTracker creates a HotKeyTracker, applying defaults for zero config values
+func NewHotKeyTracker(config SuperhotConfig) *HotKeyTracker {
+	defaults := DefaultSuperhotConfig()
+	if config.Capacity <= 0 {
+		config.Capacity = defaults.Capacity
+	}
+	if config.MinHits == 0 {
+		config.MinHits = defaults.MinHits
+	}
+	if config.DecayInterval <= 0 {
+		config.DecayInterval = defaults.DecayInterval
+	}
+
+	// Split the capacity evenly; the first (Capacity % numShards) shards take
+	// one extra key so the shard capacities add up to Capacity exactly.
+	numShards := max(1, min(maxHotKeyShards, config.Capacity/minHotKeysPerShard))
+	t := &HotKeyTracker{
+		config: config,
+		shards: make([]*hotKeyShard, numShards),
+	}
+	now := time.Now()
+	for i := range t.shards {
+		capacity := config.Capacity / numShards
+		if i < config.Capacity%numShards {
+			capacity++
+		}
+		t.shards[i] = &hotKeyShard{
+			capacity:  capacity,
+			minHits:   config.MinHits,
+			decay:     config.DecayInterval,
+			counters:  make(map[string]*hotCounter, capacity),
+			heap:      make(hotHeap, 0, capacity),
+			lastDecay: now,
+		}
+	}
+	return t
+}
+
+// Record counts an access to the key and reports whether it is superhot
+func (t *HotKeyTracker) Record(key string) bool {
+	return t.recordAt(key, time.Now())
+}
+
+// IsHot reports whether the key is superhot without counting an access
+func (t *HotKeyTracker) IsHot(key string) bool {
+	shard := t.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.decayUnlocked(time.Now())
+	c, ok := shard.counters[key]
+	return ok && c.guaranteed() >= shard.minHits
+}
+
+// recordAt is Record with an explicit clock for testing
+func (t *HotKeyTracker) recordAt(key string, now time.Time) bool {
+	shard := t.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.decayUnlocked(now)
+
+	c, ok := shard.counters[key]
+	switch {
+	case ok:
+		c.count++
+		heap.Fix(&shard.heap, c.index)
+	case len(shard.heap) < shard.capacity:
+		c = &hotCounter{key: key, count: 1}
+		shard.counters[key] = c
+		heap.Push(&shard.heap, c)
+	default:
+		// Replace the least counted key; its count becomes our error bound
+		c = shard.heap[0]
+		delete(shard.counters, c.key)
+		c.key = key
+		c.err = c.count
+		c.count++
+		shard.counters[key] = c
+		heap.Fix(&shard.heap, 0)
+	}
+
+	return c.guaranteed() >= shard.minHits
+}
+
+// shardFor returns the shard that tracks the key
+func (t *HotKeyTracker) shardFor(key string) *hotKeyShard {
+	if len(t.shards) == 1 {
+		return t.shards[0]
+	}
+	return t.shards[xxh3.HashString(key)%uint64(len(t.shards))]
+}
+
+// decayUnlocked halves all counts once per elapsed decay interval.
+// Lock must be held by caller.
+func (t *hotKeyShard) decayUnlocked(now time.Time) {
+	elapsed := now.Sub(t.lastDecay)
+	if elapsed < t.decay {
+		return
+	}
+
+	intervals := int64(elapsed / t.decay)
+	t.lastDecay = t.lastDecay.Add(time.Duration(intervals) * t.decay)
+
+	shift := uint(min(intervals, 63))
+	kept := t.heap[:0]
+	for _, c := range t.heap {
+		c.count >>= shift
+		c.err >>= shift
+		if c.count == 0 {
+			delete(t.counters, c.key)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	for i := len(kept); i < len(t.heap); i++ {
+		t.heap[i] = nil
+	}
+	t.heap = kept
+	for i, c := range t.heap {
+		c.index = i
+	}
+	heap.Init(&t.heap)
+}
+
+// Len returns the number of tracked keys.
+// Primarily for testing purposes.
+func (t *HotKeyTracker) Len() int {
+	n := 0
+	for _, shard := range t.shards {
+		shard.mu.Lock()
+		n += len(shard.heap)
+		shard.mu.Unlock()
+	}
+	return n
+}
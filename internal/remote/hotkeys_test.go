@@ -0,0 +1,160 @@
+package remote
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHotKeyTracker_Defaults(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{})
+
+	if tracker.config != DefaultSuperhotConfig() {
+		t.Errorf("config = %+v, want %+v", tracker.config, DefaultSuperhotConfig())
+	}
+}
+
+func TestHotKeyTracker_BecomesHotAtThreshold(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{MinHits: 5, DecayInterval: time.Hour})
+
+	for i := 1; i < 5; i++ {
+		if tracker.Record("key") {
+			t.Fatalf("key superhot after %d hits, want threshold 5", i)
+		}
+	}
+	if !tracker.Record("key") {
+		t.Error("key should be superhot after 5 hits")
+	}
+	if !tracker.IsHot("key") {
+		t.Error("IsHot should report the key as superhot")
+	}
+	if tracker.IsHot("other") {
+		t.Error("untracked key should not be superhot")
+	}
+}
+
+func TestHotKeyTracker_IsHotDoesNotCount(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{MinHits: 2, DecayInterval: time.Hour})
+
+	tracker.Record("key")
+	for i := 0; i < 10; i++ {
+		tracker.IsHot("key")
+	}
+	if tracker.IsHot("key") {
+		t.Error("IsHot should not count accesses")
+	}
+}
+
+func TestHotKeyTracker_BoundedCapacity(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{Capacity: 10, MinHits: 100, DecayInterval: time.Hour})
+
+	for i := 0; i < 1000; i++ {
+		tracker.Record(fmt.Sprintf("key-%d", i))
+	}
+	if tracker.Len() != 10 {
+		t.Errorf("Len() = %d, want 10", tracker.Len())
+	}
+}
+
+func TestHotKeyTracker_ReplacedKeysInheritError(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{Capacity: 2, MinHits: 3, DecayInterval: time.Hour})
+
+	tracker.Record("a")
+	tracker.Record("a")
+	tracker.Record("b")
+	tracker.Record("b")
+
+	// c replaces a counter with count 2: estimated count 3, guaranteed 1
+	if tracker.Record("c") {
+		t.Error("a key replacing another should not be superhot from inherited counts")
+	}
+}
+
+func TestHotKeyTracker_HeavyHitterSurvivesNoise(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{Capacity: 16, MinHits: 500, DecayInterval: time.Hour})
+
+	hot := false
+	for i := 0; i < 10000; i++ {
+		if i%10 == 0 {
+			hot = tracker.Record("hot")
+		} else {
+			tracker.Record(fmt.Sprintf("noise-%d", i))
+		}
+	}
+	if !hot {
+		t.Error("key with 10% of traffic should be superhot")
+	}
+}
+
+func TestHotKeyTracker_Decay(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{MinHits: 4, DecayInterval: time.Second})
+	start := tracker.shards[0].lastDecay
+
+	for i := 0; i < 8; i++ {
+		tracker.recordAt("key", start)
+	}
+
+	// One interval halves the count to 4; the next access makes it 5
+	if !tracker.recordAt("key", start.Add(time.Second)) {
+		t.Error("key should still be superhot after one decay")
+	}
+
+	// Three more intervals: 5 >> 3 = 0, the key is forgotten
+	if tracker.recordAt("key", start.Add(4*time.Second)) {
+		t.Error("key should not be superhot after its traffic decayed")
+	}
+	if tracker.Len() != 1 {
+		t.Errorf("Len() = %d, want 1 (only the re-recorded key)", tracker.Len())
+	}
+}
+
+func TestHotKeyTracker_ConcurrentAccess(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{Capacity: 8})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				tracker.Record(fmt.Sprintf("key-%d", (id*j)%50))
+				tracker.IsHot("key-0")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if tracker.Len() > 8 {
+		t.Errorf("Len() = %d, exceeds capacity", tracker.Len())
+	}
+}
+
+func TestHotKeyTracker_Sharded(t *testing.T) {
+	tracker := NewHotKeyTracker(SuperhotConfig{Capacity: 1000, MinHits: 100, DecayInterval: time.Hour})
+	if len(tracker.shards) < 2 {
+		t.Fatalf("shards = %d, want the default capacity split into shards", len(tracker.shards))
+	}
+
+	capacity := 0
+	for _, shard := range tracker.shards {
+		capacity += shard.capacity
+	}
+	if capacity != 1000 {
+		t.Errorf("sum of shard capacities = %d, want 1000", capacity)
+	}
+
+	now := time.Now()
+	for i := 0; i < 5000; i++ {
+		tracker.recordAt(fmt.Sprintf("noise-%d", i), now)
+		if i%10 == 0 {
+			tracker.recordAt("hot", now)
+		}
+	}
+	if !tracker.IsHot("hot") {
+		t.Error("heavy hitter should be superhot across shards")
+	}
+	if tracker.Len() > 1000 {
+		t.Errorf("Len() = %d, exceeds capacity", tracker.Len())
+	}
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPConfig configures the HTTP server of a CacheServer
+type HTTPConfig struct {
+	// ReadHeaderTimeout bounds reading the request headers, so slow clients
+	// can't hold connections open by trickling them
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the time from the end of the request headers to the
+	// end of the response. It must leave room for long-polled GETs.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long a keep-alive connection waits for the next request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of the request headers, URL included
+	MaxHeaderBytes int
+}
+
+// DefaultHTTPConfig returns an HTTPConfig with sensible defaults
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      maxWait + 30*time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 * 1024,
+	}
+}
+
+// WithHTTPConfig sets the timeouts and limits of the HTTP server
+func WithHTTPConfig(config HTTPConfig) ServerOption {
+	return func(s *CacheServer) {
+		s.httpConfig = config
+	}
+}
+
+// newHTTPServer creates the HTTP server serving the instrumented handler
+func (s *CacheServer) newHTTPServer() *http.Server {
+	return &http.Server{
+		Addr:              s.addr,
+		Handler:           s.handler,
+		ReadHeaderTimeout: s.httpConfig.ReadHeaderTimeout,
+		ReadTimeout:       s.httpConfig.ReadTimeout,
+		WriteTimeout:      s.httpConfig.WriteTimeout,
+		IdleTimeout:       s.httpConfig.IdleTimeout,
+		MaxHeaderBytes:    s.httpConfig.MaxHeaderBytes,
+	}
+}
+
+// Start starts the CacheServer on its address, first loading the snapshot if
+// one was saved. It blocks until the server fails or is shut down, and
+// returns nil after Shutdown.
+func (s *CacheServer) Start() error {
+	if err := s.RestoreSnapshot(); err != nil {
+		return err
+	}
+	return serveErr(s.httpServer.ListenAndServe())
+}
+
+// Serve is like Start but accepts connections on an existing listener,
+// e.g. one inherited from a parent process. The listener is closed on return.
+func (s *CacheServer) Serve(listener net.Listener) error {
+	if err := s.RestoreSnapshot(); err != nil {
+		listener.Close()
+		return err
+	}
+	return serveErr(s.httpServer.Serve(listener))
+}
+
+// Shutdown stops the server gracefully. It stops accepting connections,
+// refuses new promises with 503, wakes long-polling GETs, and waits for
+// in-flight requests (such as uploads under existing promises) to finish or
+// for ctx to be done. Then it stops the server as Stop does and saves the
+// snapshot if configured.
+// Returns the first error of draining or saving the snapshot.
+func (s *CacheServer) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	s.cancelShutdown()
+
+	err := s.httpServer.Shutdown(ctx)
+	s.Stop()
+	if saveErr := s.SaveSnapshot(); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// waitContext returns the context a request may block on: it is canceled
+// when the client goes away or the server shuts down. The caller must call
+// the returned function when done waiting.
+func (s *CacheServer) waitContext(r *http.Request) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(s.shutdown, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// serveErr hides the error http.Server returns after a graceful shutdown
+func serveErr(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// startTestServer serves cs on a local listener through Serve
+func startTestServer(t *testing.T, cs *CacheServer) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- cs.Serve(listener) }()
+	return "http://" + listener.Addr().String(), served
+}
+
+func TestServe_ExistingListener(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024))
+	url, served := startTestServer(t, cs)
+
+	resp, err := http.Get(url + "/cache/missing")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve() after Shutdown = %v, want nil", err)
+	}
+}
+
+func TestShutdown_DrainsInFlightUpload(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024*1024))
+	url, served := startTestServer(t, cs)
+
+	post, _ := http.NewRequest(http.MethodPost, url+"/cache/key", nil)
+	resp, err := http.DefaultClient.Do(post)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	// Start an upload whose body arrives only after Shutdown has begun
+	body, writer := net.Pipe()
+	defer body.Close()
+	put, _ := http.NewRequest(http.MethodPut, url+"/cache/key", body)
+	put.ContentLength = 5
+	put.Header.Set(headerPromiseToken, token)
+	putDone := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(put)
+		if err != nil {
+			putDone <- 0
+			return
+		}
+		resp.Body.Close()
+		putDone <- resp.StatusCode
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- cs.Shutdown(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown() returned before the in-flight upload finished")
+	default:
+	}
+
+	writer.Write([]byte("value"))
+	writer.Close()
+
+	if status := <-putDone; status != http.StatusOK {
+		t.Errorf("in-flight PUT status = %d, want 200", status)
+	}
+	if err := <-shutdownDone; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	<-served
+
+	if entry, err := cs.storage.Get("key"); err != nil || !bytes.Equal(entry.Value, []byte("value")) {
+		t.Errorf("drained upload not stored: %v", err)
+	}
+}
+
+func TestShutdown_RefusesNewPromises(t *testing.T) {
+	cs, ts := newTestServer(1024)
+	defer ts.Close()
+
+	assertStatus(t, doPostAndPut(t, ts, "existing", []byte("value")), http.StatusOK)
+	cs.Shutdown(context.Background())
+
+	resp := doPost(t, ts, "key")
+	assertStatus(t, resp, http.StatusServiceUnavailable)
+	assertHeader(t, resp, headerRetryAfter, "1")
+
+	// Existing keys are still reported
+	assertStatus(t, doPost(t, ts, "existing"), http.StatusOK)
+}
+
+func TestShutdown_WakesLongPolls(t *testing.T) {
+	cs, ts := newTestServer(1024)
+	defer ts.Close()
+
+	assertStatus(t, doPost(t, ts, "key"), http.StatusAccepted)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cache/key", nil)
+	req.Header.Set(headerWait, strconv.Itoa(int(maxWait.Milliseconds())))
+	start := time.Now()
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			done <- nil
+			return
+		}
+		done <- resp
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cs.Shutdown(context.Background())
+
+	select {
+	case resp := <-done:
+		if resp == nil {
+			t.Fatal("long-poll GET failed")
+		}
+		resp.Body.Close()
+		assertStatus(t, resp, http.StatusNotFound)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("long-poll woke after %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll GET not woken by Shutdown")
+	}
+}
+
+func TestDefaultHTTPConfig_LeavesRoomForLongPoll(t *testing.T) {
+	config := DefaultHTTPConfig()
+	if config.WriteTimeout <= maxWait {
+		t.Errorf("WriteTimeout = %v, must exceed maxWait %v", config.WriteTimeout, maxWait)
+	}
+
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024), WithHTTPConfig(HTTPConfig{ReadHeaderTimeout: time.Second, MaxHeaderBytes: 4096}))
+	defer cs.Stop()
+	if cs.httpServer.ReadHeaderTimeout != time.Second || cs.httpServer.MaxHeaderBytes != 4096 {
+		t.Errorf("http.Server not configured from HTTPConfig: %+v", cs.httpServer)
+	}
+}
@@ -0,0 +1,244 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// Path serving the metrics in the Prometheus text exposition format
+const metricsPath = "/metrics"
+
+// Upper bounds in seconds of the request latency buckets. Long-polled GETs
+// can take up to maxWait.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// requestKey identifies a series of the request metrics
+type requestKey struct {
+	method string
+	route  string
+	code   int
+}
+
+// latencyHistogram counts request latencies. counts are per bucket, not
+// cumulative; the last one is for latencies above every bound.
+type latencyHistogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// requestMetrics counts requests by method, route and status code
+type requestMetrics struct {
+	mu        sync.Mutex
+	latencies map[requestKey]*latencyHistogram
+}
+
+func newRequestMetrics() *requestMetrics {
+	return &requestMetrics{latencies: make(map[requestKey]*latencyHistogram)}
+}
+
+// observe records a request
+func (m *requestMetrics) observe(method, route string, code int, latency time.Duration) {
+	key := requestKey{method: methodLabel(method), route: route, code: code}
+	seconds := latency.Seconds()
+	bucket := sort.SearchFloat64s(latencyBuckets, seconds)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.latencies[key]
+	if !ok {
+		h = &latencyHistogram{counts: make([]uint64, len(latencyBuckets)+1)}
+		m.latencies[key] = h
+	}
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+}
+
+// instrument wraps the handler to record every request in s.requests
+func (s *CacheServer) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		s.requests.observe(r.Method, routeLabel(r.URL.Path), recorder.status, time.Since(start))
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+		r.wrote = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wrote = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// methodLabel bounds the method label to the methods the server handles
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodHead:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// routeLabel maps a path to the route serving it, so keys don't become labels
+func routeLabel(path string) string {
+	switch {
+	case strings.HasPrefix(path, cachePathPrefix):
+		return "cache"
+	case strings.HasPrefix(path, batchPathPrefix):
+		return "batch"
+	case path == statsPath || path == metricsPath:
+		return "admin"
+	default:
+		return "other"
+	}
+}
+
+// handleMetrics serves GET /metrics
+func (s *CacheServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	s.writeMetrics(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeMetrics writes all metrics in the Prometheus text format
+func (s *CacheServer) writeMetrics(buf *bytes.Buffer) {
+	s.requests.write(buf)
+
+	stats := s.Stats()
+	if stats.Storage != nil {
+		writeStorageMetrics(buf, stats.Storage)
+	}
+
+	p := stats.Promises
+	writeMetric(buf, "justcache_promises_active", "gauge", "Promises held, including expired ones not yet cleaned up.", uint64(p.Active))
+	writeMetric(buf, "justcache_promises_created_total", "counter", "Promises granted.", p.Created)
+	writeMetric(buf, "justcache_promises_fulfilled_total", "counter", "Promises removed after a successful upload.", p.Fulfilled)
+	writeMetric(buf, "justcache_promises_released_total", "counter", "Promises given up after a failed upload or abandoned.", p.Released)
+	writeMetric(buf, "justcache_promises_renewed_total", "counter", "Promise renewals.", p.Renewed)
+	writeMetric(buf, "justcache_promises_failed_total", "counter", "Promises given up because the origin failed.", p.Failed)
+	writeMetric(buf, "justcache_promises_expired_total", "counter", "Promises removed after their TTL ran out.", p.Expired)
+	writeMetric(buf, "justcache_promises_conflicts_total", "counter", "Promise requests rejected because another was in flight or the origin recently failed.", p.Conflicts)
+}
+
+// write writes the request counters and latency histograms, in a stable order
+func (m *requestMetrics) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.latencies))
+	histograms := make(map[requestKey]latencyHistogram, len(m.latencies))
+	for key, h := range m.latencies {
+		keys = append(keys, key)
+		histograms[key] = latencyHistogram{counts: append([]uint64(nil), h.counts...), sum: h.sum, count: h.count}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	writeHeader(buf, "justcache_http_requests_total", "counter", "HTTP requests by method, route and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(buf, "justcache_http_requests_total{%s} %d\n", key.labels(), histograms[key].count)
+	}
+
+	writeHeader(buf, "justcache_http_request_duration_seconds", "histogram", "HTTP request latency by method, route and status code.")
+	for _, key := range keys {
+		h := histograms[key]
+		labels := key.labels()
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "justcache_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(buf, "justcache_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(buf, "justcache_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "justcache_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf("method=%q,route=%q,code=\"%d\"", k.method, k.route, k.code)
+}
+
+// writeStorageMetrics writes the storage stats
+func writeStorageMetrics(buf *bytes.Buffer, stats *storage.Stats) {
+	writeMetric(buf, "justcache_storage_hits_total", "counter", "Reads that found the key.", stats.Hits)
+	writeMetric(buf, "justcache_storage_misses_total", "counter", "Reads that didn't find the key.", stats.Misses)
+	writeMetric(buf, "justcache_storage_puts_total", "counter", "Values stored.", stats.Puts)
+	writeMetric(buf, "justcache_storage_evictions_total", "counter", "Entries evicted to make room.", stats.Evictions)
+	writeMetric(buf, "justcache_storage_expirations_total", "counter", "Entries removed past their TTL.", stats.Expirations)
+	writeMetric(buf, "justcache_storage_deletes_total", "counter", "Entries removed by DELETE.", stats.Deletes)
+	writeMetric(buf, "justcache_storage_items", "gauge", "Entries stored.", uint64(stats.Items))
+	writeMetric(buf, "justcache_storage_memory_used_bytes", "gauge", "Bytes of keys and values stored.", stats.MemoryUsedBytes)
+	writeMetric(buf, "justcache_storage_memory_max_bytes", "gauge", "Memory limit of the storage.", stats.MaxMemoryBytes)
+	writeSizeHistogram(buf, "justcache_storage_key_size_bytes", "Sizes of the stored keys.", stats.KeySizes, stats.KeyBytes)
+	writeSizeHistogram(buf, "justcache_storage_value_size_bytes", "Sizes of the stored values.", stats.ValueSizes, stats.ValueBytes)
+}
+
+// writeSizeHistogram writes a storage size histogram with cumulative buckets
+func writeSizeHistogram(buf *bytes.Buffer, name, help string, buckets []storage.HistogramBucket, sum uint64) {
+	writeHeader(buf, name, "histogram", help)
+	var cumulative uint64
+	for _, bucket := range buckets {
+		cumulative += bucket.Count
+		fmt.Fprintf(buf, "%s_bucket{le=\"%d\"} %d\n", name, bucket.UpperBound, cumulative)
+	}
+	fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(buf, "%s_sum %d\n", name, sum)
+	fmt.Fprintf(buf, "%s_count %d\n", name, cumulative)
+}
+
+// writeMetric writes a metric with a single unlabeled sample
+func writeMetric(buf *bytes.Buffer, name, metricType, help string, value uint64) {
+	writeHeader(buf, name, metricType, help)
+	fmt.Fprintf(buf, "%s %d\n", name, value)
+}
+
+func writeHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
@@ -0,0 +1,121 @@
+package remote
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+func scrapeMetrics(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	resp, err := http.Get(ts.URL + metricsPath)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", metricsPath, err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func assertMetricLine(t *testing.T, metrics, line string) {
+	t.Helper()
+	for _, l := range strings.Split(metrics, "\n") {
+		if l == line {
+			return
+		}
+	}
+	t.Errorf("metrics missing line %q", line)
+}
+
+func TestMetrics_Endpoint(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024*1024))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+
+	assertStatus(t, doPostAndPut(t, ts, "key", []byte("value")), http.StatusOK)
+	assertStatus(t, doGet(t, ts, "key"), http.StatusOK)
+	assertStatus(t, doGet(t, ts, "missing"), http.StatusNotFound)
+	assertStatus(t, doGet(t, ts, "missing"), http.StatusNotFound)
+
+	metrics := scrapeMetrics(t, ts)
+
+	assertMetricLine(t, metrics, "# TYPE justcache_http_requests_total counter")
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="GET",route="cache",code="200"} 1`)
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="GET",route="cache",code="404"} 2`)
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="POST",route="cache",code="202"} 1`)
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="PUT",route="cache",code="200"} 1`)
+	assertMetricLine(t, metrics, "# TYPE justcache_http_request_duration_seconds histogram")
+	assertMetricLine(t, metrics, `justcache_http_request_duration_seconds_bucket{method="GET",route="cache",code="404",le="+Inf"} 2`)
+	assertMetricLine(t, metrics, `justcache_http_request_duration_seconds_count{method="GET",route="cache",code="404"} 2`)
+
+	assertMetricLine(t, metrics, "justcache_storage_hits_total 1")
+	assertMetricLine(t, metrics, "justcache_storage_items 1")
+	assertMetricLine(t, metrics, "justcache_storage_memory_used_bytes 8")
+	assertMetricLine(t, metrics, `justcache_storage_value_size_bytes_bucket{le="7"} 1`)
+	assertMetricLine(t, metrics, "justcache_storage_value_size_bytes_sum 5")
+	assertMetricLine(t, metrics, "justcache_promises_created_total 1")
+	assertMetricLine(t, metrics, "justcache_promises_fulfilled_total 1")
+
+	// The scrape itself shows up on the next one
+	metrics = scrapeMetrics(t, ts)
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="GET",route="admin",code="200"} 1`)
+}
+
+func TestMetrics_PromiseConflicts(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024*1024))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+
+	resp := doPost(t, ts, "key")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+	resp = doPost(t, ts, "key")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+
+	metrics := scrapeMetrics(t, ts)
+	assertMetricLine(t, metrics, "# TYPE justcache_promises_conflicts_total counter")
+	assertMetricLine(t, metrics, "justcache_promises_conflicts_total 1")
+	assertMetricLine(t, metrics, `justcache_http_requests_total{method="POST",route="cache",code="409"} 1`)
+}
+
+func TestRequestMetrics_Buckets(t *testing.T) {
+	m := newRequestMetrics()
+	m.observe(http.MethodGet, "cache", 200, 300*time.Microsecond)
+	m.observe(http.MethodGet, "cache", 200, 20*time.Millisecond)
+	m.observe(http.MethodGet, "cache", 200, time.Minute)
+	m.observe("PATCH", "cache", 405, time.Millisecond)
+
+	h := m.latencies[requestKey{method: "GET", route: "cache", code: 200}]
+	if h.count != 3 || h.counts[0] != 1 || h.counts[5] != 1 || h.counts[len(latencyBuckets)] != 1 {
+		t.Errorf("histogram = %+v", h)
+	}
+	if _, ok := m.latencies[requestKey{method: "OTHER", route: "cache", code: 405}]; !ok {
+		t.Error("unknown method not mapped to OTHER")
+	}
+}
+
+func TestRouteLabel(t *testing.T) {
+	tests := map[string]string{
+		"/cache/key":    "cache",
+		"/batch/get":    "batch",
+		"/_admin/stats": "admin",
+		"/metrics":      "admin",
+		"/favicon.ico":  "other",
+	}
+	for path, expected := range tests {
+		if got := routeLabel(path); got != expected {
+			t.Errorf("routeLabel(%q) = %q, want %q", path, got, expected)
+		}
+	}
+}
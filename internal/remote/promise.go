@@ -1,7 +1,14 @@
 package remote
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,28 +18,81 @@ const (
 
 	// Cleanup interval for expired promises
 	promiseCleanupInterval = 15 * time.Second
+
+	// Number of random bytes in a promise token
+	promiseTokenBytes = 16
+
+	// Default time a reported origin failure holds off new promises
+	defaultFailureTTL = 5 * time.Second
 )
 
-// Promise represents an intent to upload a cache value
+// ErrPromiseExists is returned when a promise can't be created because the key
+// already has a live promise or an unexpired origin failure.
+var ErrPromiseExists = errors.New("promise already exists")
+
+// randRead fills promise tokens; replaced in tests
+var randRead = rand.Read
+
+// Promise represents an intent to upload a cache value.
+// A Promise is never modified once created; Renew replaces it with a copy.
 type Promise struct {
 	Key       string
 	Size      int64 // Expected size from x-jc-size header, -1 if not specified
+	Token     string
 	CreatedAt time.Time
 	ExpiresAt time.Time
+
+	// done is closed when the promise is removed (fulfilled, released or expired)
+	done chan struct{}
+}
+
+// OwnedBy reports whether the token identifies the holder of this promise.
+func (p *Promise) OwnedBy(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) == 1
+}
+
+// PromiseStats counts promise outcomes since the PromiseMap was created
+type PromiseStats struct {
+	// Active is the number of promises held, including expired ones not yet cleaned up
+	Active int `json:"active"`
+	// Created counts granted promises
+	Created uint64 `json:"created"`
+	// Fulfilled counts promises removed after a successful upload
+	Fulfilled uint64 `json:"fulfilled"`
+	// Released counts promises given up by their holder, after a failed upload
+	// or by abandoning them
+	Released uint64 `json:"released"`
+	// Renewed counts promise renewals
+	Renewed uint64 `json:"renewed"`
+	// Failed counts promises given up because their holder's origin failed
+	Failed uint64 `json:"failed"`
+	// Expired counts promises removed after their TTL ran out
+	Expired uint64 `json:"expired"`
+	// Conflicts counts promise requests rejected because another was in flight
+	// or the origin recently failed
+	Conflicts uint64 `json:"conflicts"`
 }
 
-// PromiseMap manages active upload promises with TTL-based expiration
+// PromiseMap manages active upload promises with TTL-based expiration.
+// It also holds the origin failures reported by promise holders, which keep
+// new promises for the key from being granted until they expire.
 type PromiseMap struct {
 	mu       sync.RWMutex
 	promises map[string]*Promise
+	// failures maps keys to the time their reported origin failure expires
+	failures map[string]time.Time
 	stopChan chan struct{}
 	stopOnce sync.Once
+
+	// Counters for Stats; atomic since Get only holds the read lock
+	created, fulfilled, released, renewed, failed, expired, conflicts atomic.Uint64
 }
 
 // NewPromiseMap creates a new PromiseMap and starts the background cleanup goroutine
 func NewPromiseMap() *PromiseMap {
 	pm := &PromiseMap{
 		promises: make(map[string]*Promise),
+		failures: make(map[string]time.Time),
 		stopChan: make(chan struct{}),
 	}
 	go pm.cleanupLoop()
@@ -42,6 +102,14 @@ func NewPromiseMap() *PromiseMap {
 // Create creates a new promise for the given key.
 // Returns false if a promise already exists and hasn't expired.
 func (pm *PromiseMap) Create(key string, size int64, ttl time.Duration) bool {
+	_, err := pm.CreateWithToken(key, size, ttl)
+	return err == nil
+}
+
+// CreateWithToken is like Create but also returns the opaque token that
+// identifies the holder of the new promise. Returns ErrPromiseExists if a
+// promise exists or an origin failure reported for the key hasn't expired.
+func (pm *PromiseMap) CreateWithToken(key string, size int64, ttl time.Duration) (string, error) {
 	if ttl <= 0 {
 		ttl = defaultPromiseTTL
 	}
@@ -49,25 +117,42 @@ func (pm *PromiseMap) Create(key string, size int64, ttl time.Duration) bool {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	if failedUntil, ok := pm.failures[key]; ok {
+		if failedUntil.After(time.Now()) {
+			pm.conflicts.Add(1)
+			return "", ErrPromiseExists
+		}
+		delete(pm.failures, key)
+	}
+
 	// Check if promise already exists
 	if existing, ok := pm.promises[key]; ok {
 		if existing.ExpiresAt.After(time.Now()) {
 			// Promise still valid, reject new promise
-			return false
+			pm.conflicts.Add(1)
+			return "", ErrPromiseExists
 		}
 		// Existing promise expired, remove it
-		delete(pm.promises, key)
+		pm.removeUnlocked(key)
+		pm.expired.Add(1)
 	}
 
 	// Create new promise
 	now := time.Now()
+	token, err := newPromiseToken()
+	if err != nil {
+		return "", err
+	}
 	pm.promises[key] = &Promise{
 		Key:       key,
 		Size:      size,
+		Token:     token,
 		CreatedAt: now,
 		ExpiresAt: now.Add(ttl),
+		done:      make(chan struct{}),
 	}
-	return true
+	pm.created.Add(1)
+	return token, nil
 }
 
 // Get retrieves a promise for the given key.
@@ -102,7 +187,8 @@ func (pm *PromiseMap) Get(key string) *Promise {
 
 	// Recheck expiration (another goroutine may have replaced it with a new promise)
 	if promise.ExpiresAt.Before(time.Now()) {
-		delete(pm.promises, key)
+		pm.removeUnlocked(key)
+		pm.expired.Add(1)
 		return nil
 	}
 
@@ -115,11 +201,154 @@ func (pm *PromiseMap) Exists(key string) bool {
 	return pm.Get(key) != nil
 }
 
-// Fulfill removes a promise after successful upload.
+// Fulfill removes the promise for the key, whoever holds it, along with any
+// origin failure reported for it.
+// It isn't counted in Stats: the server uses it to cancel the promise of a
+// deleted key, while successful uploads call Complete.
 func (pm *PromiseMap) Fulfill(key string) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
+	pm.removeUnlocked(key)
+	delete(pm.failures, key)
+}
+
+// Complete removes a promise held by the given token after its value was
+// stored. It is Release for a successful upload, and is counted as fulfilled.
+// Returns false if no such promise exists.
+func (pm *PromiseMap) Complete(key, token string) bool {
+	if !pm.removeOwned(key, token) {
+		return false
+	}
+	pm.fulfilled.Add(1)
+	return true
+}
+
+// Release removes a promise only if it is held by the given token.
+// Unlike Fulfill, it can't remove a newer promise that replaced an expired one.
+// Returns false if no such promise exists.
+func (pm *PromiseMap) Release(key, token string) bool {
+	if !pm.removeOwned(key, token) {
+		return false
+	}
+	pm.released.Add(1)
+	return true
+}
+
+// Renew extends a promise held by the given token to expire ttl from now
+// (the default TTL if ttl <= 0), so a slow upload doesn't lose it.
+// Returns the new expiry, or false if no such promise exists or it has expired.
+func (pm *PromiseMap) Renew(key, token string, ttl time.Duration) (time.Time, bool) {
+	if ttl <= 0 {
+		ttl = defaultPromiseTTL
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	promise, ok := pm.promises[key]
+	now := time.Now()
+	if !ok || !promise.OwnedBy(token) || promise.ExpiresAt.Before(now) {
+		return time.Time{}, false
+	}
+
+	// Readers may hold the old Promise, so replace rather than modify it.
+	// The done channel carries over, so waiters keep waiting.
+	renewed := *promise
+	renewed.ExpiresAt = now.Add(ttl)
+	pm.promises[key] = &renewed
+	pm.renewed.Add(1)
+	return renewed.ExpiresAt, true
+}
+
+// Fail removes a promise held by the given token because the origin failed,
+// and holds off new promises for the key for ttl (the default failure TTL if
+// ttl <= 0), so waiting clients back off instead of all retrying the origin.
+// Returns false if no such promise exists.
+func (pm *PromiseMap) Fail(key, token string, ttl time.Duration) bool {
+	if ttl <= 0 {
+		ttl = defaultFailureTTL
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	promise, ok := pm.promises[key]
+	if !ok || !promise.OwnedBy(token) {
+		return false
+	}
+	// Record the failure before waking the waiters, so they see it
+	pm.failures[key] = time.Now().Add(ttl)
+	pm.removeUnlocked(key)
+	pm.failed.Add(1)
+	return true
+}
+
+// FailureTTL returns how long the origin failure reported for the key holds
+// off new promises. Returns 0 if there is none or it has expired.
+func (pm *PromiseMap) FailureTTL(key string) time.Duration {
+	pm.mu.RLock()
+	failedUntil, ok := pm.failures[key]
+	pm.mu.RUnlock()
+
+	if !ok {
+		return 0
+	}
+	return max(time.Until(failedUntil), 0)
+}
+
+// removeOwned removes the promise for the key if it is held by the token
+func (pm *PromiseMap) removeOwned(key, token string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	promise, ok := pm.promises[key]
+	if !ok || !promise.OwnedBy(token) {
+		return false
+	}
+	return pm.removeUnlocked(key)
+}
+
+// Wait blocks until the promise for the key is removed (fulfilled, released or
+// expired), the timeout elapses, or the context is done.
+// Returns true if the promise is gone, false on timeout or cancellation.
+// Returns true immediately if there is no valid promise for the key.
+func (pm *PromiseMap) Wait(ctx context.Context, key string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		promise := pm.Get(key)
+		if promise == nil {
+			return true
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+
+		// An unfulfilled promise is gone once it expires, even before cleanup
+		// runs. It may have been renewed by then, so check again on expiry.
+		timer := time.NewTimer(min(time.Until(promise.ExpiresAt), remaining))
+		select {
+		case <-promise.done:
+			timer.Stop()
+			return true
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// removeUnlocked deletes the promise for the key and wakes its waiters.
+// Returns false if there was none. Lock must be held by caller.
+func (pm *PromiseMap) removeUnlocked(key string) bool {
+	promise, ok := pm.promises[key]
+	if !ok {
+		return false
+	}
+	close(promise.done)
 	delete(pm.promises, key)
+	return true
 }
 
 // RemainingTTL returns the remaining TTL for a promise.
@@ -151,7 +380,7 @@ func (pm *PromiseMap) cleanupLoop() {
 	}
 }
 
-// cleanupExpired removes all expired promises
+// cleanupExpired removes all expired promises and origin failures
 func (pm *PromiseMap) cleanupExpired() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -159,7 +388,13 @@ func (pm *PromiseMap) cleanupExpired() {
 	now := time.Now()
 	for key, promise := range pm.promises {
 		if promise.ExpiresAt.Before(now) {
-			delete(pm.promises, key)
+			pm.removeUnlocked(key)
+			pm.expired.Add(1)
+		}
+	}
+	for key, failedUntil := range pm.failures {
+		if failedUntil.Before(now) {
+			delete(pm.failures, key)
 		}
 	}
 }
@@ -172,6 +407,20 @@ func (pm *PromiseMap) Stop() {
 	})
 }
 
+// Stats returns the promise counters
+func (pm *PromiseMap) Stats() PromiseStats {
+	return PromiseStats{
+		Active:    pm.Len(),
+		Created:   pm.created.Load(),
+		Fulfilled: pm.fulfilled.Load(),
+		Released:  pm.released.Load(),
+		Renewed:   pm.renewed.Load(),
+		Failed:    pm.failed.Load(),
+		Expired:   pm.expired.Load(),
+		Conflicts: pm.conflicts.Load(),
+	}
+}
+
 // Len returns the number of promises (including potentially expired ones)
 // Primarily for testing purposes.
 func (pm *PromiseMap) Len() int {
@@ -179,3 +428,12 @@ func (pm *PromiseMap) Len() int {
 	defer pm.mu.RUnlock()
 	return len(pm.promises)
 }
+
+// newPromiseToken returns a random, unguessable promise token
+func newPromiseToken() (string, error) {
+	b := make([]byte, promiseTokenBytes)
+	if _, err := randRead(b); err != nil {
+		return "", fmt.Errorf("generating promise token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,6 +1,7 @@
 package remote
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -236,3 +237,258 @@ func TestPromiseMap_ConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestPromiseMap_CreateWithToken(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token1, err := pm.CreateWithToken("key1", 100, time.Minute)
+	if err != nil || token1 == "" {
+		t.Fatalf("CreateWithToken = (%q, %v), want non-empty token", token1, err)
+	}
+	token2, _ := pm.CreateWithToken("key2", 100, time.Minute)
+	if token1 == token2 {
+		t.Error("tokens should be unique")
+	}
+
+	if token, err := pm.CreateWithToken("key1", 100, time.Minute); err != ErrPromiseExists || token != "" {
+		t.Errorf("duplicate CreateWithToken = (%q, %v), want (\"\", ErrPromiseExists)", token, err)
+	}
+
+	promise := pm.Get("key1")
+	if !promise.OwnedBy(token1) {
+		t.Error("promise should be owned by its token")
+	}
+	if promise.OwnedBy(token2) || promise.OwnedBy("") {
+		t.Error("promise should not be owned by another token")
+	}
+}
+
+func TestPromiseMap_Release(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, time.Minute)
+
+	if pm.Release("key1", "wrong") {
+		t.Error("Release with wrong token should fail")
+	}
+	if !pm.Exists("key1") {
+		t.Error("promise should survive a Release with the wrong token")
+	}
+	if !pm.Release("key1", token) {
+		t.Error("Release with the right token should succeed")
+	}
+	if pm.Exists("key1") {
+		t.Error("promise should be removed after Release")
+	}
+	if pm.Release("key1", token) {
+		t.Error("second Release should fail")
+	}
+}
+
+func TestPromiseMap_WaitFulfilled(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	pm.Create("key1", 100, time.Minute)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pm.Fulfill("key1")
+	}()
+
+	if !pm.Wait(context.Background(), "key1", 5*time.Second) {
+		t.Error("Wait should return true once the promise is fulfilled")
+	}
+}
+
+func TestPromiseMap_WaitNoPromise(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	if !pm.Wait(context.Background(), "missing", time.Minute) {
+		t.Error("Wait should return true immediately without a promise")
+	}
+}
+
+func TestPromiseMap_WaitTimeout(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	pm.Create("key1", 100, time.Minute)
+	if pm.Wait(context.Background(), "key1", 20*time.Millisecond) {
+		t.Error("Wait should return false when the timeout elapses first")
+	}
+}
+
+func TestPromiseMap_WaitExpiry(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	pm.Create("key1", 100, 20*time.Millisecond)
+	if !pm.Wait(context.Background(), "key1", time.Minute) {
+		t.Error("Wait should return true once the promise expires")
+	}
+}
+
+func TestPromiseMap_WaitContextCanceled(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	pm.Create("key1", 100, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if pm.Wait(ctx, "key1", time.Minute) {
+		t.Error("Wait should return false when the context is done")
+	}
+}
+
+func TestPromiseMap_Stats(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	tokenA, _ := pm.CreateWithToken("a", -1, time.Second)
+	pm.Create("a", -1, time.Second) // conflict
+	tokenB, _ := pm.CreateWithToken("b", -1, time.Second)
+	pm.Create("c", -1, 10*time.Millisecond)
+
+	pm.Complete("a", tokenA)
+	pm.Release("b", tokenB)
+	pm.Complete("b", tokenB) // already gone, not counted
+	time.Sleep(20 * time.Millisecond)
+	pm.Get("c")
+
+	expected := PromiseStats{Active: 0, Created: 3, Fulfilled: 1, Released: 1, Expired: 1, Conflicts: 1}
+	if stats := pm.Stats(); stats != expected {
+		t.Errorf("Stats() = %+v, want %+v", stats, expected)
+	}
+}
+
+func TestPromiseMap_CompleteRequiresToken(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key", -1, time.Second)
+	if pm.Complete("key", "wrong") {
+		t.Error("Complete with wrong token should fail")
+	}
+	if !pm.Complete("key", token) {
+		t.Error("Complete with owner token should succeed")
+	}
+	if pm.Exists("key") {
+		t.Error("Promise should be removed after Complete")
+	}
+}
+
+func TestPromiseMap_Renew(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, 50*time.Millisecond)
+
+	if _, ok := pm.Renew("key1", "wrong", time.Minute); ok {
+		t.Error("Renew with wrong token should fail")
+	}
+	expiresAt, ok := pm.Renew("key1", token, time.Minute)
+	if !ok {
+		t.Fatal("Renew with the right token should succeed")
+	}
+	if until := time.Until(expiresAt); until < 50*time.Second {
+		t.Errorf("renewed promise expires in %v, want about a minute", until)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if !pm.Exists("key1") {
+		t.Error("renewed promise should outlive its original TTL")
+	}
+	if got := pm.Stats().Renewed; got != 1 {
+		t.Errorf("Renewed = %d, want 1", got)
+	}
+	if _, ok := pm.Renew("missing", token, time.Minute); ok {
+		t.Error("Renew of a missing promise should fail")
+	}
+}
+
+func TestPromiseMap_RenewExpired(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := pm.Renew("key1", token, time.Minute); ok {
+		t.Error("Renew of an expired promise should fail")
+	}
+}
+
+func TestPromiseMap_Fail(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, time.Minute)
+	if pm.Fail("key1", "wrong", time.Minute) {
+		t.Error("Fail with wrong token should fail")
+	}
+	if pm.FailureTTL("key1") != 0 {
+		t.Error("no failure should be recorded before Fail")
+	}
+	if !pm.Fail("key1", token, 50*time.Millisecond) {
+		t.Fatal("Fail with the right token should succeed")
+	}
+	if pm.Exists("key1") {
+		t.Error("promise should be removed after Fail")
+	}
+	if ttl := pm.FailureTTL("key1"); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("FailureTTL = %v, want up to 50ms", ttl)
+	}
+
+	// The failure holds off new promises until it expires
+	if _, err := pm.CreateWithToken("key1", 100, time.Minute); err != ErrPromiseExists {
+		t.Error("Create should fail while the origin failure lasts")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if pm.FailureTTL("key1") != 0 {
+		t.Error("FailureTTL should be 0 once the failure expires")
+	}
+	if _, err := pm.CreateWithToken("key1", 100, time.Minute); err != nil {
+		t.Error("Create should succeed once the failure expires")
+	}
+
+	stats := pm.Stats()
+	if stats.Failed != 1 || stats.Conflicts != 1 {
+		t.Errorf("Failed = %d, Conflicts = %d, want 1 and 1", stats.Failed, stats.Conflicts)
+	}
+}
+
+func TestPromiseMap_FulfillClearsFailure(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, time.Minute)
+	pm.Fail("key1", token, time.Minute)
+	pm.Fulfill("key1")
+
+	if pm.FailureTTL("key1") != 0 {
+		t.Error("Fulfill should clear the origin failure")
+	}
+}
+
+func TestPromiseMap_WaitFollowsRenewal(t *testing.T) {
+	pm := NewPromiseMap()
+	defer pm.Stop()
+
+	token, _ := pm.CreateWithToken("key1", 100, 50*time.Millisecond)
+	pm.Renew("key1", token, 200*time.Millisecond)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pm.Complete("key1", token)
+	}()
+
+	start := time.Now()
+	if !pm.Wait(context.Background(), "key1", 5*time.Second) {
+		t.Fatal("Wait should return true once the promise is completed")
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Wait returned after %v, want to wait past the original TTL", elapsed)
+	}
+}
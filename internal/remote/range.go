@@ -0,0 +1,69 @@
+package remote
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errRangeNotSatisfiable is returned when a range doesn't overlap the value
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is an inclusive range of byte offsets within a value
+type byteRange struct {
+	start, end int
+}
+
+// length returns the number of bytes in the range
+func (r byteRange) length() int {
+	return r.end - r.start + 1
+}
+
+// parseRange parses a single-range `Range: bytes=...` header against a value of
+// the given size. Supported forms are "bytes=a-b", "bytes=a-" and "bytes=-n"
+// (the last n bytes); an end past the value is clamped to its last byte.
+//
+// Returns ok=false if the header should be ignored and the full value served:
+// it is empty, malformed, uses another unit, or asks for multiple ranges.
+// Returns errRangeNotSatisfiable if the range is well-formed but starts past
+// the end of the value.
+func parseRange(header string, size int) (byteRange, bool, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	// Suffix range: the last n bytes
+	if startStr == "" {
+		n, err := strconv.Atoi(endStr)
+		if err != nil || n < 0 {
+			return byteRange{}, false, nil
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, true, errRangeNotSatisfiable
+		}
+		return byteRange{start: max(size-n, 0), end: size - 1}, true, nil
+	}
+
+	start, err := strconv.Atoi(startStr)
+	if err != nil || start < 0 {
+		return byteRange{}, false, nil
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.Atoi(endStr)
+		if err != nil || end < start {
+			return byteRange{}, false, nil
+		}
+	}
+
+	if start >= size {
+		return byteRange{}, true, errRangeNotSatisfiable
+	}
+	return byteRange{start: start, end: min(end, size-1)}, true, nil
+}
@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    int
+		want    byteRange
+		wantOK  bool
+		wantErr error
+	}{
+		{"bytes=0-4", 10, byteRange{0, 4}, true, nil},
+		{"bytes=5-", 10, byteRange{5, 9}, true, nil},
+		{"bytes=-3", 10, byteRange{7, 9}, true, nil},
+		{"bytes=-20", 10, byteRange{0, 9}, true, nil},
+		{"bytes=8-100", 10, byteRange{8, 9}, true, nil},
+		{"bytes=9-9", 10, byteRange{9, 9}, true, nil},
+		{"bytes=10-", 10, byteRange{}, true, errRangeNotSatisfiable},
+		{"bytes=10-20", 10, byteRange{}, true, errRangeNotSatisfiable},
+		{"bytes=-0", 10, byteRange{}, true, errRangeNotSatisfiable},
+		// Ignored: the full value is served
+		{"", 10, byteRange{}, false, nil},
+		{"items=0-4", 10, byteRange{}, false, nil},
+		{"bytes=0-1,3-4", 10, byteRange{}, false, nil},
+		{"bytes=4-2", 10, byteRange{}, false, nil},
+		{"bytes=a-b", 10, byteRange{}, false, nil},
+		{"bytes=5", 10, byteRange{}, false, nil},
+		{"bytes=-1-2", 10, byteRange{}, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok, err := parseRange(tt.header, tt.size)
+			if err != tt.wantErr {
+				t.Fatalf("parseRange(%q) error = %v, want %v", tt.header, err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("parseRange(%q) ok = %v, want %v", tt.header, ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("parseRange(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
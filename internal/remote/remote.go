@@ -1,11 +1,14 @@
 package remote
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/satmihir/justcache/internal/constants"
@@ -17,34 +20,96 @@ const (
 	cachePathPrefix = "/cache/"
 
 	// Header names
-	headerSize       = "x-jc-size"
-	headerTTL        = "x-jc-ttl"
-	headerSuperhot   = "x-jc-superhot"
-	headerDryRun     = "x-jc-dryrun"
-	headerPromiseTTL = "x-jc-promise-ttl"
-	headerRetryAfter = "Retry-After"
+	headerSize          = "x-jc-size"
+	headerTTL           = "x-jc-ttl"
+	headerSuperhot      = "x-jc-superhot"
+	headerDryRun        = "x-jc-dryrun"
+	headerPromiseTTL    = "x-jc-promise-ttl"
+	headerPromiseToken  = "x-jc-promise-token"
+	headerPromiseAction = "x-jc-promise-action"
+	headerFailureTTL    = "x-jc-failure-ttl"
+	headerNegative      = "x-jc-negative"
+	headerStale         = "x-jc-stale"
+	headerRefresh       = "x-jc-refresh"
+	headerWait          = "x-jc-wait"
+	headerRetryAfter    = "Retry-After"
+	headerRange         = "Range"
+	headerContentRange  = "Content-Range"
+	headerAcceptRanges  = "Accept-Ranges"
 
 	// Default TTL for PUT operations (30 minutes)
 	defaultTTL = 30 * time.Minute
+
+	// Default TTL for negative entries (1 minute)
+	defaultNegativeTTL = time.Minute
+
+	// Maximum time a GET may wait on an in-flight promise
+	maxWait = 30 * time.Second
+
+	// Maximum time a reported origin failure may hold off new promises
+	maxFailureTTL = time.Minute
 )
 
 // CacheServer represents the HTTP server for the cache
 type CacheServer struct {
 	addr     string
 	mux      *http.ServeMux
-	storage  storage.LocalStorage
-	promises *PromiseMap
+	handler  http.Handler // mux, instrumented
+	requests *requestMetrics
+
+	httpConfig HTTPConfig
+	httpServer *http.Server
+	// draining is set by Shutdown; new promises are refused from then on
+	draining atomic.Bool
+	// shutdown is canceled by Shutdown to wake long-polling GETs
+	shutdown       context.Context
+	cancelShutdown context.CancelFunc
+	storage        storage.LocalStorage
+	promises       *PromiseMap
+	hotKeys        *HotKeyTracker
+
+	superhotConfig SuperhotConfig
+	snapshotPath   string
+}
+
+// ServerOption configures the server
+type ServerOption func(*CacheServer)
+
+// WithSuperhotConfig sets the thresholds used to mark keys as superhot
+func WithSuperhotConfig(config SuperhotConfig) ServerOption {
+	return func(s *CacheServer) {
+		s.superhotConfig = config
+	}
+}
+
+// WithSnapshotPath makes the server save its storage to path on Shutdown and
+// load it back on Start, so a restarted node serves warm. The storage must
+// implement storage.Snapshotter; otherwise the option has no effect.
+func WithSnapshotPath(path string) ServerOption {
+	return func(s *CacheServer) {
+		s.snapshotPath = path
+	}
 }
 
 // NewCacheServer creates a new CacheServer instance
-func NewCacheServer(addr string, store storage.LocalStorage) *CacheServer {
+func NewCacheServer(addr string, store storage.LocalStorage, opts ...ServerOption) *CacheServer {
 	s := &CacheServer{
-		addr:     addr,
-		mux:      http.NewServeMux(),
-		storage:  store,
-		promises: NewPromiseMap(),
+		addr:           addr,
+		mux:            http.NewServeMux(),
+		storage:        store,
+		promises:       NewPromiseMap(),
+		requests:       newRequestMetrics(),
+		httpConfig:     DefaultHTTPConfig(),
+		superhotConfig: DefaultSuperhotConfig(),
+	}
+	s.shutdown, s.cancelShutdown = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.hotKeys = NewHotKeyTracker(s.superhotConfig)
 	s.registerRoutes()
+	s.handler = s.instrument(s.mux)
+	s.httpServer = s.newHTTPServer()
 	return s
 }
 
@@ -56,6 +121,9 @@ func (s *CacheServer) Stop() {
 // registerRoutes sets up the HTTP routes
 func (s *CacheServer) registerRoutes() {
 	s.mux.HandleFunc("/", s.handleRequest)
+	s.mux.HandleFunc(batchPathPrefix, s.handleBatch)
+	s.mux.HandleFunc(statsPath, s.handleStats)
+	s.mux.HandleFunc(metricsPath, s.handleMetrics)
 }
 
 // handleRequest routes requests based on HTTP method
@@ -74,6 +142,8 @@ func (s *CacheServer) handleRequest(w http.ResponseWriter, r *http.Request) {
 		s.handlePost(w, r, key)
 	case http.MethodPut:
 		s.handlePut(w, r, key)
+	case http.MethodDelete:
+		s.handleDelete(w, r, key)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -96,11 +166,37 @@ func parseKeyFromPath(path string) (string, error) {
 }
 
 // handleGet handles GET requests
-// Returns 200 OK with value on hit, 404 Not Found on miss
+// Returns 200 OK with value on hit, 404 Not Found on miss.
+// A single-range Range header returns 206 Partial Content with that slice, or
+// 416 Range Not Satisfiable if it starts past the end of the value.
+// With x-jc-wait, a miss on a key with an in-flight promise blocks until the
+// promise is fulfilled or expires (or the wait elapses) and then reads again.
+// A stale entry is served with x-jc-stale: true; with x-jc-refresh: true, the
+// first client to ask also gets a promise (x-jc-promise-token) to refresh it.
 func (s *CacheServer) handleGet(w http.ResponseWriter, r *http.Request, key string) {
+	var wait time.Duration
+	if waitHeader := r.Header.Get(headerWait); waitHeader != "" {
+		waitMs, parseErr := strconv.ParseInt(waitHeader, 10, 64)
+		if parseErr != nil || waitMs < 0 {
+			http.Error(w, "Invalid x-jc-wait header: must be non-negative integer (milliseconds)", http.StatusBadRequest)
+			return
+		}
+		wait = min(time.Duration(waitMs)*time.Millisecond, maxWait)
+	}
+
 	entry, err := s.storage.Get(key)
+	if errors.Is(err, storage.ErrKeyNotFound) && wait > 0 {
+		ctx, done := s.waitContext(r)
+		// The miss is already counted; the re-read isn't another GET
+		if s.promises.Wait(ctx, key, wait) {
+			entry, err = s.peek(key)
+		}
+		done()
+	}
 	if err != nil {
 		if errors.Is(err, storage.ErrKeyNotFound) {
+			// Tell the waiters if the load they were waiting on failed
+			setFailureHeaders(w, s.promises.FailureTTL(key))
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -108,7 +204,35 @@ func (s *CacheServer) handleGet(w http.ResponseWriter, r *http.Request, key stri
 		return
 	}
 
-	setResponseHeaders(w, entry)
+	setResponseHeaders(w, entry, s.hotKeys.Record(key))
+	w.Header().Set(headerAcceptRanges, "bytes")
+
+	// The first client that asks to refresh a stale entry gets the promise
+	if entry.Stale && r.Header.Get(headerRefresh) == "true" {
+		if result, err := s.grantPromise(key, -1, defaultPromiseTTL, false); err == nil && result.status == http.StatusAccepted {
+			w.Header().Set(headerPromiseTTL, strconv.FormatInt(result.promiseTTL.Milliseconds(), 10))
+			w.Header().Set(headerPromiseToken, result.token)
+		}
+	}
+
+	// Serve a slice of the value if a single satisfiable range was requested.
+	// A negative entry has no value to slice.
+	if rangeHeader := r.Header.Get(headerRange); rangeHeader != "" && !entry.Negative {
+		br, ok, err := parseRange(rangeHeader, len(entry.Value))
+		if err != nil {
+			w.Header().Set(headerContentRange, "bytes */"+strconv.Itoa(len(entry.Value)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			w.Header().Set(headerContentRange, fmt.Sprintf("bytes %d-%d/%d", br.start, br.end, len(entry.Value)))
+			w.Header().Set("Content-Length", strconv.Itoa(br.length()))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(entry.Value[br.start : br.end+1])
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write(entry.Value)
 }
@@ -117,20 +241,15 @@ func (s *CacheServer) handleGet(w http.ResponseWriter, r *http.Request, key stri
 // Response codes:
 // - 200 OK: key already exists, client should GET it
 // - 202 Accepted: server requests an upload, client should PUT
-// - 409 Conflict: another client is uploading (promise exists)
+// - 409 Conflict: another client is uploading (promise exists), or reported an
+// origin failure (x-jc-failure-ttl)
 // - 507 Insufficient Storage: cannot accept this key/value
+// - 503 Service Unavailable: the server is shutting down
+//
+// With x-jc-promise-action, it acts on a held promise instead; see handlePromiseAction.
 func (s *CacheServer) handlePost(w http.ResponseWriter, r *http.Request, key string) {
-	// Check if key already exists in cache
-	entry, err := s.storage.Get(key)
-	if err == nil {
-		// Key exists, client should GET it
-		setResponseHeaders(w, entry)
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if !errors.Is(err, storage.ErrKeyNotFound) {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if action := r.Header.Get(headerPromiseAction); action != "" {
+		s.handlePromiseAction(w, r, key, action)
 		return
 	}
 
@@ -143,64 +262,219 @@ func (s *CacheServer) handlePost(w http.ResponseWriter, r *http.Request, key str
 			http.Error(w, "Invalid x-jc-size header: must be non-negative integer", http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Early rejection if value is too large
-		if !s.storage.CanFit(len(key), int(valueSize)) {
-			http.Error(w, "Value too large for storage capacity", http.StatusInsufficientStorage)
-			return
+	// Parse x-jc-promise-ttl header for custom promise TTL
+	promiseTTL, ok := parsePromiseTTL(r)
+	if !ok {
+		http.Error(w, "Invalid x-jc-promise-ttl header: must be positive integer (milliseconds)", http.StatusBadRequest)
+		return
+	}
+
+	// Check x-jc-dryrun header
+	dryRun := r.Header.Get(headerDryRun) == "true"
+
+	result, err := s.requestPromise(key, valueSize, promiseTTL, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch result.status {
+	case http.StatusOK:
+		// Key exists, client should GET it
+		setResponseHeaders(w, result.entry, s.hotKeys.IsHot(key))
+	case http.StatusAccepted:
+		// The token authorizes the PUT (none on a dry run)
+		w.Header().Set(headerPromiseTTL, strconv.FormatInt(result.promiseTTL.Milliseconds(), 10))
+		if result.token != "" {
+			w.Header().Set(headerPromiseToken, result.token)
+		}
+	case http.StatusConflict:
+		if result.failureTTL > 0 {
+			setFailureHeaders(w, result.failureTTL)
+			break
 		}
+		w.Header().Set(headerPromiseTTL, strconv.FormatInt(result.promiseTTL.Milliseconds(), 10))
+		w.Header().Set(headerRetryAfter, strconv.Itoa(int(result.promiseTTL.Seconds())+1))
+	case http.StatusInsufficientStorage:
+		http.Error(w, "Value too large for storage capacity", http.StatusInsufficientStorage)
+		return
+	case http.StatusServiceUnavailable:
+		w.Header().Set(headerRetryAfter, "1")
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
 	}
+	w.WriteHeader(result.status)
+}
 
-	// Parse x-jc-promise-ttl header for custom promise TTL
-	promiseTTL := defaultPromiseTTL
-	if ttlHeader := r.Header.Get(headerPromiseTTL); ttlHeader != "" {
-		ttlMs, parseErr := strconv.ParseInt(ttlHeader, 10, 64)
-		if parseErr != nil || ttlMs <= 0 {
+// handlePromiseAction handles POST with x-jc-promise-action, on a promise held
+// by the x-jc-promise-token:
+// - renew: extend the promise to expire x-jc-promise-ttl (default 30s) from now
+// - abandon: release the promise now, e.g. because the load was canceled, so
+// waiting clients can move on
+// - fail: release the promise because the origin failed, and hold off new
+// promises for x-jc-failure-ttl (default 5s) so waiting clients back off
+// Response codes:
+// - 200 OK: done; on renew, x-jc-promise-ttl is the new remaining TTL
+// - 400 Bad Request: unknown action, missing token or invalid TTL
+// - 409 Conflict: no promise for the key is held by the token (e.g. it expired)
+func (s *CacheServer) handlePromiseAction(w http.ResponseWriter, r *http.Request, key, action string) {
+	token := r.Header.Get(headerPromiseToken)
+	if token == "" {
+		http.Error(w, "x-jc-promise-token required", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "renew":
+		promiseTTL, ok := parsePromiseTTL(r)
+		if !ok {
 			http.Error(w, "Invalid x-jc-promise-ttl header: must be positive integer (milliseconds)", http.StatusBadRequest)
 			return
 		}
-		promiseTTL = time.Duration(ttlMs) * time.Millisecond
+		expiresAt, ok := s.promises.Renew(key, token, promiseTTL)
+		if !ok {
+			http.Error(w, "No active promise held by token", http.StatusConflict)
+			return
+		}
+		w.Header().Set(headerPromiseTTL, strconv.FormatInt(time.Until(expiresAt).Milliseconds(), 10))
+	case "abandon":
+		if !s.promises.Release(key, token) {
+			http.Error(w, "No active promise held by token", http.StatusConflict)
+			return
+		}
+	case "fail":
+		var failureTTL time.Duration
+		if ttlHeader := r.Header.Get(headerFailureTTL); ttlHeader != "" {
+			ttlMs, err := strconv.ParseInt(ttlHeader, 10, 64)
+			if err != nil || ttlMs <= 0 {
+				http.Error(w, "Invalid x-jc-failure-ttl header: must be positive integer (milliseconds)", http.StatusBadRequest)
+				return
+			}
+			failureTTL = min(time.Duration(ttlMs)*time.Millisecond, maxFailureTTL)
+		}
+		if !s.promises.Fail(key, token, failureTTL) {
+			http.Error(w, "No active promise held by token", http.StatusConflict)
+			return
+		}
+	default:
+		http.Error(w, "Invalid x-jc-promise-action header: must be renew, abandon or fail", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parsePromiseTTL parses the x-jc-promise-ttl header.
+// Returns the default promise TTL if it's absent, and false if it's invalid.
+func parsePromiseTTL(r *http.Request) (time.Duration, bool) {
+	ttlHeader := r.Header.Get(headerPromiseTTL)
+	if ttlHeader == "" {
+		return defaultPromiseTTL, true
+	}
+	ttlMs, err := strconv.ParseInt(ttlHeader, 10, 64)
+	if err != nil || ttlMs <= 0 {
+		return 0, false
+	}
+	return time.Duration(ttlMs) * time.Millisecond, true
+}
+
+// peek reads the key without counting it as a GET in the storage stats, if
+// the storage supports it
+func (s *CacheServer) peek(key string) (*storage.CacheEntry, error) {
+	if peeker, ok := s.storage.(storage.Peeker); ok {
+		return peeker.Peek(key)
 	}
+	return s.storage.Get(key)
+}
 
-	// Check x-jc-dryrun header
-	dryRun := r.Header.Get(headerDryRun) == "true"
+// promiseResult is the outcome of a promise request for a single key
+type promiseResult struct {
+	// status is 200 (exists), 202 (accepted), 409 (conflict), 507 (won't fit)
+	// or 503 (shutting down)
+	status int
+	// entry is the existing value on 200
+	entry *storage.CacheEntry
+	// promiseTTL is the granted TTL on 202 or the remaining TTL on 409
+	promiseTTL time.Duration
+	// failureTTL is the remaining TTL of a reported origin failure on 409
+	failureTTL time.Duration
+	// token authorizes the upload on 202 (empty on a dry run)
+	token string
+}
+
+// requestPromise decides a promise request for a key, creating the promise
+// unless it's a dry run. valueSize is -1 if unknown.
+// A stale entry counts as missing, so it can be refreshed.
+func (s *CacheServer) requestPromise(key string, valueSize int64, promiseTTL time.Duration, dryRun bool) (promiseResult, error) {
+	// Check if key already exists in cache
+	entry, err := s.peek(key)
+	if err == nil && !entry.Stale {
+		return promiseResult{status: http.StatusOK, entry: entry}, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+		return promiseResult{}, err
+	}
+
+	return s.grantPromise(key, valueSize, promiseTTL, dryRun)
+}
+
+// grantPromise decides a promise request for a key that isn't stored (or is
+// stale), creating the promise unless it's a dry run
+func (s *CacheServer) grantPromise(key string, valueSize int64, promiseTTL time.Duration, dryRun bool) (promiseResult, error) {
+	// Early rejection if value is too large
+	if valueSize >= 0 && !s.storage.CanFit(len(key), int(valueSize)) {
+		return promiseResult{status: http.StatusInsufficientStorage}, nil
+	}
+
+	// A draining server takes no new uploads
+	if s.draining.Load() {
+		return promiseResult{status: http.StatusServiceUnavailable}, nil
+	}
+
+	// A recent origin failure holds off new loads until it expires
+	if failureTTL := s.promises.FailureTTL(key); failureTTL > 0 {
+		s.promises.conflicts.Add(1)
+		return promiseResult{status: http.StatusConflict, failureTTL: failureTTL}, nil
+	}
 
 	// Check if a promise already exists for this key
 	if existingPromise := s.promises.Get(key); existingPromise != nil {
 		// Another client is already uploading
-		remainingTTL := s.promises.RemainingTTL(key)
-		w.Header().Set(headerPromiseTTL, strconv.FormatInt(remainingTTL.Milliseconds(), 10))
-		w.Header().Set(headerRetryAfter, strconv.Itoa(int(remainingTTL.Seconds())+1))
-		w.WriteHeader(http.StatusConflict)
-		return
+		s.promises.conflicts.Add(1)
+		return promiseResult{status: http.StatusConflict, promiseTTL: s.promises.RemainingTTL(key)}, nil
 	}
 
 	// If dry run, don't create the promise
 	if dryRun {
-		w.Header().Set(headerPromiseTTL, strconv.FormatInt(promiseTTL.Milliseconds(), 10))
-		w.WriteHeader(http.StatusAccepted)
-		return
+		return promiseResult{status: http.StatusAccepted, promiseTTL: promiseTTL}, nil
 	}
 
 	// Try to create the promise
-	if !s.promises.Create(key, valueSize, promiseTTL) {
-		// Race condition: another client created promise between check and create
-		remainingTTL := s.promises.RemainingTTL(key)
-		w.Header().Set(headerPromiseTTL, strconv.FormatInt(remainingTTL.Milliseconds(), 10))
-		w.Header().Set(headerRetryAfter, strconv.Itoa(int(remainingTTL.Seconds())+1))
-		w.WriteHeader(http.StatusConflict)
-		return
+	token, err := s.promises.CreateWithToken(key, valueSize, promiseTTL)
+	if errors.Is(err, ErrPromiseExists) {
+		// Race condition: another client created promise, or reported an origin
+		// failure, between check and create
+		return promiseResult{
+			status:     http.StatusConflict,
+			promiseTTL: s.promises.RemainingTTL(key),
+			failureTTL: s.promises.FailureTTL(key),
+		}, nil
+	}
+	if err != nil {
+		return promiseResult{}, err
 	}
 
-	// Promise created successfully
-	w.Header().Set(headerPromiseTTL, strconv.FormatInt(promiseTTL.Milliseconds(), 10))
-	w.WriteHeader(http.StatusAccepted)
+	return promiseResult{status: http.StatusAccepted, promiseTTL: promiseTTL, token: token}, nil
 }
 
-// handlePut handles PUT requests to upload values
+// handlePut handles PUT requests to upload values.
+// With x-jc-negative: true and an empty body, it stores a negative entry
+// instead: a record that the origin has no value for the key.
 // Response codes:
 // - 200 OK: value stored successfully
-// - 409 Conflict: upload rejected (no promise, wrong owner, size mismatch)
+// - 400 Bad Request: invalid TTL, or a negative entry with a body
+// - 409 Conflict: upload rejected (no promise, wrong or missing token, size mismatch)
 // - 411 Length Required: missing Content-Length
 // - 413 Payload Too Large: exceeds server limits
 // - 507 Insufficient Storage: capacity exceeded
@@ -224,44 +498,33 @@ func (s *CacheServer) handlePut(w http.ResponseWriter, r *http.Request, key stri
 		return
 	}
 
-	// Check size matches if promise specified a size
-	if promise.Size >= 0 && r.ContentLength != promise.Size {
-		// Terminal error: size mismatch - release promise for other writers
-		s.promises.Fulfill(key)
-		http.Error(w, "Content-Length does not match promised size", http.StatusConflict)
+	// Only the client that was granted the promise may upload
+	token := r.Header.Get(headerPromiseToken)
+	if !promise.OwnedBy(token) {
+		http.Error(w, "Promise is owned by another client", http.StatusConflict)
 		return
 	}
 
-	// Wrap body with MaxBytesReader to enforce hard cap (defense in depth)
-	// This protects against malicious clients that lie about Content-Length
-	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxValueSizeBytes)
-
-	// Read the request body
-	value, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		// MaxBytesReader returns a specific error when limit is exceeded
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			// Terminal error: payload too large - release promise
-			s.promises.Fulfill(key)
-			http.Error(w, "Payload exceeds maximum allowed size", http.StatusRequestEntityTooLarge)
-			return
-		}
-		// Transient error: keep promise (client may retry)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	negative := r.Header.Get(headerNegative) == "true"
+	if negative && r.ContentLength != 0 {
+		http.Error(w, "Negative entries have no body", http.StatusBadRequest)
 		return
 	}
 
-	// Verify we read exactly Content-Length bytes (detect truncated uploads)
-	if int64(len(value)) != r.ContentLength {
-		// Client disconnected or sent fewer bytes than promised - transient error
-		http.Error(w, "Incomplete request body", http.StatusBadRequest)
+	// Check size matches if promise specified a size. The size was a guess if
+	// the origin turned out to have no value.
+	if !negative && promise.Size >= 0 && r.ContentLength != promise.Size {
+		// Terminal error: size mismatch - release promise for other writers
+		s.promises.Release(key, token)
+		http.Error(w, "Content-Length does not match promised size", http.StatusConflict)
 		return
 	}
 
-	// Parse TTL from header, default to 30 minutes
+	// Parse TTL from header, default to 30 minutes (1 minute for negative entries)
 	ttl := defaultTTL
+	if negative {
+		ttl = defaultNegativeTTL
+	}
 	if ttlHeader := r.Header.Get(headerTTL); ttlHeader != "" {
 		ttlMs, parseErr := strconv.ParseInt(ttlHeader, 10, 64)
 		if parseErr != nil || ttlMs <= 0 {
@@ -272,57 +535,145 @@ func (s *CacheServer) handlePut(w http.ResponseWriter, r *http.Request, key stri
 		ttl = time.Duration(ttlMs) * time.Millisecond
 	}
 
+	if negative {
+		if err := s.storage.PutNegative(key, ttl); err != nil {
+			s.writeStoreError(w, key, token, err)
+			return
+		}
+		s.promises.Complete(key, token)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Reserve capacity before reading the body, so an upload that can't fit is
+	// rejected without buffering it
+	var reservation *storage.Reservation
+	if reserver, ok := s.storage.(storage.Reserver); ok {
+		var err error
+		reservation, err = reserver.Reserve(key, int(r.ContentLength))
+		if err != nil {
+			s.writeStoreError(w, key, token, err)
+			return
+		}
+		defer reservation.Release()
+	}
+
+	// Read exactly Content-Length bytes into a single buffer. The length is
+	// already capped at MaxValueSizeBytes, and a body longer than that is never
+	// read past the announced length.
+	value := make([]byte, r.ContentLength)
+	_, err := io.ReadFull(r.Body, value)
+	r.Body.Close()
+	if err != nil {
+		// Client disconnected or sent fewer bytes than promised - transient error,
+		// keep promise (client may retry)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			http.Error(w, "Incomplete request body", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
 	// Store the value
-	err = s.storage.Put(key, value, ttl)
+	if reservation != nil {
+		err = reservation.Commit(value, ttl)
+	} else {
+		err = s.storage.Put(key, value, ttl)
+	}
+	if err != nil {
+		s.writeStoreError(w, key, token, err)
+		return
+	}
+
+	// Fulfill the promise (remove it)
+	s.promises.Complete(key, token)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeStoreError maps a storage error from a PUT to its response code.
+// Terminal errors release the promise so other writers can proceed; transient
+// ones keep it.
+func (s *CacheServer) writeStoreError(w http.ResponseWriter, key, token string, err error) {
+	status, terminal := storeErrorStatus(err)
+	if terminal {
+		s.promises.Release(key, token)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// storeErrorStatus maps a storage error from a PUT to its response code and
+// whether it's terminal (won't succeed on retry)
+func storeErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, storage.ErrMemoryLimitExceeded):
+		// Transient: might succeed after eviction or other keys expire
+		return http.StatusInsufficientStorage, false
+	case errors.Is(err, storage.ErrObjectTooLarge):
+		// Terminal: object will never fit
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, storage.ErrKeyTooLong), errors.Is(err, storage.ErrKeyTooShort):
+		// Terminal: key is fundamentally invalid
+		return http.StatusBadRequest, true
+	case errors.Is(err, storage.ErrValueTooShort):
+		// Terminal: empty value will never be accepted
+		return http.StatusBadRequest, true
+	default:
+		// Unknown error: treat as transient
+		return http.StatusInternalServerError, false
+	}
+}
+
+// handleDelete handles DELETE requests to invalidate a key
+// Response codes:
+// - 200 OK: key deleted
+// - 404 Not Found: key not present on this server
+func (s *CacheServer) handleDelete(w http.ResponseWriter, r *http.Request, key string) {
+	// Release any outstanding promise so an upload of the old value can't land
+	s.promises.Fulfill(key)
+
+	err := s.storage.Delete(key)
 	if err != nil {
-		// Determine if error is terminal (won't succeed on retry) or transient
-		isTerminal := false
 		switch {
-		case errors.Is(err, storage.ErrMemoryLimitExceeded):
-			// Transient: might succeed after eviction or other keys expire
-			http.Error(w, err.Error(), http.StatusInsufficientStorage)
-		case errors.Is(err, storage.ErrObjectTooLarge):
-			// Terminal: object will never fit
-			isTerminal = true
-			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, storage.ErrDeleteKeyNotFound):
+			w.WriteHeader(http.StatusNotFound)
 		case errors.Is(err, storage.ErrKeyTooLong), errors.Is(err, storage.ErrKeyTooShort):
-			// Terminal: key is fundamentally invalid
-			isTerminal = true
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		case errors.Is(err, storage.ErrValueTooShort):
-			// Terminal: empty value will never be accepted
-			isTerminal = true
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
-			// Unknown error: treat as transient
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
-		if isTerminal {
-			s.promises.Fulfill(key)
-		}
 		return
 	}
 
-	// Fulfill the promise (remove it)
-	s.promises.Fulfill(key)
-
 	w.WriteHeader(http.StatusOK)
 }
 
 // setResponseHeaders sets the x-jc-* response headers
-func setResponseHeaders(w http.ResponseWriter, entry *storage.CacheEntry) {
+func setResponseHeaders(w http.ResponseWriter, entry *storage.CacheEntry, superhot bool) {
 	w.Header().Set(headerSize, strconv.Itoa(entry.Size))
 	w.Header().Set(headerTTL, strconv.FormatInt(entry.RemainingTTL.Milliseconds(), 10))
-	w.Header().Set(headerSuperhot, "false") // TODO: implement superhot detection
+	w.Header().Set(headerSuperhot, strconv.FormatBool(superhot))
+	if entry.Negative {
+		w.Header().Set(headerNegative, "true")
+	}
+	if entry.Stale {
+		w.Header().Set(headerStale, "true")
+	}
+}
+
+// setFailureHeaders sets x-jc-failure-ttl and Retry-After for a reported origin
+// failure. Does nothing if failureTTL is 0.
+func setFailureHeaders(w http.ResponseWriter, failureTTL time.Duration) {
+	if failureTTL <= 0 {
+		return
+	}
+	w.Header().Set(headerFailureTTL, strconv.FormatInt(failureTTL.Milliseconds(), 10))
+	w.Header().Set(headerRetryAfter, strconv.Itoa(int(failureTTL.Seconds())+1))
 }
 
 // Handler returns the HTTP handler for the server.
 // Useful for testing with httptest.Server.
 func (s *CacheServer) Handler() http.Handler {
-	return s.mux
-}
-
-// Start starts the CacheServer
-func (s *CacheServer) Start() error {
-	return http.ListenAndServe(s.addr, s.mux)
+	return s.handler
 }
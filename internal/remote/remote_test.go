@@ -2,6 +2,8 @@ package remote
 
 import (
 	"bytes"
+	"crypto/rand"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -55,6 +57,28 @@ func doPut(t *testing.T, ts *httptest.Server, key string, value []byte) *http.Re
 	return resp
 }
 
+// doPutWithToken is like doPut but presents the promise token from a prior POST
+func doPutWithToken(t *testing.T, ts *httptest.Server, key string, value []byte, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/cache/"+url.PathEscape(key), bytes.NewReader(value))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.ContentLength = int64(len(value))
+	req.Header.Set("x-jc-promise-token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+// promiseToken returns the promise token granted by a POST response
+func promiseToken(resp *http.Response) string {
+	return resp.Header.Get("x-jc-promise-token")
+}
+
 func doPost(t *testing.T, ts *httptest.Server, key string) *http.Response {
 	t.Helper()
 	resp, err := http.Post(ts.URL+"/cache/"+url.PathEscape(key), "application/octet-stream", nil)
@@ -85,7 +109,7 @@ func doPostAndPut(t *testing.T, ts *httptest.Server, key string, value []byte) *
 		t.Fatalf("POST /cache/%s: expected 202, got %d", key, postResp.StatusCode)
 	}
 	// Then PUT to upload
-	return doPut(t, ts, key, value)
+	return doPutWithToken(t, ts, key, value, promiseToken(postResp))
 }
 
 func readBody(t *testing.T, resp *http.Response) string {
@@ -369,7 +393,10 @@ func TestPut_InsufficientStorage(t *testing.T) {
 	largeValue := bytes.Repeat([]byte("x"), 100)
 	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/key", nil)
 	req.Header.Set("x-jc-size", strconv.Itoa(len(largeValue)))
-	resp, _ := http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
 	defer resp.Body.Close()
 
 	assertStatus(t, resp, http.StatusInsufficientStorage)
@@ -400,7 +427,7 @@ func TestPut_EmptyValue(t *testing.T) {
 	postResp.Body.Close()
 
 	// Then try to PUT empty value
-	resp := doPut(t, ts, "key", []byte{})
+	resp := doPutWithToken(t, ts, "key", []byte{}, promiseToken(postResp))
 	defer resp.Body.Close()
 
 	assertStatus(t, resp, http.StatusBadRequest)
@@ -442,7 +469,7 @@ func TestPut_SizeMismatch(t *testing.T) {
 	assertStatus(t, postResp, http.StatusAccepted)
 
 	// Try to PUT with different size
-	resp := doPut(t, ts, "sizekey", []byte("short")) // 5 bytes, not 10
+	resp := doPutWithToken(t, ts, "sizekey", []byte("short"), promiseToken(postResp)) // 5 bytes, not 10
 	defer resp.Body.Close()
 
 	assertStatus(t, resp, http.StatusConflict)
@@ -480,7 +507,7 @@ func TestPut_TerminalErrorReleasesPromise(t *testing.T) {
 	assertStatus(t, postResp, http.StatusAccepted)
 
 	// PUT with wrong size (terminal error: size mismatch)
-	putResp := doPut(t, ts, "terminalkey", []byte("wrong")) // 5 bytes, not 10
+	putResp := doPutWithToken(t, ts, "terminalkey", []byte("wrong"), promiseToken(postResp)) // 5 bytes, not 10
 	putResp.Body.Close()
 	assertStatus(t, putResp, http.StatusConflict)
 
@@ -503,6 +530,7 @@ func TestPut_TruncatedBody(t *testing.T) {
 	// Use httptest to send a request with Content-Length > actual body
 	req := httptest.NewRequest(http.MethodPut, "/cache/trunckey", bytes.NewReader([]byte("short")))
 	req.ContentLength = 100 // Claim 100 bytes but only send 5
+	req.Header.Set("x-jc-promise-token", promiseToken(postResp))
 	rr := httptest.NewRecorder()
 
 	cs.mux.ServeHTTP(rr, req)
@@ -527,7 +555,7 @@ func TestPut_EmptyValueReleasesPromise(t *testing.T) {
 	assertStatus(t, postResp, http.StatusAccepted)
 
 	// PUT with empty value (terminal error)
-	putResp := doPut(t, ts, "emptykey", []byte{})
+	putResp := doPutWithToken(t, ts, "emptykey", []byte{}, promiseToken(postResp))
 	putResp.Body.Close()
 	assertStatus(t, putResp, http.StatusBadRequest)
 
@@ -756,7 +784,10 @@ func TestPost_CustomPromiseTTL(t *testing.T) {
 	// Create promise with custom TTL (5 seconds)
 	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/customttlkey", nil)
 	req.Header.Set("x-jc-promise-ttl", "5000") // 5 seconds
-	resp, _ := http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
 	defer resp.Body.Close()
 	assertStatus(t, resp, http.StatusAccepted)
 
@@ -801,7 +832,7 @@ func TestPut_FulfillsPromise(t *testing.T) {
 	assertStatus(t, postResp, http.StatusAccepted)
 
 	// PUT fulfills promise
-	putResp := doPut(t, ts, "fulfillkey", []byte("value"))
+	putResp := doPutWithToken(t, ts, "fulfillkey", []byte("value"), promiseToken(postResp))
 	putResp.Body.Close()
 	assertStatus(t, putResp, http.StatusOK)
 
@@ -819,7 +850,7 @@ func TestMethodNotAllowed(t *testing.T) {
 	_, ts := newTestServer(1000)
 	defer ts.Close()
 
-	methods := []string{http.MethodDelete, http.MethodPatch, http.MethodHead}
+	methods := []string{http.MethodPatch, http.MethodHead}
 
 	for _, method := range methods {
 		t.Run(method, func(t *testing.T) {
@@ -849,7 +880,7 @@ func TestFullWorkflow_PostPutGet(t *testing.T) {
 	assertStatus(t, postResp, http.StatusAccepted)
 
 	// 2. PUT the value
-	putResp := doPut(t, ts, "workflow-key", []byte("workflow-value"))
+	putResp := doPutWithToken(t, ts, "workflow-key", []byte("workflow-value"), promiseToken(postResp))
 	putResp.Body.Close()
 	assertStatus(t, putResp, http.StatusOK)
 
@@ -961,6 +992,7 @@ func TestPut_WithTTLHeader(t *testing.T) {
 	// PUT with custom TTL (500ms)
 	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/ttlkey", bytes.NewReader([]byte("value")))
 	req.ContentLength = 5
+	req.Header.Set("x-jc-promise-token", promiseToken(postResp))
 	req.Header.Set("x-jc-ttl", "500") // 500 milliseconds
 
 	resp, err := http.DefaultClient.Do(req)
@@ -996,6 +1028,7 @@ func TestPut_WithTTLHeader_VerifyRemainingTTL(t *testing.T) {
 	// PUT with 10 second TTL
 	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/ttlkey2", bytes.NewReader([]byte("value")))
 	req.ContentLength = 5
+	req.Header.Set("x-jc-promise-token", promiseToken(postResp))
 	req.Header.Set("x-jc-ttl", "10000") // 10 seconds
 
 	resp, err := http.DefaultClient.Do(req)
@@ -1072,6 +1105,7 @@ func TestPut_InvalidTTLHeader(t *testing.T) {
 			req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/invalidttl-"+tt.name, bytes.NewReader([]byte("value")))
 			req.ContentLength = 5
 			req.Header.Set("x-jc-ttl", tt.value)
+			req.Header.Set("x-jc-promise-token", promiseToken(postResp))
 
 			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -1191,3 +1225,911 @@ func TestConcurrentRequests(t *testing.T) {
 		<-done
 	}
 }
+
+func TestGet_SuperhotHeader(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("hotkey", []byte("value"), time.Hour)
+	store.Put("coldkey", []byte("value"), time.Hour)
+	cs := NewCacheServer(":0", store, WithSuperhotConfig(SuperhotConfig{MinHits: 3, DecayInterval: time.Hour}))
+	ts := httptest.NewServer(cs.Handler())
+	defer ts.Close()
+	defer cs.Stop()
+
+	for i := 0; i < 2; i++ {
+		resp := doGet(t, ts, "hotkey")
+		resp.Body.Close()
+		assertHeader(t, resp, "x-jc-superhot", "false")
+	}
+
+	resp := doGet(t, ts, "hotkey")
+	resp.Body.Close()
+	assertHeader(t, resp, "x-jc-superhot", "true")
+
+	resp = doGet(t, ts, "coldkey")
+	resp.Body.Close()
+	assertHeader(t, resp, "x-jc-superhot", "false")
+
+	// POST on an existing superhot key reports it without counting
+	resp = doPost(t, ts, "hotkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "x-jc-superhot", "true")
+}
+
+// ============================================================================
+// DELETE Tests
+// ============================================================================
+
+func doDelete(t *testing.T, ts *httptest.Server, key string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/cache/"+url.PathEscape(key), nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+func TestDelete_Existing(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPostAndPut(t, ts, "delkey", []byte("value"))
+	resp.Body.Close()
+
+	resp = doDelete(t, ts, "delkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	resp = doGet(t, ts, "delkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+}
+
+func TestDelete_Missing(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doDelete(t, ts, "missing")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+}
+
+func TestDelete_InvalidPath(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/invalid/key", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestDelete_ClearsPromise(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "promisedkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+
+	resp = doDelete(t, ts, "promisedkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+
+	if cs.promises.Exists("promisedkey") {
+		t.Error("DELETE should clear the outstanding promise")
+	}
+
+	// The in-flight upload of the old value is rejected
+	resp = doPut(t, ts, "promisedkey", []byte("stale"))
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+}
+
+// ============================================================================
+// Promise Token Tests
+// ============================================================================
+
+func TestPost_ReturnsPromiseToken(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "tokenkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+	assertHeaderExists(t, resp, "x-jc-promise-token")
+
+	// Conflicting POSTs don't learn the token
+	resp = doPost(t, ts, "tokenkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+	assertHeader(t, resp, "x-jc-promise-token", "")
+}
+
+func TestPost_TokenGenerationFails(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	randRead = func(b []byte) (int, error) { return 0, errors.New("entropy unavailable") }
+	defer func() { randRead = rand.Read }()
+
+	resp := doPost(t, ts, "tokenkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusInternalServerError)
+}
+
+func TestPost_DryRunNoToken(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/dryrunkey", nil)
+	req.Header.Set("x-jc-dryrun", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+	assertHeader(t, resp, "x-jc-promise-token", "")
+}
+
+// doPromiseAction sends a POST with x-jc-promise-action for the token
+func doPromiseAction(t *testing.T, ts *httptest.Server, key, action, token string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/"+url.PathEscape(key), nil)
+	req.Header.Set("x-jc-promise-action", action)
+	req.Header.Set("x-jc-promise-token", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+func TestPost_RenewPromise(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/renewkey", nil)
+	req.Header.Set("x-jc-promise-ttl", "100")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/cache/renewkey", nil)
+	req.Header.Set("x-jc-promise-action", "renew")
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-promise-ttl", "60000")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	ttl, _ := strconv.ParseInt(resp.Header.Get("x-jc-promise-ttl"), 10, 64)
+	if ttl < 50000 || ttl > 60000 {
+		t.Errorf("x-jc-promise-ttl = %d, want about 60000", ttl)
+	}
+
+	// The promise outlives its original TTL and still accepts the upload
+	time.Sleep(150 * time.Millisecond)
+	resp = doPutWithToken(t, ts, "renewkey", []byte("value"), token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	if got := cs.Stats().Promises.Renewed; got != 1 {
+		t.Errorf("Renewed = %d, want 1", got)
+	}
+}
+
+func TestPost_AbandonPromise(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "abandonkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	resp = doPromiseAction(t, ts, "abandonkey", "abandon", token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	// Another client can take over right away
+	resp = doPost(t, ts, "abandonkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+
+	// The abandoned token can't upload
+	resp = doPutWithToken(t, ts, "abandonkey", []byte("value"), token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+
+	if got := cs.Stats().Promises.Released; got != 1 {
+		t.Errorf("Released = %d, want 1", got)
+	}
+}
+
+func TestPost_PromiseActionNotHeld(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "heldkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	for _, action := range []string{"renew", "abandon"} {
+		resp = doPromiseAction(t, ts, "heldkey", action, "wrong")
+		resp.Body.Close()
+		assertStatus(t, resp, http.StatusConflict)
+
+		resp = doPromiseAction(t, ts, "otherkey", action, token)
+		resp.Body.Close()
+		assertStatus(t, resp, http.StatusConflict)
+	}
+
+	// The real holder is unaffected
+	resp = doPutWithToken(t, ts, "heldkey", []byte("value"), token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+}
+
+func TestPost_FailPromise(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "failkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	// A waiter long-polls the promise. The test helpers can't fail the test
+	// from another goroutine, so a failed request is sent as nil.
+	waited := make(chan *http.Response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cache/failkey", nil)
+		req.Header.Set("x-jc-wait", "5000")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			resp = nil
+		}
+		waited <- resp
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/failkey", nil)
+	req.Header.Set("x-jc-promise-action", "fail")
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-failure-ttl", "60000")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	// The waiter learns of the failure
+	resp = <-waited
+	if resp == nil {
+		t.Fatal("long-polled GET failed")
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+	assertHeaderExists(t, resp, "x-jc-failure-ttl")
+
+	// New promises are held off with the failure's TTL
+	resp = doPost(t, ts, "failkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+	ttl, _ := strconv.ParseInt(resp.Header.Get("x-jc-failure-ttl"), 10, 64)
+	if ttl < 50000 || ttl > 60000 {
+		t.Errorf("x-jc-failure-ttl = %d, want about 60000", ttl)
+	}
+	assertHeader(t, resp, "Retry-After", "60")
+	assertHeader(t, resp, "x-jc-promise-token", "")
+
+	// DELETE clears it
+	req, _ = http.NewRequest(http.MethodDelete, ts.URL+"/cache/failkey", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	resp.Body.Close()
+	resp = doPost(t, ts, "failkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+}
+
+func TestPost_FailureTTLClamped(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "failkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/failkey", nil)
+	req.Header.Set("x-jc-promise-action", "fail")
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-failure-ttl", strconv.FormatInt(24*time.Hour.Milliseconds(), 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	// The failure lasts at most maxFailureTTL
+	resp = doPost(t, ts, "failkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+	ttl, _ := strconv.ParseInt(resp.Header.Get("x-jc-failure-ttl"), 10, 64)
+	if ttl <= 0 || ttl > maxFailureTTL.Milliseconds() {
+		t.Errorf("x-jc-failure-ttl = %d, want at most %d", ttl, maxFailureTTL.Milliseconds())
+	}
+}
+
+func TestPost_InvalidFailureTTL(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "failkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/failkey", nil)
+	req.Header.Set("x-jc-promise-action", "fail")
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-failure-ttl", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	// The promise is still held
+	resp = doPromiseAction(t, ts, "failkey", "fail", token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+}
+
+func TestPost_InvalidPromiseAction(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "badaction")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	resp = doPromiseAction(t, ts, "badaction", "extend", token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	resp = doPromiseAction(t, ts, "badaction", "renew", "")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/badaction", nil)
+	req.Header.Set("x-jc-promise-action", "renew")
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-promise-ttl", "-5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+}
+
+// doPutNegative stores a negative entry under the token's promise
+func doPutNegative(t *testing.T, ts *httptest.Server, key, token string, body []byte) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/"+url.PathEscape(key), bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("x-jc-promise-token", token)
+	req.Header.Set("x-jc-negative", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+func TestPut_NegativeEntry(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPostWithSize(t, ts, "negkey", 10)
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	// The promised size doesn't apply to a negative entry
+	resp = doPutNegative(t, ts, "negkey", token, nil)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	if cs.promises.Exists("negkey") {
+		t.Error("storing a negative entry should fulfill the promise")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cache/negkey", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "x-jc-negative", "true")
+	assertHeader(t, resp, "x-jc-size", "0")
+	if body := readBody(t, resp); body != "" {
+		t.Errorf("body = %q, want empty", body)
+	}
+	ttl, _ := strconv.ParseInt(resp.Header.Get("x-jc-ttl"), 10, 64)
+	if ttl <= 0 || ttl > 60000 {
+		t.Errorf("x-jc-ttl = %d, want up to the 1 minute default", ttl)
+	}
+
+	// POST reports the key as existing
+	resp = doPost(t, ts, "negkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "x-jc-negative", "true")
+}
+
+func TestPut_NegativeEntryWithBody(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "negkey")
+	resp.Body.Close()
+	token := promiseToken(resp)
+
+	resp = doPutNegative(t, ts, "negkey", token, []byte("value"))
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusBadRequest)
+
+	// The promise is kept so the client can retry
+	resp = doPutNegative(t, ts, "negkey", token, nil)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+}
+
+func TestGet_ValueNotNegative(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPostAndPut(t, ts, "key", []byte("value"))
+	resp.Body.Close()
+
+	resp = doGet(t, ts, "key")
+	resp.Body.Close()
+	assertHeader(t, resp, "x-jc-negative", "")
+}
+
+func TestPut_MissingToken(t *testing.T) {
+	cs, ts := newTestServer(1000)
+	defer ts.Close()
+
+	postResp := doPost(t, ts, "key")
+	postResp.Body.Close()
+
+	resp := doPut(t, ts, "key", []byte("value"))
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+
+	// The real holder's promise is untouched
+	if !cs.promises.Exists("key") {
+		t.Error("rejected PUT should not release the promise")
+	}
+}
+
+func TestPut_WrongToken(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	postResp := doPost(t, ts, "key")
+	postResp.Body.Close()
+
+	resp := doPutWithToken(t, ts, "key", []byte("injected"), "not-the-token")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+
+	// The holder can still upload
+	resp = doPutWithToken(t, ts, "key", []byte("value"), promiseToken(postResp))
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	if body := readBody(t, doGet(t, ts, "key")); body != "value" {
+		t.Errorf("GET body = %q, want %q", body, "value")
+	}
+}
+
+func TestPut_StaleTokenAfterExpiry(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/key", nil)
+	req.Header.Set("x-jc-promise-ttl", "50")
+	staleResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	staleResp.Body.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Another client gets a new promise after expiry
+	freshResp := doPost(t, ts, "key")
+	freshResp.Body.Close()
+	assertStatus(t, freshResp, http.StatusAccepted)
+
+	// The original holder's late PUT is rejected
+	resp := doPutWithToken(t, ts, "key", []byte("late"), promiseToken(staleResp))
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+}
+
+// ============================================================================
+// Long-poll Tests
+// ============================================================================
+
+func doGetWithWait(t *testing.T, ts *httptest.Server, key, waitMs string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/cache/"+url.PathEscape(key), nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("x-jc-wait", waitMs)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+func TestGet_WaitReturnsValueWhenPutLands(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "waitkey")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+	token := promiseToken(resp)
+
+	// The test helpers can't fail the test from another goroutine
+	putErr := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/cache/waitkey", strings.NewReader("value"))
+		req.Header.Set("x-jc-promise-token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		putErr <- err
+	}()
+
+	start := time.Now()
+	resp = doGetWithWait(t, ts, "waitkey", "5000")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "value" {
+		t.Errorf("body = %q, want %q", body, "value")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GET returned after %v, want as soon as the PUT lands", elapsed)
+	}
+	if err := <-putErr; err != nil {
+		t.Errorf("PUT failed: %v", err)
+	}
+}
+
+func TestGet_WaitWithoutPromiseReturnsImmediately(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	start := time.Now()
+	resp := doGetWithWait(t, ts, "missing", "5000")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GET took %v, want immediate 404", elapsed)
+	}
+}
+
+func TestGet_WaitTimesOut(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "slowkey")
+	resp.Body.Close()
+
+	start := time.Now()
+	resp = doGetWithWait(t, ts, "slowkey", "100")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("GET returned after %v, want to wait 100ms", elapsed)
+	}
+}
+
+func TestGet_WaitEndsWhenPromiseExpires(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cache/expirekey", nil)
+	req.Header.Set("x-jc-promise-ttl", "100")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	resp = doGetWithWait(t, ts, "expirekey", "5000")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GET returned after %v, want shortly after the promise expires", elapsed)
+	}
+}
+
+func TestGet_InvalidWaitHeader(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	for _, wait := range []string{"abc", "-1", "1.5"} {
+		resp := doGetWithWait(t, ts, "key", wait)
+		resp.Body.Close()
+		assertStatus(t, resp, http.StatusBadRequest)
+	}
+}
+
+// ============================================================================
+// Streaming PUT Tests
+// ============================================================================
+
+// countingReader records how many bytes were read from it
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestPut_InsufficientStorageDecidedBeforeBody(t *testing.T) {
+	store := storage.NewInMemoryStorage(100)
+	cs := NewCacheServer(":0", store)
+	defer cs.Stop()
+
+	// Another upload holds most of the capacity
+	reservation, err := store.Reserve("other", 80)
+	if err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	defer reservation.Release()
+
+	token, _ := cs.promises.CreateWithToken("key", -1, time.Minute)
+
+	body := &countingReader{r: bytes.NewReader(make([]byte, 50))}
+	req := httptest.NewRequest(http.MethodPut, "/cache/key", body)
+	req.ContentLength = 50
+	req.Header.Set("x-jc-promise-token", token)
+	rr := httptest.NewRecorder()
+
+	cs.mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Errorf("StatusCode = %d, want %d", rr.Code, http.StatusInsufficientStorage)
+	}
+	if body.read != 0 {
+		t.Errorf("read %d body bytes, want 0", body.read)
+	}
+	// Transient: the uploader keeps its promise
+	if !cs.promises.Exists("key") {
+		t.Error("promise should be kept after a 507")
+	}
+}
+
+func TestPut_ReleasesReservationOnTruncatedBody(t *testing.T) {
+	store := storage.NewInMemoryStorage(100)
+	cs := NewCacheServer(":0", store)
+	defer cs.Stop()
+
+	token, _ := cs.promises.CreateWithToken("key", -1, time.Minute)
+
+	req := httptest.NewRequest(http.MethodPut, "/cache/key", bytes.NewReader([]byte("short")))
+	req.ContentLength = 90
+	req.Header.Set("x-jc-promise-token", token)
+	rr := httptest.NewRecorder()
+	cs.mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	// The full capacity is available again
+	reservation, err := store.Reserve("other", 90)
+	if err != nil {
+		t.Fatalf("Reserve after truncated PUT error = %v", err)
+	}
+	reservation.Release()
+}
+
+// ============================================================================
+// Range Tests
+// ============================================================================
+
+func doGetWithRange(t *testing.T, ts *httptest.Server, key, rangeHeader string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/cache/"+url.PathEscape(key), nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Range", rangeHeader)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /cache/%s failed: %v", key, err)
+	}
+	return resp
+}
+
+func TestGet_Range(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("rangekey", []byte("0123456789"), time.Hour)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	resp := doGetWithRange(t, ts, "rangekey", "bytes=2-5")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusPartialContent)
+	assertHeader(t, resp, "Content-Range", "bytes 2-5/10")
+	assertHeader(t, resp, "x-jc-size", "10")
+	if body := readBody(t, resp); body != "2345" {
+		t.Errorf("body = %q, want %q", body, "2345")
+	}
+
+	resp2 := doGetWithRange(t, ts, "rangekey", "bytes=-3")
+	defer resp2.Body.Close()
+	assertStatus(t, resp2, http.StatusPartialContent)
+	assertHeader(t, resp2, "Content-Range", "bytes 7-9/10")
+	if body := readBody(t, resp2); body != "789" {
+		t.Errorf("body = %q, want %q", body, "789")
+	}
+}
+
+func TestGet_RangeNotSatisfiable(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("rangekey", []byte("0123456789"), time.Hour)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	resp := doGetWithRange(t, ts, "rangekey", "bytes=10-20")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusRequestedRangeNotSatisfiable)
+	assertHeader(t, resp, "Content-Range", "bytes */10")
+}
+
+func TestGet_RangeIgnoredServesFullValue(t *testing.T) {
+	store := storage.NewInMemoryStorage(1000)
+	store.Put("rangekey", []byte("0123456789"), time.Hour)
+	_, ts := newTestServerWithStorage(store)
+	defer ts.Close()
+
+	resp := doGetWithRange(t, ts, "rangekey", "bytes=0-1,4-5")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "Accept-Ranges", "bytes")
+	if body := readBody(t, resp); body != "0123456789" {
+		t.Errorf("body = %q, want the full value", body)
+	}
+}
+
+func TestGet_RangeMiss(t *testing.T) {
+	_, ts := newTestServer(1000)
+	defer ts.Close()
+
+	resp := doGetWithRange(t, ts, "missing", "bytes=0-4")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusNotFound)
+}
+
+// newStaleTestServer returns a server whose storage holds "key" as a stale entry
+func newStaleTestServer(t *testing.T) (*CacheServer, *httptest.Server) {
+	t.Helper()
+	store := storage.NewInMemoryStorage(1000, storage.StorageOptions{StaleGrace: time.Hour})
+	if err := store.Put("key", []byte("old"), 10*time.Millisecond); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	return newTestServerWithStorage(store)
+}
+
+func doGetWithRefresh(t *testing.T, ts *httptest.Server, key string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cache/"+url.PathEscape(key), nil)
+	req.Header.Set("x-jc-refresh", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	return resp
+}
+
+func TestGet_StaleEntry(t *testing.T) {
+	_, ts := newStaleTestServer(t)
+	defer ts.Close()
+
+	resp := doGet(t, ts, "key")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "x-jc-stale", "true")
+	assertHeader(t, resp, "x-jc-ttl", "0")
+	// Only clients that ask get a promise to refresh
+	assertHeader(t, resp, "x-jc-promise-token", "")
+	if body := readBody(t, resp); body != "old" {
+		t.Errorf("body = %q, want %q", body, "old")
+	}
+}
+
+func TestGet_StaleEntryRefresh(t *testing.T) {
+	cs, ts := newStaleTestServer(t)
+	defer ts.Close()
+
+	resp := doGetWithRefresh(t, ts, "key")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "x-jc-stale", "true")
+	assertHeaderExists(t, resp, "x-jc-promise-ttl")
+	token := promiseToken(resp)
+	if token == "" {
+		t.Fatal("first refresh GET should get a promise token")
+	}
+
+	// Everyone else keeps reading the stale value without a promise
+	resp = doGetWithRefresh(t, ts, "key")
+	resp.Body.Close()
+	assertHeader(t, resp, "x-jc-stale", "true")
+	assertHeader(t, resp, "x-jc-promise-token", "")
+	resp = doPost(t, ts, "key")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusConflict)
+
+	resp = doPutWithToken(t, ts, "key", []byte("new"), token)
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	if cs.promises.Exists("key") {
+		t.Error("refreshing the value should fulfill the promise")
+	}
+
+	resp = doGet(t, ts, "key")
+	defer resp.Body.Close()
+	assertHeader(t, resp, "x-jc-stale", "")
+	if body := readBody(t, resp); body != "new" {
+		t.Errorf("body = %q, want %q", body, "new")
+	}
+}
+
+func TestPost_StaleEntryAccepted(t *testing.T) {
+	_, ts := newStaleTestServer(t)
+	defer ts.Close()
+
+	resp := doPost(t, ts, "key")
+	resp.Body.Close()
+	assertStatus(t, resp, http.StatusAccepted)
+	assertHeaderExists(t, resp, "x-jc-promise-token")
+}
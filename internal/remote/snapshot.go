@@ -0,0 +1,82 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// SaveSnapshot writes the storage to the snapshot path.
+// The snapshot is written to a temporary file and renamed into place, so a
+// crash never leaves a partial snapshot behind.
+// It is a no-op if no path is set or the storage can't be snapshotted.
+func (s *CacheServer) SaveSnapshot() error {
+	snapshotter, ok := s.storage.(storage.Snapshotter)
+	if s.snapshotPath == "" || !ok {
+		return nil
+	}
+
+	tmpPath := s.snapshotPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	if err := snapshotter.Snapshot(file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return os.Rename(tmpPath, s.snapshotPath)
+}
+
+// RestoreSnapshot loads the snapshot at the snapshot path into the storage,
+// then removes the file so a later crash can't restore outdated entries.
+// Start calls it; call it before serving Handler directly.
+// It is a no-op if no path is set, no snapshot was saved yet, or the storage
+// can't be snapshotted. A corrupt or unsupported snapshot is logged and moved
+// aside to the path with a ".bad" suffix, and the server starts empty.
+func (s *CacheServer) RestoreSnapshot() error {
+	snapshotter, ok := s.storage.(storage.Snapshotter)
+	if s.snapshotPath == "" || !ok {
+		return nil
+	}
+
+	file, err := os.Open(s.snapshotPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("opening snapshot: %w", err)
+	}
+	err = snapshotter.Restore(file)
+	file.Close()
+	if errors.Is(err, storage.ErrSnapshotCorrupt) || errors.Is(err, storage.ErrUnsupportedSnapshot) {
+		// Nothing was loaded; keep the file for inspection and start empty
+		badPath := s.snapshotPath + ".bad"
+		if renameErr := os.Rename(s.snapshotPath, badPath); renameErr != nil {
+			return fmt.Errorf("moving aside snapshot: %w", renameErr)
+		}
+		log.Printf("restoring snapshot %s: %v; moved it to %s and starting empty", s.snapshotPath, err, badPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("restoring snapshot: %w", err)
+	}
+
+	if err := os.Remove(s.snapshotPath); err != nil {
+		return fmt.Errorf("removing restored snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+func TestSnapshot_ShutdownSavesAndRestoreLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024*1024), WithSnapshotPath(path))
+	ts := httptest.NewServer(cs.Handler())
+	assertStatus(t, doPostAndPut(t, ts, "warm", []byte("value")), http.StatusOK)
+	ts.Close()
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary snapshot left behind: %v", err)
+	}
+
+	// The usual Stop after Shutdown doesn't write the snapshot again
+	os.Rename(path, path+".saved")
+	cs.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Stop() saved the snapshot again: %v", err)
+	}
+	os.Rename(path+".saved", path)
+
+	restarted := NewCacheServer(":0", storage.NewInMemoryStorage(1024*1024), WithSnapshotPath(path))
+	defer restarted.Stop()
+	if err := restarted.RestoreSnapshot(); err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("restored snapshot left behind: %v", err)
+	}
+	ts = httptest.NewServer(restarted.Handler())
+	defer ts.Close()
+
+	resp := doGet(t, ts, "warm")
+	assertStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); body != "value" {
+		t.Errorf("body = %q, want %q", body, "value")
+	}
+}
+
+func TestSnapshot_MissingFileIsNotAnError(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024), WithSnapshotPath(filepath.Join(t.TempDir(), "missing")))
+	defer cs.Stop()
+
+	if err := cs.RestoreSnapshot(); err != nil {
+		t.Errorf("RestoreSnapshot() error = %v, want nil", err)
+	}
+}
+
+func TestSnapshot_BadFileMovedAside(t *testing.T) {
+	var valid bytes.Buffer
+	store := storage.NewInMemoryStorage(1024)
+	store.Put("key", []byte("value"), time.Hour)
+	store.Snapshot(&valid)
+
+	tests := []struct {
+		name     string
+		contents []byte
+	}{
+		{"corrupt", []byte("garbage")},
+		{"truncated", valid.Bytes()[:valid.Len()-6]},
+		{"old version", []byte("JCSN\x00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot")
+			os.WriteFile(path, tt.contents, 0o644)
+
+			cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024), WithSnapshotPath(path))
+			defer cs.Stop()
+
+			if err := cs.RestoreSnapshot(); err != nil {
+				t.Fatalf("RestoreSnapshot() error = %v, want nil", err)
+			}
+			if _, err := os.Stat(path + ".bad"); err != nil {
+				t.Errorf("bad snapshot not moved aside: %v", err)
+			}
+			if _, err := cs.storage.Get("key"); err != storage.ErrKeyNotFound {
+				t.Errorf("Get() error = %v, want an empty storage", err)
+			}
+		})
+	}
+}
+
+func TestSnapshot_NoPath(t *testing.T) {
+	cs := NewCacheServer(":0", storage.NewInMemoryStorage(1024))
+	defer cs.Stop()
+	if err := cs.SaveSnapshot(); err != nil {
+		t.Errorf("SaveSnapshot() without snapshot path error = %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/satmihir/justcache/internal/storage"
+)
+
+// Reserved admin path serving the server stats as JSON. It is outside
+// cachePathPrefix, so it can't collide with a key.
+const statsPath = "/_admin/stats"
+
+// ServerStats is a point-in-time view of the server's counters
+type ServerStats struct {
+	// Storage is omitted if the storage doesn't implement storage.StatsReporter
+	Storage  *storage.Stats `json:"storage,omitempty"`
+	Promises PromiseStats   `json:"promises"`
+}
+
+// Stats returns the storage and promise counters
+func (s *CacheServer) Stats() ServerStats {
+	stats := ServerStats{Promises: s.promises.Stats()}
+	if reporter, ok := s.storage.(storage.StatsReporter); ok {
+		storageStats := reporter.Stats()
+		stats.Storage = &storageStats
+	}
+	return stats
+}
+
+// handleStats serves GET /_admin/stats
+func (s *CacheServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.Stats())
+}
@@ -0,0 +1,107 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStats_Endpoint(t *testing.T) {
+	cs, ts := newTestServer(1024 * 1024)
+	defer ts.Close()
+	defer cs.Stop()
+
+	assertStatus(t, doPostAndPut(t, ts, "key", []byte("value")), http.StatusOK)
+	assertStatus(t, doGet(t, ts, "key"), http.StatusOK)
+	assertStatus(t, doGet(t, ts, "missing"), http.StatusNotFound)
+
+	resp, err := http.Get(ts.URL + statsPath)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", statsPath, err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	assertHeader(t, resp, "Content-Type", "application/json")
+
+	var stats ServerStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decoding stats: %v", err)
+	}
+
+	if stats.Storage == nil {
+		t.Fatal("storage stats missing")
+	}
+	if stats.Storage.Hits != 1 || stats.Storage.Puts != 1 || stats.Storage.Items != 1 {
+		t.Errorf("storage stats = %+v, want 1 hit, 1 put, 1 item", stats.Storage)
+	}
+	// The POST's check for the key isn't a GET
+	if stats.Storage.Misses != 1 {
+		t.Errorf("misses = %d, want 1", stats.Storage.Misses)
+	}
+	if stats.Storage.MemoryUsedBytes != 8 || stats.Storage.MaxMemoryBytes != 1024*1024 {
+		t.Errorf("memory = %d/%d", stats.Storage.MemoryUsedBytes, stats.Storage.MaxMemoryBytes)
+	}
+	if stats.Promises.Created != 1 || stats.Promises.Fulfilled != 1 {
+		t.Errorf("promise stats = %+v, want 1 created, 1 fulfilled", stats.Promises)
+	}
+}
+
+func TestStats_MethodNotAllowed(t *testing.T) {
+	cs, ts := newTestServer(1024)
+	defer ts.Close()
+	defer cs.Stop()
+
+	resp, err := http.Post(ts.URL+statsPath, "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", statsPath, err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusMethodNotAllowed)
+}
+
+func TestStats_CountsConflictsAndRealGets(t *testing.T) {
+	cs, ts := newTestServer(1024 * 1024)
+	defer ts.Close()
+	defer cs.Stop()
+
+	// A POST while another promise is held, and one after an origin failure
+	resp := doPost(t, ts, "held")
+	resp.Body.Close()
+	assertStatus(t, doPost(t, ts, "held"), http.StatusConflict)
+	resp = doPost(t, ts, "failed")
+	resp.Body.Close()
+	doPromiseAction(t, ts, "failed", "fail", promiseToken(resp)).Body.Close()
+	assertStatus(t, doPost(t, ts, "failed"), http.StatusConflict)
+
+	// A long-polled GET that sees the upload land is one miss
+	resp = doPost(t, ts, "polled")
+	resp.Body.Close()
+	token := promiseToken(resp)
+	polled := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cache/polled", nil)
+		req.Header.Set("x-jc-wait", "5000")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			polled <- 0
+			return
+		}
+		resp.Body.Close()
+		polled <- resp.StatusCode
+	}()
+	time.Sleep(50 * time.Millisecond)
+	resp = doPutWithToken(t, ts, "polled", []byte("value"), token)
+	resp.Body.Close()
+	if status := <-polled; status != http.StatusOK {
+		t.Errorf("long-polled GET status = %d, want 200", status)
+	}
+
+	stats := cs.Stats()
+	if stats.Promises.Conflicts != 2 {
+		t.Errorf("conflicts = %d, want 2", stats.Promises.Conflicts)
+	}
+	if stats.Storage.Hits != 0 || stats.Storage.Misses != 1 {
+		t.Errorf("storage stats = %+v, want only the GET's miss counted", stats.Storage)
+	}
+}
@@ -0,0 +1,272 @@
+package rendezvous
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Default bound on a node's load relative to the average
+	defaultLoadFactor = 1.25
+
+	// Default interval at which recorded loads are halved
+	defaultLoadDecayInterval = 10 * time.Second
+
+	// Default load below which no node is over its bound
+	defaultMinLoad = 100
+
+	// An overloaded node is under its bound again once its load drops below
+	// this fraction of the bound, so keys don't flap between nodes
+	loadHysteresis = 0.8
+)
+
+// BoundedLoadConfig configures a BoundedLoadRouter.
+type BoundedLoadConfig struct {
+	// LoadFactor is c: no node takes more than c times the average load.
+	// Lower values balance more tightly but move more keys off their
+	// preferred nodes.
+	// Default: 1.25 (for values <= 1).
+	LoadFactor float64
+	// DecayInterval is how often recorded loads are halved, so the bound
+	// follows recent traffic.
+	// Default: 10s.
+	DecayInterval time.Duration
+	// MinLoad is the recorded load a node must reach before it can be over
+	// its bound, so that light traffic keeps keys on their preferred nodes.
+	// Below it no keys are moved, so with few nodes or little traffic per
+	// client it should be lowered for the bound to take effect.
+	// Default: 100.
+	MinLoad uint64
+}
+
+// BoundedLoadRouter routes with bounded-load consistent hashing on top of a
+// RendezvousRouter's preference order: a node whose recorded load is at its
+// bound, the larger of ceil(c * (total+1) / nodes) and MinLoad, is skipped in
+// favor of the next node in preference order until its load drops well below
+// the bound. Nodes over the bound are only returned when there aren't enough
+// nodes under it.
+//
+// GetNodes returns the nodes to write a key to. Reads should use
+// GetReadNodes, which also returns the key's preferred node when it's over
+// its bound, since it may still hold the key.
+//
+// Load is fed back with RecordRequest, e.g. by a client for every request it
+// sends. While no node is over its bound, GetNodes returns the same nodes as
+// the underlying RendezvousRouter.
+//
+// BoundedLoadRouter is safe for concurrent use. Loads are counted with
+// atomics, so routing never waits on other requests; under concurrency the
+// total load is approximate between decays.
+type BoundedLoadRouter struct {
+	router *RendezvousRouter
+	config BoundedLoadConfig
+
+	// loads stores the *loadSet of the current nodes
+	loads atomic.Value
+	// total is the sum of the recorded loads, resynced at every decay
+	total atomic.Uint64
+	// lastDecay is the time of the last decay in unix nanos
+	lastDecay atomic.Int64
+
+	// setMu serializes SetNodes
+	setMu sync.Mutex
+}
+
+// loadSet is an immutable map of node identities to their loads
+type loadSet struct {
+	nodes map[string]*nodeLoad
+}
+
+// nodeLoad is the recorded load of a node
+type nodeLoad struct {
+	requests atomic.Uint64
+	// over is set once the node reaches its bound, and cleared once its load
+	// drops below loadHysteresis of it
+	over atomic.Bool
+}
+
+func NewBoundedLoadRouter(nodes []*Node, hashConfig *HashConfig, config BoundedLoadConfig) *BoundedLoadRouter {
+	if config.LoadFactor <= 1 {
+		config.LoadFactor = defaultLoadFactor
+	}
+	if config.DecayInterval <= 0 {
+		config.DecayInterval = defaultLoadDecayInterval
+	}
+	if config.MinLoad == 0 {
+		config.MinLoad = defaultMinLoad
+	}
+
+	r := &BoundedLoadRouter{
+		router: NewRendezvousRouter(nil, hashConfig),
+		config: config,
+	}
+	r.loads.Store(&loadSet{})
+	r.lastDecay.Store(time.Now().UnixNano())
+	r.SetNodes(nodes)
+	return r
+}
+
+// SetNodes updates the nodes. Recorded loads of remaining nodes are kept.
+func (r *BoundedLoadRouter) SetNodes(nodes []*Node) {
+	r.setMu.Lock()
+	defer r.setMu.Unlock()
+
+	old := r.loads.Load().(*loadSet)
+	set := &loadSet{nodes: make(map[string]*nodeLoad, len(nodes))}
+	var total uint64
+	for _, node := range nodes {
+		load, ok := old.nodes[node.identityString]
+		if !ok {
+			load = &nodeLoad{}
+		}
+		set.nodes[node.identityString] = load
+		total += load.requests.Load()
+	}
+	r.loads.Store(set)
+	r.total.Store(total)
+	r.router.SetNodes(nodes)
+}
+
+// RecordRequest counts a request sent to the node.
+// Requests to nodes the router doesn't have are ignored.
+func (r *BoundedLoadRouter) RecordRequest(node *Node) {
+	r.recordAt(node, time.Now())
+}
+
+// recordAt is RecordRequest with an explicit clock for testing
+func (r *BoundedLoadRouter) recordAt(node *Node, now time.Time) {
+	r.decay(now)
+	if load, ok := r.loads.Load().(*loadSet).nodes[node.identityString]; ok {
+		load.requests.Add(1)
+		r.total.Add(1)
+	}
+}
+
+// GetNodes returns up to k nodes to write a key to, in preference order,
+// skipping nodes at their load bound.
+func (r *BoundedLoadRouter) GetNodes(key []byte, k int) []*Node {
+	nodes, _ := r.route(key, k, time.Now())
+	return nodes
+}
+
+// GetReadNodes returns the nodes to read a key from: those of GetNodes,
+// followed by the key's preferred node if it was skipped for being over its
+// bound, since it may have been written to before.
+func (r *BoundedLoadRouter) GetReadNodes(key []byte, k int) []*Node {
+	nodes, preferred := r.route(key, k, time.Now())
+	if preferred != nil && !slices.Contains(nodes, preferred) {
+		nodes = append(nodes, preferred)
+	}
+	return nodes
+}
+
+// getNodesAt is GetNodes with an explicit clock for testing
+func (r *BoundedLoadRouter) getNodesAt(key []byte, k int, now time.Time) []*Node {
+	nodes, _ := r.route(key, k, now)
+	return nodes
+}
+
+// route returns up to k nodes for the key, those under their bound first,
+// and the key's preferred node
+func (r *BoundedLoadRouter) route(key []byte, k int, now time.Time) ([]*Node, *Node) {
+	r.decay(now)
+	prefs := r.router.GetNodes(key, k)
+	if len(prefs) == 0 {
+		return nil, nil
+	}
+
+	set := r.loads.Load().(*loadSet)
+	bound := r.bound(set)
+	over := func(node *Node) bool {
+		load, ok := set.nodes[node.identityString]
+		return ok && load.overBound(bound)
+	}
+
+	countUnder := func(nodes []*Node) int {
+		under := 0
+		for _, node := range nodes {
+			if !over(node) {
+				under++
+			}
+		}
+		return under
+	}
+
+	// Rank more nodes until k of them are under the bound, or all are ranked
+	for n := k; len(prefs) == n && countUnder(prefs) < k; {
+		n *= 2
+		prefs = r.router.GetNodes(key, n)
+	}
+
+	result := make([]*Node, 0, min(k, len(prefs)))
+	var skipped []*Node
+	for _, node := range prefs {
+		if over(node) {
+			skipped = append(skipped, node)
+		} else if len(result) < k {
+			result = append(result, node)
+		}
+	}
+	for _, node := range skipped {
+		if len(result) < k {
+			result = append(result, node)
+		}
+	}
+	return result, prefs[0]
+}
+
+// bound returns the load at which a node is over its bound
+func (r *BoundedLoadRouter) bound(set *loadSet) uint64 {
+	if len(set.nodes) == 0 {
+		return r.config.MinLoad
+	}
+	bound := uint64(math.Ceil(r.config.LoadFactor * float64(r.total.Load()+1) / float64(len(set.nodes))))
+	return max(bound, r.config.MinLoad)
+}
+
+// overBound reports whether the node is over the bound: it reached it, and
+// its load hasn't dropped below loadHysteresis of it since
+func (l *nodeLoad) overBound(bound uint64) bool {
+	load := l.requests.Load()
+	switch {
+	case load >= bound:
+		l.over.Store(true)
+		return true
+	case float64(load) < loadHysteresis*float64(bound):
+		l.over.Store(false)
+		return false
+	}
+	return l.over.Load()
+}
+
+// decay halves all loads once per elapsed decay interval. The caller that
+// advances lastDecay does the halving and resyncs the total.
+func (r *BoundedLoadRouter) decay(now time.Time) {
+	last := r.lastDecay.Load()
+	interval := int64(r.config.DecayInterval)
+	elapsed := now.UnixNano() - last
+	if elapsed < interval {
+		return
+	}
+
+	intervals := elapsed / interval
+	if !r.lastDecay.CompareAndSwap(last, last+intervals*interval) {
+		return
+	}
+
+	shift := uint(min(intervals, 63))
+	var total uint64
+	for _, load := range r.loads.Load().(*loadSet).nodes {
+		for {
+			requests := load.requests.Load()
+			if load.requests.CompareAndSwap(requests, requests>>shift) {
+				total += requests >> shift
+				break
+			}
+		}
+	}
+	r.total.Store(total)
+}
@@ -0,0 +1,225 @@
+package rendezvous
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func boundedTestNodes() []*Node {
+	return []*Node{
+		NewNode("n1", 8080),
+		NewNode("n2", 8081),
+		NewNode("n3", 8082),
+		NewNode("n4", 8083),
+	}
+}
+
+// loadOf returns the recorded load of the node
+func loadOf(r *BoundedLoadRouter, node *Node) uint64 {
+	load, ok := r.loads.Load().(*loadSet).nodes[node.String()]
+	if !ok {
+		return 0
+	}
+	return load.requests.Load()
+}
+
+func TestBoundedLoadRouter_Interfaces(t *testing.T) {
+	var _ Router = (*BoundedLoadRouter)(nil)
+	var _ LoadRecorder = (*BoundedLoadRouter)(nil)
+	var _ ReadRouter = (*BoundedLoadRouter)(nil)
+}
+
+func TestNewBoundedLoadRouter_Defaults(t *testing.T) {
+	r := NewBoundedLoadRouter(nil, nil, BoundedLoadConfig{LoadFactor: 0.5})
+	if r.config.LoadFactor != defaultLoadFactor {
+		t.Errorf("LoadFactor = %v, want %v", r.config.LoadFactor, defaultLoadFactor)
+	}
+	if r.config.DecayInterval != defaultLoadDecayInterval {
+		t.Errorf("DecayInterval = %v, want %v", r.config.DecayInterval, defaultLoadDecayInterval)
+	}
+	if r.config.MinLoad != defaultMinLoad {
+		t.Errorf("MinLoad = %v, want %v", r.config.MinLoad, defaultMinLoad)
+	}
+	if got := r.GetNodes([]byte("key"), 1); got != nil {
+		t.Errorf("GetNodes() with no nodes = %v, want nil", got)
+	}
+}
+
+func TestBoundedLoadRouter_MatchesRendezvousWithoutLoad(t *testing.T) {
+	nodes := boundedTestNodes()
+	bounded := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{})
+	plain := NewRendezvousRouter(nodes, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		for k := 1; k <= 4; k++ {
+			if got, want := nodeIDs(bounded.GetNodes(key, k)), nodeIDs(plain.GetNodes(key, k)); got != want {
+				t.Fatalf("key %s k=%d: %s, want %s", key, k, got, want)
+			}
+		}
+	}
+}
+
+func TestBoundedLoadRouter_DefersOverloadedNode(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{LoadFactor: 1.5, MinLoad: 1})
+	key := []byte("hot")
+	prefs := NewRendezvousRouter(nodes, nil).GetNodes(key, 4)
+
+	// The preferred node takes all the traffic until it reaches its bound
+	for i := 0; i < 10; i++ {
+		r.RecordRequest(prefs[0])
+	}
+
+	if got := r.GetNodes(key, 1); nodeIDs(got) != nodeIDs(prefs[1:2]) {
+		t.Errorf("GetNodes() = %s, want %s", nodeIDs(got), prefs[1].ID())
+	}
+
+	// Writes skip the overloaded node; reads try it last, as it may hold the key
+	if got := r.GetNodes(key, 3); nodeIDs(got) != nodeIDs(prefs[1:4]) {
+		t.Errorf("GetNodes() = %s, want %s", nodeIDs(got), nodeIDs(prefs[1:4]))
+	}
+	want := []*Node{prefs[1], prefs[2], prefs[3], prefs[0]}
+	if got := r.GetReadNodes(key, 3); nodeIDs(got) != nodeIDs(want) {
+		t.Errorf("GetReadNodes() = %s, want %s", nodeIDs(got), nodeIDs(want))
+	}
+
+	// Overloaded nodes still fill up the result when there's nothing else
+	if got := r.GetNodes(key, 4); nodeIDs(got) != nodeIDs(want) {
+		t.Errorf("GetNodes() = %s, want the overloaded node last", nodeIDs(got))
+	}
+	if got := r.GetReadNodes(key, 4); nodeIDs(got) != nodeIDs(want) {
+		t.Errorf("GetReadNodes() = %s, want %s", nodeIDs(got), nodeIDs(want))
+	}
+}
+
+func TestBoundedLoadRouter_Hysteresis(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{LoadFactor: 1.5, MinLoad: 1, DecayInterval: time.Hour})
+	key := []byte("hot")
+	prefs := NewRendezvousRouter(nodes, nil).GetNodes(key, 4)
+
+	record := func(node *Node, n int) {
+		for i := 0; i < n; i++ {
+			r.RecordRequest(node)
+		}
+	}
+
+	// Over its bound of 5
+	record(prefs[0], 10)
+	if got := r.GetNodes(key, 1); got[0] == prefs[0] {
+		t.Fatal("preferred node should be over its bound")
+	}
+
+	// Under the new bound of 12, but not by enough
+	record(prefs[1], 20)
+	if got := r.GetNodes(key, 1); got[0] == prefs[0] {
+		t.Error("preferred node should stay over its bound until well under it")
+	}
+
+	// Well under the new bound of 16
+	record(prefs[2], 10)
+	if got := r.GetNodes(key, 1); got[0] != prefs[0] {
+		t.Errorf("GetNodes() = %s, want the preferred node back", nodeIDs(got))
+	}
+}
+
+func TestBoundedLoadRouter_LightTrafficStaysOnPreferredNode(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{})
+	key := []byte("key")
+	preferred := NewRendezvousRouter(nodes, nil).GetNodes(key, 1)[0]
+
+	// Two requests a second for two minutes, all for the one key
+	now := time.Unix(0, r.lastDecay.Load())
+	for i := 0; i < 240; i++ {
+		node := r.getNodesAt(key, 1, now)[0]
+		if node != preferred {
+			t.Fatalf("request %d went to %s, want the preferred node %s", i, node, preferred)
+		}
+		r.recordAt(node, now)
+		now = now.Add(500 * time.Millisecond)
+	}
+}
+
+func TestBoundedLoadRouter_BoundsLoad(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{LoadFactor: 1.25, DecayInterval: time.Hour})
+
+	// Skewed traffic: most requests go to a handful of keys
+	total := 4000
+	for i := 0; i < total; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i%3))
+		if i%4 == 0 {
+			key = []byte(fmt.Sprintf("key-%d", i))
+		}
+		r.RecordRequest(r.GetNodes(key, 1)[0])
+	}
+
+	bound := uint64(1.25*float64(total)/float64(len(nodes))) + 1
+	for _, node := range nodes {
+		if load := loadOf(r, node); load > bound {
+			t.Errorf("node %s has load %d, want at most %d", node, load, bound)
+		}
+	}
+}
+
+func TestBoundedLoadRouter_Decay(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{DecayInterval: time.Second})
+	start := time.Unix(0, r.lastDecay.Load())
+
+	for i := 0; i < 8; i++ {
+		r.recordAt(nodes[0], start)
+	}
+	r.recordAt(nodes[1], start.Add(2*time.Second))
+
+	if load, total := loadOf(r, nodes[0]), r.total.Load(); load != 2 || total != 3 {
+		t.Errorf("after two intervals: load %d, total %d, want 2 and 3", load, total)
+	}
+}
+
+func TestBoundedLoadRouter_SetNodes(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{})
+	r.RecordRequest(nodes[0])
+	r.RecordRequest(nodes[1])
+
+	// Removed nodes' loads are dropped, remaining ones kept
+	r.SetNodes(nodes[1:])
+	if total, load := r.total.Load(), loadOf(r, nodes[1]); total != 1 || load != 1 {
+		t.Errorf("n2 load %d (total %d), want only n2 with 1", load, total)
+	}
+
+	// Requests to nodes the router doesn't have are ignored
+	r.RecordRequest(nodes[0])
+	if total := r.total.Load(); total != 1 {
+		t.Errorf("total = %d after recording an unknown node, want 1", total)
+	}
+}
+
+func TestBoundedLoadRouter_Concurrent(t *testing.T) {
+	nodes := boundedTestNodes()
+	r := NewBoundedLoadRouter(nodes, nil, BoundedLoadConfig{MinLoad: 1, DecayInterval: time.Millisecond})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := []byte(fmt.Sprintf("key-%d", (w+i)%5))
+				for _, node := range r.GetNodes(key, 2) {
+					r.RecordRequest(node)
+				}
+				r.GetReadNodes(key, 2)
+				if i%100 == 0 {
+					r.SetNodes(nodes[:3+i%2])
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -3,21 +3,46 @@ package rendezvous
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"sort"
 	"sync/atomic"
 )
 
 // Represents a single node in the cluster.
 type Node struct {
-	id   string // canonical identity
-	port int
+	id     string // canonical identity
+	port   int
+	weight float64
+	zone   string
+	rack   string
 
 	identityString string // pre-computed, immutable string of node identity
 	identityHash   uint64 // pre-computed, immutable hash of node identity
 }
 
-func NewNode(id string, port int) *Node {
-	n := &Node{id: id, port: port}
+// NodeOptions configures a node.
+type NodeOptions struct {
+	// Weight is the node's share of keys relative to the other nodes, e.g.
+	// its memory size. A node with twice the weight gets twice the keys.
+	// Default: 1 (for values <= 0).
+	Weight float64
+	// Zone and Rack are the node's failure domains, e.g. its availability
+	// zone and the rack within it. Replicas are spread across them; see
+	// RendezvousRouter. A node without either label is a domain of its own.
+	Zone string
+	Rack string
+}
+
+func NewNode(id string, port int, opts ...NodeOptions) *Node {
+	var opt NodeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Weight <= 0 {
+		opt.Weight = 1
+	}
+
+	n := &Node{id: id, port: port, weight: opt.Weight, zone: opt.Zone, rack: opt.Rack}
 	n.identityString = n.computeString()
 	n.identityHash = DefaultUnsaltedHash64.Hash64([]byte(n.identityString))
 	return n
@@ -27,6 +52,54 @@ func (n *Node) computeString() string {
 	return fmt.Sprintf("%s:%d", n.id, n.port)
 }
 
+// ID returns the canonical identity of the node.
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Port returns the port the node listens on.
+func (n *Node) Port() int {
+	return n.port
+}
+
+// Weight returns the node's relative share of keys.
+func (n *Node) Weight() float64 {
+	return n.weight
+}
+
+// Zone returns the node's zone label.
+func (n *Node) Zone() string {
+	return n.zone
+}
+
+// Rack returns the node's rack label.
+func (n *Node) Rack() string {
+	return n.rack
+}
+
+// zoneKey identifies the node's zone; a node without labels is a zone of
+// its own.
+func (n *Node) zoneKey() string {
+	if n.zone == "" && n.rack == "" {
+		return "node:" + n.identityString
+	}
+	return "zone:" + n.zone
+}
+
+// rackKey identifies the node's rack within its zone; an unlabeled node is a
+// rack of its own.
+func (n *Node) rackKey() string {
+	if n.rack == "" {
+		return "node:" + n.identityString
+	}
+	return n.zoneKey() + "/rack:" + n.rack
+}
+
+// String returns the node identity in "id:port" form.
+func (n *Node) String() string {
+	return n.identityString
+}
+
 // A router tells the client where a key is or should be stored.
 type Router interface {
 	// Update the nodes in the router.
@@ -35,41 +108,98 @@ type Router interface {
 	GetNodes(key []byte, k int) []*Node
 }
 
+// LoadRecorder is implemented by routers that balance on observed load.
+// Clients report every request they send to a node.
+type LoadRecorder interface {
+	RecordRequest(node *Node)
+}
+
+// ReadRouter is implemented by routers whose GetNodes may leave out nodes
+// that still hold a key, e.g. because they're overloaded. Clients write to the
+// nodes of GetNodes and read from those of GetReadNodes.
+type ReadRouter interface {
+	// Get the nodes to read a key from: those GetNodes returns for k,
+	// followed by any others that may hold the key.
+	GetReadNodes(key []byte, k int) []*Node
+}
+
 // RendezvousRouter is safe for concurrent use.
+//
+// Nodes are scored with weighted rendezvous hashing: each node scores
+// -weight/ln(h) for a key, where h is the key+node hash mapped to (0, 1), so
+// each node's share of keys is proportional to its weight. Changing a node's
+// weight only moves keys to or from that node. If all nodes have the same
+// weight, the score order is the hash order and weights aren't computed.
+//
+// If nodes carry zone or rack labels, GetNodes spreads the k nodes across
+// failure domains: it takes nodes in score order from zones not picked yet,
+// then from racks not picked yet, then any, so one zone or rack outage
+// doesn't lose every copy when there are enough domains. The top-scored node
+// always comes first.
 type RendezvousRouter struct {
-	nodes  atomic.Value // stores []*Node
+	nodes  atomic.Value // stores *nodeSet
 	hasher Hash64
 }
 
+// nodeSet is an immutable snapshot of the router's nodes
+type nodeSet struct {
+	nodes []*Node
+	// weighted is set if the nodes don't all have the same weight
+	weighted bool
+	// spread is set if any node has a zone or rack label
+	spread bool
+}
+
 func NewRendezvousRouter(nodes []*Node, hashConfig *HashConfig) *RendezvousRouter {
 	r := &RendezvousRouter{}
 	r.hasher = NewXXH3Hash64(hashConfig)
-	r.nodes.Store(([]*Node)(nil)) // initialize with typed nil
 	r.SetNodes(nodes)
 	return r
 }
 
 func (r *RendezvousRouter) SetNodes(nodes []*Node) {
-	copied := make([]*Node, len(nodes))
-	copy(copied, nodes)
-	r.nodes.Store(copied)
+	set := &nodeSet{nodes: make([]*Node, len(nodes))}
+	copy(set.nodes, nodes)
+	for _, node := range nodes {
+		if node.weight != nodes[0].weight {
+			set.weighted = true
+		}
+		if node.zone != "" || node.rack != "" {
+			set.spread = true
+		}
+	}
+	r.nodes.Store(set)
 }
 
 type nodeScore struct {
 	node  *Node
 	score uint64
+	// weighted is the weighted score; 0 if all nodes have the same weight
+	weighted float64
 }
 
 // scoreBetter returns true if a is better than b (higher score, or same score with lower identity).
 func scoreBetter(a, b nodeScore) bool {
+	if a.weighted != b.weighted {
+		return a.weighted > b.weighted
+	}
 	if a.score != b.score {
 		return a.score > b.score
 	}
 	return a.node.identityString < b.node.identityString
 }
 
+// weightedScore returns -weight/ln(h) for the hash h mapped to (0, 1)
+func weightedScore(hash uint64, weight float64) float64 {
+	// The top 53 bits fit a float64 mantissa exactly; the half offset keeps
+	// h away from 0 and 1
+	h := (float64(hash>>11) + 0.5) / (1 << 53)
+	return -weight / math.Log(h)
+}
+
 func (r *RendezvousRouter) GetNodes(key []byte, k int) []*Node {
-	nodes := r.nodes.Load().([]*Node)
+	set := r.nodes.Load().(*nodeSet)
+	nodes := set.nodes
 
 	if len(nodes) == 0 || k <= 0 {
 		return nil
@@ -81,7 +211,11 @@ func (r *RendezvousRouter) GetNodes(key []byte, k int) []*Node {
 
 	computeScore := func(node *Node) nodeScore {
 		binary.LittleEndian.PutUint64(combinedKey[len(key):], node.identityHash)
-		return nodeScore{node: node, score: r.hasher.Hash64(combinedKey)}
+		s := nodeScore{node: node, score: r.hasher.Hash64(combinedKey)}
+		if set.weighted {
+			s.weighted = weightedScore(s.score, node.weight)
+		}
+		return s
 	}
 
 	// Fast path for k=1: single pass to find max
@@ -96,7 +230,7 @@ func (r *RendezvousRouter) GetNodes(key []byte, k int) []*Node {
 	}
 
 	// Fast path for k=2: single pass to find top 2
-	if k == 2 {
+	if k == 2 && !set.spread {
 		first := computeScore(nodes[0])
 		second := nodeScore{} // zero value, will be replaced
 
@@ -129,6 +263,9 @@ func (r *RendezvousRouter) GetNodes(key []byte, k int) []*Node {
 	if k > len(scores) {
 		k = len(scores)
 	}
+	if set.spread {
+		return spreadNodes(scores, k)
+	}
 
 	result := make([]*Node, k)
 	for i := 0; i < k; i++ {
@@ -137,3 +274,32 @@ func (r *RendezvousRouter) GetNodes(key []byte, k int) []*Node {
 
 	return result
 }
+
+// spreadNodes picks k nodes from the sorted scores, preferring zones and then
+// racks that weren't picked yet, and falling back to score order
+func spreadNodes(scores []nodeScore, k int) []*Node {
+	result := make([]*Node, 0, k)
+	picked := make([]bool, len(scores))
+	zones := make(map[string]bool, k)
+	racks := make(map[string]bool, k)
+
+	pick := func(accept func(node *Node) bool) {
+		for i, s := range scores {
+			if len(result) == k {
+				return
+			}
+			if picked[i] || !accept(s.node) {
+				continue
+			}
+			picked[i] = true
+			result = append(result, s.node)
+			zones[s.node.zoneKey()] = true
+			racks[s.node.rackKey()] = true
+		}
+	}
+	pick(func(node *Node) bool { return !zones[node.zoneKey()] })
+	pick(func(node *Node) bool { return !racks[node.rackKey()] })
+	pick(func(node *Node) bool { return true })
+
+	return result
+}
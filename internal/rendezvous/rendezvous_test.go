@@ -531,3 +531,244 @@ func TestRouterInterface(t *testing.T) {
 	var _ Router = (*RendezvousRouter)(nil)
 	var _ Router = NewRendezvousRouter(nil, nil)
 }
+
+func TestNode_Accessors(t *testing.T) {
+	node := NewNode("cache.example.com", 11211)
+
+	if node.ID() != "cache.example.com" {
+		t.Errorf("ID() = %q, want %q", node.ID(), "cache.example.com")
+	}
+	if node.Port() != 11211 {
+		t.Errorf("Port() = %d, want %d", node.Port(), 11211)
+	}
+	if node.String() != "cache.example.com:11211" {
+		t.Errorf("String() = %q, want %q", node.String(), "cache.example.com:11211")
+	}
+}
+
+func TestNewNode_Weight(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []NodeOptions
+		want float64
+	}{
+		{"default", nil, 1},
+		{"custom", []NodeOptions{{Weight: 4}}, 4},
+		{"zero", []NodeOptions{{Weight: 0}}, 1},
+		{"negative", []NodeOptions{{Weight: -2}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewNode("n1", 8080, tt.opts...).Weight(); got != tt.want {
+				t.Errorf("Weight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRendezvousRouter_WeightedDistribution(t *testing.T) {
+	nodes := []*Node{
+		NewNode("small", 8080, NodeOptions{Weight: 16}),
+		NewNode("large", 8081, NodeOptions{Weight: 64}),
+		NewNode("medium", 8082, NodeOptions{Weight: 32}),
+	}
+	router := NewRendezvousRouter(nodes, NewHashConfig([]byte("weighted-test")))
+
+	counts := make(map[string]int)
+	numKeys := 20000
+	for i := 0; i < numKeys; i++ {
+		counts[router.GetNodes([]byte(fmt.Sprintf("key-%d", i)), 1)[0].ID()]++
+	}
+
+	// Shares are proportional to weight: 1/7, 4/7 and 2/7
+	for _, node := range nodes {
+		expected := float64(numKeys) * node.Weight() / 112
+		if got := float64(counts[node.ID()]); got < expected*0.9 || got > expected*1.1 {
+			t.Errorf("node %s has %v keys, expected ~%v", node.ID(), got, expected)
+		}
+	}
+}
+
+func TestRendezvousRouter_EqualWeightsMatchUnweighted(t *testing.T) {
+	plain := NewRendezvousRouter([]*Node{NewNode("n1", 8080), NewNode("n2", 8081), NewNode("n3", 8082)}, nil)
+	weighted := NewRendezvousRouter([]*Node{
+		NewNode("n1", 8080, NodeOptions{Weight: 8}),
+		NewNode("n2", 8081, NodeOptions{Weight: 8}),
+		NewNode("n3", 8082, NodeOptions{Weight: 8}),
+	}, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		for k := 1; k <= 3; k++ {
+			if got, want := nodeIDs(weighted.GetNodes(key, k)), nodeIDs(plain.GetNodes(key, k)); got != want {
+				t.Fatalf("key %s k=%d: weighted %s, unweighted %s", key, k, got, want)
+			}
+		}
+	}
+}
+
+func TestRendezvousRouter_WeightChangeMovesMinimally(t *testing.T) {
+	before := NewRendezvousRouter([]*Node{
+		NewNode("n1", 8080, NodeOptions{Weight: 1}),
+		NewNode("n2", 8081, NodeOptions{Weight: 2}),
+		NewNode("n3", 8082, NodeOptions{Weight: 3}),
+	}, nil)
+	after := NewRendezvousRouter([]*Node{
+		NewNode("n1", 8080, NodeOptions{Weight: 1}),
+		NewNode("n2", 8081, NodeOptions{Weight: 4}),
+		NewNode("n3", 8082, NodeOptions{Weight: 3}),
+	}, nil)
+	removed := NewRendezvousRouter([]*Node{
+		NewNode("n1", 8080, NodeOptions{Weight: 1}),
+		NewNode("n3", 8082, NodeOptions{Weight: 3}),
+	}, nil)
+
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		old := before.GetNodes(key, 1)[0].ID()
+
+		// Growing n2 only moves keys to n2
+		if now := after.GetNodes(key, 1)[0].ID(); now != old {
+			moved++
+			if now != "n2" {
+				t.Fatalf("key %s moved from %s to %s, want only moves to n2", key, old, now)
+			}
+		}
+		// Removing n2 only moves the keys n2 had
+		if now := removed.GetNodes(key, 1)[0].ID(); now != old && old != "n2" {
+			t.Fatalf("key %s moved from %s to %s after removing n2", key, old, now)
+		}
+	}
+	if moved == 0 {
+		t.Error("growing a node's weight should move keys to it")
+	}
+}
+
+// nodeIDs joins the ids of the nodes, for comparing results
+func nodeIDs(nodes []*Node) string {
+	ids := ""
+	for _, node := range nodes {
+		ids += node.ID() + ","
+	}
+	return ids
+}
+
+func TestNode_Labels(t *testing.T) {
+	node := NewNode("n1", 8080, NodeOptions{Zone: "us-east-1a", Rack: "r7"})
+	if node.Zone() != "us-east-1a" || node.Rack() != "r7" {
+		t.Errorf("labels = %q/%q, want us-east-1a/r7", node.Zone(), node.Rack())
+	}
+	// Labels aren't part of the identity
+	if node.String() != "n1:8080" {
+		t.Errorf("String() = %q, want %q", node.String(), "n1:8080")
+	}
+}
+
+// zonedNodes returns count nodes in each of the zones
+func zonedNodes(zones []string, count int) []*Node {
+	var nodes []*Node
+	for _, zone := range zones {
+		for i := 0; i < count; i++ {
+			nodes = append(nodes, NewNode(fmt.Sprintf("%s-n%d", zone, i), 8080, NodeOptions{Zone: zone}))
+		}
+	}
+	return nodes
+}
+
+func TestRendezvousRouter_SpreadsAcrossZones(t *testing.T) {
+	nodes := zonedNodes([]string{"a", "b", "c"}, 3)
+	plain := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		plain[i] = NewNode(node.ID(), node.Port())
+	}
+	router := NewRendezvousRouter(nodes, nil)
+	unlabeled := NewRendezvousRouter(plain, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		for k := 1; k <= 3; k++ {
+			result := router.GetNodes(key, k)
+			zones := make(map[string]bool)
+			for _, node := range result {
+				zones[node.Zone()] = true
+			}
+			if len(zones) != k {
+				t.Fatalf("key %s k=%d: nodes %s span %d zones, want %d", key, k, nodeIDs(result), len(zones), k)
+			}
+			// The primary is the same as without labels
+			if primary := unlabeled.GetNodes(key, 1)[0].ID(); result[0].ID() != primary {
+				t.Fatalf("key %s: primary %s, want %s", key, result[0].ID(), primary)
+			}
+		}
+	}
+}
+
+func TestRendezvousRouter_SpreadFallsBack(t *testing.T) {
+	// Two zones, racks within them
+	nodes := []*Node{
+		NewNode("a1", 8080, NodeOptions{Zone: "a", Rack: "r1"}),
+		NewNode("a2", 8080, NodeOptions{Zone: "a", Rack: "r1"}),
+		NewNode("a3", 8080, NodeOptions{Zone: "a", Rack: "r2"}),
+		NewNode("b1", 8080, NodeOptions{Zone: "b", Rack: "r1"}),
+	}
+	router := NewRendezvousRouter(nodes, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+
+		// Both zones first, then the unused rack: three racks in all
+		result := router.GetNodes(key, 3)
+		if result[0].Zone() == result[1].Zone() {
+			t.Fatalf("key %s: first two nodes of %s share a zone", key, nodeIDs(result))
+		}
+		racks := make(map[string]bool)
+		for _, node := range result {
+			racks[node.Zone()+"/"+node.Rack()] = true
+		}
+		if len(racks) != 3 {
+			t.Fatalf("key %s: nodes %s span %d racks, want 3", key, nodeIDs(result), len(racks))
+		}
+
+		// With more nodes than domains, the rest follow in score order
+		if result := router.GetNodes(key, 4); len(result) != 4 {
+			t.Fatalf("key %s: got %d nodes, want all 4", key, len(result))
+		}
+	}
+}
+
+func TestRendezvousRouter_SpreadsAcrossRacks(t *testing.T) {
+	nodes := []*Node{
+		NewNode("n1", 8080, NodeOptions{Rack: "r1"}),
+		NewNode("n2", 8080, NodeOptions{Rack: "r1"}),
+		NewNode("n3", 8080, NodeOptions{Rack: "r2"}),
+		NewNode("n4", 8080, NodeOptions{Rack: "r2"}),
+	}
+	router := NewRendezvousRouter(nodes, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		result := router.GetNodes(key, 2)
+		if result[0].Rack() == result[1].Rack() {
+			t.Fatalf("key %s: nodes %s share a rack", key, nodeIDs(result))
+		}
+	}
+}
+
+func TestRendezvousRouter_SpreadIsDeterministic(t *testing.T) {
+	nodes := zonedNodes([]string{"a", "b"}, 3)
+	reversed := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		reversed[len(nodes)-1-i] = node
+	}
+	r1 := NewRendezvousRouter(nodes, nil)
+	r2 := NewRendezvousRouter(reversed, nil)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if got, want := nodeIDs(r2.GetNodes(key, 3)), nodeIDs(r1.GetNodes(key, 3)); got != want {
+			t.Fatalf("key %s: %s with reversed nodes, want %s", key, got, want)
+		}
+	}
+}
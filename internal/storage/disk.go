@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/satmihir/justcache/internal/constants"
+)
+
+// Disk record layout: a fixed header followed by the key and value bytes.
+// The CRC covers everything after itself.
+//
+//	crc (uint32) | flags (uint8) | expiresAt (int64 unix nanos) | keyLen (uint16) | valueLen (uint32)
+//
+// A record with an empty value and no tombstone flag is a negative entry.
+const (
+	diskHeaderSize = 4 + 1 + 8 + 2 + 4
+
+	// diskFlagTombstone marks a record that deletes its key
+	diskFlagTombstone uint8 = 1 << 0
+
+	// Compaction runs once dead bytes are more than half of the log, and the
+	// log holds at least this share of the budget
+	diskCompactMinFraction = 4
+)
+
+// ErrCorruptRecord is returned when a disk record fails its checksum
+var ErrCorruptRecord = errors.New("corrupt disk record")
+
+// diskEntry locates a live record in the log
+type diskEntry struct {
+	offset    int64
+	length    uint32 // whole record, header included
+	expiresAt time.Time
+}
+
+// diskStore is an append-only log of key/value records in a single file with
+// an in-memory index. Overwrites and deletes leave dead records behind, which
+// compaction reclaims by rewriting the live records into a new file.
+//
+// The log never grows past maxBytes: when a record doesn't fit, the log is
+// compacted, and if that isn't enough the oldest records are dropped.
+// Records are not synced, except tombstones, so a deleted or overwritten value
+// doesn't come back after a crash. After a crash the index is rebuilt from the
+// records that made it to disk, and a torn tail is truncated.
+type diskStore struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	maxBytes  uint64
+	size      uint64 // bytes in the log file
+	liveBytes uint64 // bytes of records in the index
+	index     map[string]diskEntry
+}
+
+// openDiskStore opens the log at path, creating it if needed, and rebuilds
+// the index from its records
+func openDiskStore(path string, maxBytes uint64) (*diskStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &diskStore{
+		path:     path,
+		file:     file,
+		maxBytes: maxBytes,
+		index:    make(map[string]diskEntry),
+	}
+	if err := d.rebuild(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// rebuild scans the log and indexes the latest record of each key.
+// Scanning stops at the first torn or corrupt record, and the log is truncated there.
+func (d *diskStore) rebuild() error {
+	info, err := d.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	header := make([]byte, diskHeaderSize)
+	for {
+		if _, err := d.file.ReadAt(header, offset); err != nil {
+			break
+		}
+		flags, expiresAt, keyLen, valueLen := decodeDiskHeader(header)
+		length := uint32(diskHeaderSize) + uint32(keyLen) + valueLen
+
+		// A length running past the end of the file is a torn or corrupt header
+		if int(keyLen) > constants.MaxKeySizeBytes || valueLen > constants.MaxValueSizeBytes ||
+			offset+int64(length) > info.Size() {
+			break
+		}
+
+		record := make([]byte, length)
+		if _, err := d.file.ReadAt(record, offset); err != nil {
+			break
+		}
+		if !validDiskRecord(record) {
+			break
+		}
+
+		key := string(record[diskHeaderSize : diskHeaderSize+int(keyLen)])
+		if old, ok := d.index[key]; ok {
+			d.liveBytes -= uint64(old.length)
+			delete(d.index, key)
+		}
+		if flags&diskFlagTombstone == 0 {
+			d.index[key] = diskEntry{offset: offset, length: length, expiresAt: expiresAt}
+			d.liveBytes += uint64(length)
+		}
+		offset += int64(length)
+	}
+
+	d.size = uint64(offset)
+	return d.file.Truncate(offset)
+}
+
+// get returns the value and expiry for the key.
+// Returns ErrKeyNotFound if the key isn't stored or has expired.
+func (d *diskStore) get(key string) ([]byte, time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.index[key]
+	if !ok || entry.expiresAt.Before(time.Now()) {
+		return nil, time.Time{}, ErrKeyNotFound
+	}
+
+	record := make([]byte, entry.length)
+	if _, err := d.file.ReadAt(record, entry.offset); err != nil {
+		return nil, time.Time{}, err
+	}
+	if !validDiskRecord(record) {
+		d.removeUnlocked(key)
+		return nil, time.Time{}, ErrCorruptRecord
+	}
+	return record[diskHeaderSize+len(key):], entry.expiresAt, nil
+}
+
+// put appends a record for the key, replacing any previous one.
+// Returns ErrObjectTooLarge if the record can never fit in the budget.
+func (d *diskStore) put(key string, value []byte, expiresAt time.Time) error {
+	record := encodeDiskRecord(0, key, value, expiresAt)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if uint64(len(record)) > d.maxBytes {
+		return ErrObjectTooLarge
+	}
+
+	// The old record is dead either way, so it doesn't count against the room needed
+	d.removeUnlocked(key)
+	if d.size+uint64(len(record)) > d.maxBytes {
+		if err := d.compactUnlocked(uint64(len(record))); err != nil {
+			return err
+		}
+	}
+
+	offset := int64(d.size)
+	if _, err := d.file.WriteAt(record, offset); err != nil {
+		return err
+	}
+	d.size += uint64(len(record))
+	d.index[key] = diskEntry{offset: offset, length: uint32(len(record)), expiresAt: expiresAt}
+	d.liveBytes += uint64(len(record))
+
+	return d.maybeCompactUnlocked()
+}
+
+// delete removes the key, appending a synced tombstone so the deletion survives
+// a restart or a crash. Returns ErrDeleteKeyNotFound if the key isn't stored.
+func (d *diskStore) delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.removeUnlocked(key) {
+		return ErrDeleteKeyNotFound
+	}
+
+	tombstone := encodeDiskRecord(diskFlagTombstone, key, nil, time.Time{})
+	if d.size+uint64(len(tombstone)) > d.maxBytes {
+		// Compaction drops the deleted record, so no tombstone is needed
+		return d.compactUnlocked(0)
+	}
+	if _, err := d.file.WriteAt(tombstone, int64(d.size)); err != nil {
+		return err
+	}
+	d.size += uint64(len(tombstone))
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+
+	return d.maybeCompactUnlocked()
+}
+
+// close closes the log file
+func (d *diskStore) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
+
+// removeUnlocked drops the key from the index, leaving its record dead.
+// Returns false if the key wasn't indexed. Lock must be held by caller.
+func (d *diskStore) removeUnlocked(key string) bool {
+	entry, ok := d.index[key]
+	if !ok {
+		return false
+	}
+	delete(d.index, key)
+	d.liveBytes -= uint64(entry.length)
+	return true
+}
+
+// maybeCompactUnlocked compacts once most of a sizable log is dead space.
+// Lock must be held by caller.
+func (d *diskStore) maybeCompactUnlocked() error {
+	dead := d.size - d.liveBytes
+	if d.size >= d.maxBytes/diskCompactMinFraction && dead > d.size/2 {
+		return d.compactUnlocked(0)
+	}
+	return nil
+}
+
+// compactUnlocked rewrites the live, unexpired records into a new log and
+// swaps it in. If the live records plus reserve bytes exceed the budget, the
+// oldest records are dropped until they fit. Lock must be held by caller.
+func (d *diskStore) compactUnlocked(reserve uint64) error {
+	type liveRecord struct {
+		key string
+		diskEntry
+	}
+
+	now := time.Now()
+	live := make([]liveRecord, 0, len(d.index))
+	var liveBytes uint64
+	for key, entry := range d.index {
+		if entry.expiresAt.Before(now) {
+			continue
+		}
+		live = append(live, liveRecord{key: key, diskEntry: entry})
+		liveBytes += uint64(entry.length)
+	}
+
+	// Oldest records first, so over-budget ones are dropped from the front
+	sort.Slice(live, func(i, j int) bool { return live[i].offset < live[j].offset })
+	for len(live) > 0 && liveBytes+reserve > d.maxBytes {
+		liveBytes -= uint64(live[0].length)
+		live = live[1:]
+	}
+
+	tmpPath := d.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]diskEntry, len(live))
+	var offset int64
+	for _, rec := range live {
+		if _, err := io.Copy(tmp, io.NewSectionReader(d.file, rec.offset, int64(rec.length))); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		index[rec.key] = diskEntry{offset: offset, length: rec.length, expiresAt: rec.expiresAt}
+		offset += int64(rec.length)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	d.file.Close()
+	d.file = tmp
+	d.index = index
+	d.size = uint64(offset)
+	d.liveBytes = liveBytes
+	return nil
+}
+
+// encodeDiskRecord builds a record for the key and value
+func encodeDiskRecord(flags uint8, key string, value []byte, expiresAt time.Time) []byte {
+	record := make([]byte, diskHeaderSize+len(key)+len(value))
+	record[4] = flags
+	binary.BigEndian.PutUint64(record[5:], uint64(expiresAt.UnixNano()))
+	binary.BigEndian.PutUint16(record[13:], uint16(len(key)))
+	binary.BigEndian.PutUint32(record[15:], uint32(len(value)))
+	copy(record[diskHeaderSize:], key)
+	copy(record[diskHeaderSize+len(key):], value)
+	binary.BigEndian.PutUint32(record[0:], crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+// decodeDiskHeader parses the fixed header of a record
+func decodeDiskHeader(header []byte) (flags uint8, expiresAt time.Time, keyLen uint16, valueLen uint32) {
+	flags = header[4]
+	expiresAt = time.Unix(0, int64(binary.BigEndian.Uint64(header[5:])))
+	keyLen = binary.BigEndian.Uint16(header[13:])
+	valueLen = binary.BigEndian.Uint32(header[15:])
+	return flags, expiresAt, keyLen, valueLen
+}
+
+// validDiskRecord checks a whole record against its checksum
+func validDiskRecord(record []byte) bool {
+	return binary.BigEndian.Uint32(record[0:]) == crc32.ChecksumIEEE(record[4:])
+}
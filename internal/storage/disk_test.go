@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestDiskStore(t *testing.T, path string, maxBytes uint64) *diskStore {
+	t.Helper()
+	d, err := openDiskStore(path, maxBytes)
+	if err != nil {
+		t.Fatalf("openDiskStore() error = %v", err)
+	}
+	t.Cleanup(func() { d.close() })
+	return d
+}
+
+func assertDiskValue(t *testing.T, d *diskStore, key, expected string) {
+	t.Helper()
+	value, _, err := d.get(key)
+	if err != nil {
+		t.Fatalf("get(%q) error = %v", key, err)
+	}
+	if string(value) != expected {
+		t.Errorf("get(%q) = %q, want %q", key, value, expected)
+	}
+}
+
+func TestDiskStore_PutGetDelete(t *testing.T) {
+	d := openTestDiskStore(t, filepath.Join(t.TempDir(), "log"), 1<<20)
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := d.put("key", []byte("value"), expiresAt); err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	value, gotExpiry, err := d.get("key")
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if string(value) != "value" || !gotExpiry.Equal(expiresAt) {
+		t.Errorf("get() = %q, %v; want %q, %v", value, gotExpiry, "value", expiresAt)
+	}
+
+	if err := d.put("key", []byte("newer"), expiresAt); err != nil {
+		t.Fatalf("put() overwrite error = %v", err)
+	}
+	assertDiskValue(t, d, "key", "newer")
+
+	if err := d.delete("key"); err != nil {
+		t.Errorf("delete() error = %v", err)
+	}
+	if _, _, err := d.get("key"); err != ErrKeyNotFound {
+		t.Errorf("get() after delete error = %v, want ErrKeyNotFound", err)
+	}
+	if err := d.delete("key"); err != ErrDeleteKeyNotFound {
+		t.Errorf("second delete() error = %v, want ErrDeleteKeyNotFound", err)
+	}
+}
+
+func TestDiskStore_Expired(t *testing.T) {
+	d := openTestDiskStore(t, filepath.Join(t.TempDir(), "log"), 1<<20)
+
+	d.put("key", []byte("value"), time.Now().Add(-time.Second))
+	if _, _, err := d.get("key"); err != ErrKeyNotFound {
+		t.Errorf("get() of expired key error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestDiskStore_RebuildAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	expiresAt := time.Now().Add(time.Hour)
+
+	d, _ := openDiskStore(path, 1<<20)
+	d.put("kept", []byte("v1"), expiresAt)
+	d.put("kept", []byte("v2"), expiresAt)
+	d.put("deleted", []byte("value"), expiresAt)
+	d.delete("deleted")
+	d.close()
+
+	d = openTestDiskStore(t, path, 1<<20)
+	assertDiskValue(t, d, "kept", "v2")
+	if _, _, err := d.get("deleted"); err != ErrKeyNotFound {
+		t.Errorf("deleted key came back after reopen: error = %v", err)
+	}
+	if d.liveBytes != uint64(diskHeaderSize+len("kept")+len("v2")) {
+		t.Errorf("liveBytes = %d after rebuild", d.liveBytes)
+	}
+}
+
+func TestDiskStore_TornTailTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	expiresAt := time.Now().Add(time.Hour)
+
+	d, _ := openDiskStore(path, 1<<20)
+	d.put("good", []byte("value"), expiresAt)
+	good := d.size
+	d.put("torn", []byte("value"), expiresAt)
+	d.close()
+
+	// Simulate a crash in the middle of the second record
+	os.Truncate(path, int64(good)+5)
+
+	d = openTestDiskStore(t, path, 1<<20)
+	assertDiskValue(t, d, "good", "value")
+	if _, _, err := d.get("torn"); err != ErrKeyNotFound {
+		t.Errorf("get(torn) error = %v, want ErrKeyNotFound", err)
+	}
+	if d.size != good {
+		t.Errorf("size = %d, want log truncated to %d", d.size, good)
+	}
+
+	// Appends continue after the last good record
+	d.put("next", []byte("value"), expiresAt)
+	assertDiskValue(t, d, "next", "value")
+}
+
+func TestDiskStore_CorruptRecordStopsRebuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	expiresAt := time.Now().Add(time.Hour)
+
+	d, _ := openDiskStore(path, 1<<20)
+	d.put("good", []byte("value"), expiresAt)
+	good := d.size
+	d.put("bad", []byte("value"), expiresAt)
+	d.close()
+
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+
+	d = openTestDiskStore(t, path, 1<<20)
+	assertDiskValue(t, d, "good", "value")
+	if _, _, err := d.get("bad"); err != ErrKeyNotFound {
+		t.Errorf("get(bad) error = %v, want ErrKeyNotFound", err)
+	}
+	if d.size != good {
+		t.Errorf("size = %d, want %d", d.size, good)
+	}
+}
+
+func TestDiskStore_CompactionReclaimsDeadSpace(t *testing.T) {
+	d := openTestDiskStore(t, filepath.Join(t.TempDir(), "log"), 10000)
+	expiresAt := time.Now().Add(time.Hour)
+
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 200; i++ {
+		if err := d.put("key", value, expiresAt); err != nil {
+			t.Fatalf("put() error = %v", err)
+		}
+	}
+	d.put("expired", value, time.Now().Add(-time.Second))
+	d.compactUnlocked(0)
+
+	record := uint64(diskHeaderSize + len("key") + len(value))
+	if d.size != record || d.liveBytes != record {
+		t.Errorf("size = %d, liveBytes = %d; want both %d after compaction", d.size, d.liveBytes, record)
+	}
+	assertDiskValue(t, d, "key", string(value))
+
+	info, _ := os.Stat(d.path)
+	if uint64(info.Size()) != d.size {
+		t.Errorf("file size = %d, want %d", info.Size(), d.size)
+	}
+}
+
+func TestDiskStore_BudgetDropsOldest(t *testing.T) {
+	value := bytes.Repeat([]byte("x"), 100)
+	record := diskHeaderSize + len("key-0") + len(value)
+	d := openTestDiskStore(t, filepath.Join(t.TempDir(), "log"), uint64(5*record))
+	expiresAt := time.Now().Add(time.Hour)
+
+	for i := 0; i < 8; i++ {
+		if err := d.put(fmt.Sprintf("key-%d", i), value, expiresAt); err != nil {
+			t.Fatalf("put() error = %v", err)
+		}
+		if d.size > d.maxBytes {
+			t.Fatalf("size = %d exceeds budget %d", d.size, d.maxBytes)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := d.get(fmt.Sprintf("key-%d", i)); err != ErrKeyNotFound {
+			t.Errorf("oldest key-%d error = %v, want dropped", i, err)
+		}
+	}
+	for i := 3; i < 8; i++ {
+		assertDiskValue(t, d, fmt.Sprintf("key-%d", i), string(value))
+	}
+
+	if err := d.put("huge", make([]byte, 10*record), expiresAt); err != ErrObjectTooLarge {
+		t.Errorf("put() larger than budget error = %v, want ErrObjectTooLarge", err)
+	}
+}
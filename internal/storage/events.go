@@ -0,0 +1,113 @@
+package storage
+
+// EventReason tells why an entry left the storage.
+type EventReason int
+
+const (
+	// ReasonEvicted: the eviction policy chose the entry to make room.
+	ReasonEvicted EventReason = iota
+	// ReasonExpiredOnRead: a read found the entry past its TTL.
+	ReasonExpiredOnRead
+	// ReasonExpiredOnCleanup: the entry was past its TTL and reclaimed to make room.
+	ReasonExpiredOnCleanup
+	// ReasonDeleted: the entry was removed by Delete.
+	ReasonDeleted
+)
+
+func (r EventReason) String() string {
+	switch r {
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonExpiredOnRead:
+		return "expired_on_read"
+	case ReasonExpiredOnCleanup:
+		return "expired_on_cleanup"
+	case ReasonDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes an entry that left the storage.
+type Event struct {
+	Key string
+	// Size is the bytes the entry used, key included.
+	Size int
+	// Reason tells why the entry was removed.
+	Reason EventReason
+}
+
+// EventListener receives the entries removed from an InMemoryStorage.
+//
+// Events are delivered after the storage mutex is released, on the goroutine
+// whose operation removed the entry, so a listener may call back into the
+// storage. A ShardedStorage shares the listener across its shards, and
+// operations on different keys run concurrently: implementations must be safe
+// for concurrent use, and events of different operations may arrive out of order.
+type EventListener interface {
+	// OnEvict is called for an entry evicted to make room (ReasonEvicted).
+	OnEvict(event Event)
+	// OnExpire is called for an entry removed past its TTL
+	// (ReasonExpiredOnRead or ReasonExpiredOnCleanup).
+	OnExpire(event Event)
+	// OnDelete is called for an entry removed by Delete (ReasonDeleted).
+	OnDelete(event Event)
+}
+
+// pendingEvents holds the removals made under the storage mutex until they
+// can be delivered
+type pendingEvents struct {
+	events []Event
+	// evicted entries for the onEvict hook
+	evicted []*CachedObject
+}
+
+// recordUnlocked counts the removal of obj and queues it for delivery.
+// Lock must be held by caller.
+func (s *InMemoryStorage) recordUnlocked(obj *CachedObject, reason EventReason) {
+	switch reason {
+	case ReasonEvicted:
+		s.counters.evictions++
+	case ReasonExpiredOnRead, ReasonExpiredOnCleanup:
+		s.counters.expirations++
+	case ReasonDeleted:
+		s.counters.deletes++
+	}
+
+	if s.listener != nil {
+		s.pending.events = append(s.pending.events, Event{
+			Key:    obj.Key,
+			Size:   int(obj.GetBytesUsed()),
+			Reason: reason,
+		})
+	}
+	if reason == ReasonEvicted && s.onEvict != nil {
+		s.pending.evicted = append(s.pending.evicted, obj)
+	}
+}
+
+// takePendingUnlocked returns and clears the queued removals. Lock must be held by caller.
+func (s *InMemoryStorage) takePendingUnlocked() pendingEvents {
+	pending := s.pending
+	s.pending = pendingEvents{}
+	return pending
+}
+
+// deliver hands queued removals to the listener and the onEvict hook.
+// Must be called without the lock.
+func (s *InMemoryStorage) deliver(pending pendingEvents) {
+	for _, event := range pending.events {
+		switch event.Reason {
+		case ReasonEvicted:
+			s.listener.OnEvict(event)
+		case ReasonExpiredOnRead, ReasonExpiredOnCleanup:
+			s.listener.OnExpire(event)
+		case ReasonDeleted:
+			s.listener.OnDelete(event)
+		}
+	}
+	if len(pending.evicted) > 0 && s.onEvict != nil {
+		s.onEvict(pending.evicted)
+	}
+}
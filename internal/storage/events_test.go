@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingListener records the events it receives
+type recordingListener struct {
+	mu      sync.Mutex
+	evicted []Event
+	expired []Event
+	deleted []Event
+	// onEvent, if set, runs on every event
+	onEvent func(event Event)
+}
+
+func (l *recordingListener) record(list *[]Event, event Event) {
+	l.mu.Lock()
+	*list = append(*list, event)
+	l.mu.Unlock()
+	if l.onEvent != nil {
+		l.onEvent(event)
+	}
+}
+
+func (l *recordingListener) OnEvict(event Event)  { l.record(&l.evicted, event) }
+func (l *recordingListener) OnExpire(event Event) { l.record(&l.expired, event) }
+func (l *recordingListener) OnDelete(event Event) { l.record(&l.deleted, event) }
+
+func assertEvents(t *testing.T, name string, got []Event, expected ...Event) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("%s events = %v, want %v", name, got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("%s event %d = %+v, want %+v", name, i, got[i], expected[i])
+		}
+	}
+}
+
+func TestEvents_Evict(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(20, StorageOptions{Listener: l})
+
+	s.Put("a", []byte("123456789"), time.Hour)
+	s.Put("b", []byte("123456789"), time.Hour)
+	s.Put("c", []byte("123456789"), time.Hour)
+
+	assertEvents(t, "evict", l.evicted, Event{Key: "a", Size: 10, Reason: ReasonEvicted})
+	assertEvents(t, "expire", l.expired)
+	assertEvents(t, "delete", l.deleted)
+}
+
+func TestEvents_ExpireOnRead(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(1000, StorageOptions{Listener: l})
+
+	s.Put("key", []byte("value"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	s.Get("key")
+
+	assertEvents(t, "expire", l.expired, Event{Key: "key", Size: 8, Reason: ReasonExpiredOnRead})
+}
+
+func TestEvents_ExpireOnCleanup(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(20, StorageOptions{Listener: l})
+
+	s.Put("short", []byte("12345"), 10*time.Millisecond)
+	s.Put("long", []byte("123456"), time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	s.Put("new", []byte("1234567"), time.Hour)
+
+	assertEvents(t, "expire", l.expired, Event{Key: "short", Size: 10, Reason: ReasonExpiredOnCleanup})
+	assertEvents(t, "evict", l.evicted)
+}
+
+func TestEvents_Delete(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(1000, StorageOptions{Listener: l})
+
+	s.Put("key", []byte("value"), time.Hour)
+	s.Delete("key")
+	s.Delete("missing")
+
+	assertEvents(t, "delete", l.deleted, Event{Key: "key", Size: 8, Reason: ReasonDeleted})
+}
+
+func TestEvents_ReplaceIsNotAnEvent(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(1000, StorageOptions{Listener: l})
+
+	s.Put("key", []byte("value"), time.Hour)
+	s.Put("key", []byte("newer"), time.Hour)
+
+	assertEvents(t, "evict", l.evicted)
+	assertEvents(t, "delete", l.deleted)
+}
+
+func TestEvents_ListenerMayCallStorage(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(1000, StorageOptions{Listener: l})
+	// Would deadlock if delivered under the lock
+	l.onEvent = func(event Event) { s.Get(event.Key) }
+
+	s.Put("key", []byte("value"), time.Hour)
+	s.Delete("key")
+
+	assertEvents(t, "delete", l.deleted, Event{Key: "key", Size: 8, Reason: ReasonDeleted})
+}
+
+func TestEvents_ReserveEvicts(t *testing.T) {
+	l := &recordingListener{}
+	s := NewInMemoryStorage(20, StorageOptions{Listener: l})
+
+	s.Put("a", []byte("123456789"), time.Hour)
+	s.Put("b", []byte("123456789"), time.Hour)
+	r, err := s.Reserve("c", 9)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	defer r.Release()
+
+	assertEvents(t, "evict", l.evicted, Event{Key: "a", Size: 10, Reason: ReasonEvicted})
+}
+
+func TestEvents_ShardsShareListener(t *testing.T) {
+	l := &recordingListener{}
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4, Listener: l})
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, key := range keys {
+		s.Put(key, []byte("value"), time.Hour)
+	}
+	for _, key := range keys {
+		s.Delete(key)
+	}
+
+	if len(l.deleted) != len(keys) {
+		t.Errorf("delete events = %d, want %d", len(l.deleted), len(keys))
+	}
+}
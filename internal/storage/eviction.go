@@ -0,0 +1,93 @@
+package storage
+
+// EvictionPolicy decides which entry InMemoryStorage evicts when it needs memory.
+// All methods are called with the storage mutex held, so implementations don't
+// need their own locking.
+type EvictionPolicy interface {
+	// OnInsert records a newly stored entry.
+	OnInsert(obj *CachedObject)
+	// OnAccess records a read of a stored entry.
+	OnAccess(obj *CachedObject)
+	// OnRemove forgets an entry that was deleted, expired or evicted.
+	OnRemove(obj *CachedObject)
+	// Victim returns the entry that should be evicted next, or nil if there are none.
+	// The entry is not removed; the storage calls OnRemove when it deletes it.
+	Victim() *CachedObject
+	// Walk visits entries from the coldest to the hottest until fn returns false.
+	// fn may delete the entry it is visiting.
+	Walk(fn func(obj *CachedObject) bool)
+}
+
+// EvictionPolicyType selects an EvictionPolicy implementation.
+type EvictionPolicyType int
+
+const (
+	// EvictionLRU evicts the least recently used entry.
+	EvictionLRU EvictionPolicyType = iota
+	// EvictionLFU evicts the least frequently used entry, breaking ties by recency.
+	EvictionLFU
+	// EvictionWTinyLFU uses a small LRU admission window in front of a segmented
+	// LRU main space, admitting window entries to the main space only if a
+	// count-min sketch estimates them to be more popular than the main victim.
+	// This keeps one-off scans from flushing the hot set.
+	EvictionWTinyLFU
+	// EvictionSIEVE uses the SIEVE algorithm: a FIFO queue with a visited bit and
+	// a moving hand that skips (and clears) visited entries.
+	EvictionSIEVE
+)
+
+// newEvictionPolicy creates the policy for the given type.
+// capacityHint is the expected number of entries (0 if unknown).
+func newEvictionPolicy(policyType EvictionPolicyType, capacityHint int) EvictionPolicy {
+	switch policyType {
+	case EvictionLFU:
+		return newLFUPolicy()
+	case EvictionWTinyLFU:
+		return newTinyLFUPolicy(capacityHint)
+	case EvictionSIEVE:
+		return &sievePolicy{}
+	default:
+		return &lruPolicy{}
+	}
+}
+
+// lruPolicy evicts from the head of an LRU list.
+type lruPolicy struct {
+	list lruList
+}
+
+func (p *lruPolicy) OnInsert(obj *CachedObject) {
+	// Add to tail of LRU list (most recently used).
+	p.list.append(obj)
+}
+
+func (p *lruPolicy) OnAccess(obj *CachedObject) {
+	// Move the node to the tail of the list (most recently used).
+	p.list.moveToTail(obj)
+}
+
+func (p *lruPolicy) OnRemove(obj *CachedObject) {
+	p.list.remove(obj)
+}
+
+func (p *lruPolicy) Victim() *CachedObject {
+	return p.list.front()
+}
+
+func (p *lruPolicy) Walk(fn func(obj *CachedObject) bool) {
+	walkList(&p.list, fn)
+}
+
+// walkList visits the nodes of a list from head to tail until fn returns false.
+// fn may remove the node it is visiting.
+func walkList(l *lruList, fn func(obj *CachedObject) bool) bool {
+	ptr := l.front()
+	for ptr != nil {
+		next := ptr.next // Save next before potential deletion
+		if !fn(ptr) {
+			return false
+		}
+		ptr = next
+	}
+	return true
+}
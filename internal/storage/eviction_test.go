@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var allPolicies = []struct {
+	name       string
+	policyType EvictionPolicyType
+}{
+	{"LRU", EvictionLRU},
+	{"LFU", EvictionLFU},
+	{"WTinyLFU", EvictionWTinyLFU},
+	{"SIEVE", EvictionSIEVE},
+}
+
+func newStorageWithPolicy(maxMemory uint64, policyType EvictionPolicyType) *InMemoryStorage {
+	return NewInMemoryStorage(maxMemory, StorageOptions{EvictionPolicy: policyType})
+}
+
+// walkKeys collects the keys visited by the policy's Walk
+func walkKeys(p EvictionPolicy) []string {
+	var keys []string
+	p.Walk(func(obj *CachedObject) bool {
+		keys = append(keys, obj.Key)
+		return true
+	})
+	return keys
+}
+
+func TestNewEvictionPolicy_Types(t *testing.T) {
+	if _, ok := newEvictionPolicy(EvictionLRU, 0).(*lruPolicy); !ok {
+		t.Error("EvictionLRU should create *lruPolicy")
+	}
+	if _, ok := newEvictionPolicy(EvictionLFU, 0).(*lfuPolicy); !ok {
+		t.Error("EvictionLFU should create *lfuPolicy")
+	}
+	if _, ok := newEvictionPolicy(EvictionWTinyLFU, 0).(*tinyLFUPolicy); !ok {
+		t.Error("EvictionWTinyLFU should create *tinyLFUPolicy")
+	}
+	if _, ok := newEvictionPolicy(EvictionSIEVE, 0).(*sievePolicy); !ok {
+		t.Error("EvictionSIEVE should create *sievePolicy")
+	}
+	if _, ok := NewInMemoryStorage(100).policy.(*lruPolicy); !ok {
+		t.Error("default policy should be LRU")
+	}
+}
+
+func TestEvictionPolicy_EmptyVictim(t *testing.T) {
+	for _, tt := range allPolicies {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newEvictionPolicy(tt.policyType, 0)
+			if v := p.Victim(); v != nil {
+				t.Errorf("Victim() on empty policy = %q, want nil", v.Key)
+			}
+		})
+	}
+}
+
+func TestEvictionPolicy_WalkVisitsEveryEntryOnce(t *testing.T) {
+	for _, tt := range allPolicies {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newEvictionPolicy(tt.policyType, 0)
+			objs := make([]*CachedObject, 200)
+			for i := range objs {
+				objs[i] = newTestObject(fmt.Sprintf("key-%d", i), "v")
+				p.OnInsert(objs[i])
+			}
+			for i := 0; i < 500; i++ {
+				p.OnAccess(objs[(i*7)%len(objs)])
+			}
+			for i := 0; i < 50; i++ {
+				p.OnRemove(objs[i*4])
+			}
+
+			seen := make(map[string]int)
+			for _, key := range walkKeys(p) {
+				seen[key]++
+			}
+			if len(seen) != 150 {
+				t.Errorf("Walk visited %d distinct entries, want 150", len(seen))
+			}
+			for key, n := range seen {
+				if n != 1 {
+					t.Errorf("Walk visited %q %d times", key, n)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictionPolicy_WalkAllowsRemoval(t *testing.T) {
+	for _, tt := range allPolicies {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newEvictionPolicy(tt.policyType, 0)
+			for i := 0; i < 20; i++ {
+				p.OnInsert(newTestObject(fmt.Sprintf("key-%d", i), "v"))
+			}
+
+			removed := 0
+			p.Walk(func(obj *CachedObject) bool {
+				p.OnRemove(obj)
+				removed++
+				return true
+			})
+
+			if removed != 20 {
+				t.Errorf("removed %d entries, want 20", removed)
+			}
+			if v := p.Victim(); v != nil {
+				t.Errorf("Victim() after removing all = %q, want nil", v.Key)
+			}
+		})
+	}
+}
+
+func TestEvictionPolicy_StorageInvariants(t *testing.T) {
+	for _, tt := range allPolicies {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorageWithPolicy(2000, tt.policyType)
+			rng := rand.New(rand.NewSource(1))
+
+			for i := 0; i < 5000; i++ {
+				key := fmt.Sprintf("key-%d", rng.Intn(300))
+				switch rng.Intn(4) {
+				case 0, 1:
+					s.Get(key)
+				case 2:
+					s.Put(key, make([]byte, 1+rng.Intn(40)), time.Hour)
+				case 3:
+					s.Delete(key)
+				}
+			}
+
+			if s.memoryUsedBytes > s.maxMemory {
+				t.Errorf("memoryUsedBytes = %d, exceeds maxMemory %d", s.memoryUsedBytes, s.maxMemory)
+			}
+
+			used := uint64(0)
+			for _, obj := range s.store {
+				used += obj.GetBytesUsed()
+			}
+			if used != s.memoryUsedBytes {
+				t.Errorf("memoryUsedBytes = %d, sum of entries = %d", s.memoryUsedBytes, used)
+			}
+			if n := len(walkKeys(s.policy)); n != len(s.store) {
+				t.Errorf("policy tracks %d entries, store has %d", n, len(s.store))
+			}
+		})
+	}
+}
+
+func TestLFU_EvictsLeastFrequent(t *testing.T) {
+	s := newStorageWithPolicy(6, EvictionLFU)
+
+	mustPut(t, s, "a", []byte("1"), time.Hour)
+	mustPut(t, s, "b", []byte("2"), time.Hour)
+	mustPut(t, s, "c", []byte("3"), time.Hour)
+
+	s.Get("a")
+	s.Get("a")
+	s.Get("b")
+
+	mustPut(t, s, "d", []byte("4"), time.Hour)
+
+	if _, err := s.Get("c"); err != ErrKeyNotFound {
+		t.Error("least frequently used key 'c' should have been evicted")
+	}
+	for _, key := range []string{"a", "b", "d"} {
+		if _, err := s.Get(key); err != nil {
+			t.Errorf("key %q should exist, got %v", key, err)
+		}
+	}
+}
+
+func TestLFU_TieBrokenByRecency(t *testing.T) {
+	s := newStorageWithPolicy(6, EvictionLFU)
+
+	mustPut(t, s, "a", []byte("1"), time.Hour)
+	mustPut(t, s, "b", []byte("2"), time.Hour)
+	mustPut(t, s, "c", []byte("3"), time.Hour)
+
+	// a and b have equal counts; a was accessed less recently
+	s.Get("a")
+	s.Get("b")
+	s.Get("c")
+	s.Get("c")
+
+	mustPut(t, s, "d", []byte("4"), time.Hour)
+
+	if _, err := s.Get("a"); err != ErrKeyNotFound {
+		t.Error("key 'a' should have been evicted")
+	}
+}
+
+func TestLFU_VictimAfterMinimumBucketRemoved(t *testing.T) {
+	p := newLFUPolicy()
+	a := newTestObject("a", "1")
+	b := newTestObject("b", "2")
+	p.OnInsert(a)
+	p.OnInsert(b)
+	p.OnAccess(b)
+	p.OnAccess(b)
+
+	p.OnRemove(a)
+
+	if v := p.Victim(); v != b {
+		t.Errorf("Victim() = %v, want b", v)
+	}
+}
+
+func TestSIEVE_SkipsVisitedEntries(t *testing.T) {
+	s := newStorageWithPolicy(6, EvictionSIEVE)
+
+	mustPut(t, s, "a", []byte("1"), time.Hour)
+	mustPut(t, s, "b", []byte("2"), time.Hour)
+	mustPut(t, s, "c", []byte("3"), time.Hour)
+
+	s.Get("a")
+
+	mustPut(t, s, "d", []byte("4"), time.Hour)
+
+	if _, err := s.Get("b"); err != ErrKeyNotFound {
+		t.Error("first unvisited key 'b' should have been evicted")
+	}
+	if _, err := s.Get("a"); err != nil {
+		t.Errorf("visited key 'a' should survive, got %v", err)
+	}
+}
+
+func TestSIEVE_HandResumesAfterVictim(t *testing.T) {
+	p := &sievePolicy{}
+	objs := make([]*CachedObject, 4)
+	for i := range objs {
+		objs[i] = newTestObject(fmt.Sprintf("k%d", i), "v")
+		p.OnInsert(objs[i])
+	}
+	p.OnAccess(objs[0])
+	p.OnAccess(objs[2])
+
+	// k0 is visited (cleared), k1 is evicted
+	if v := p.Victim(); v != objs[1] {
+		t.Fatalf("first Victim() = %q, want k1", v.Key)
+	}
+	p.OnRemove(objs[1])
+
+	// The hand continues from k2: visited (cleared), so k3 is next
+	if v := p.Victim(); v != objs[3] {
+		t.Fatalf("second Victim() = %q, want k3", v.Key)
+	}
+	p.OnRemove(objs[3])
+
+	// Wraps around to k0, whose bit was cleared by the first sweep
+	if v := p.Victim(); v != objs[0] {
+		t.Fatalf("third Victim() = %q, want k0", v.Key)
+	}
+}
+
+func TestSIEVE_AllVisited(t *testing.T) {
+	p := &sievePolicy{}
+	a := newTestObject("a", "1")
+	b := newTestObject("b", "2")
+	p.OnInsert(a)
+	p.OnInsert(b)
+	p.OnAccess(a)
+	p.OnAccess(b)
+
+	if v := p.Victim(); v != a {
+		t.Errorf("Victim() = %v, want a after a full sweep", v)
+	}
+}
+
+func TestWTinyLFU_ScanResistance(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policyType EvictionPolicyType
+		wantHot    bool
+	}{
+		{"LRU loses hot set", EvictionLRU, false},
+		{"WTinyLFU keeps hot set", EvictionWTinyLFU, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Room for 100 entries of 10 bytes
+			s := newStorageWithPolicy(1000, tt.policyType)
+			value := []byte("vvvvv")
+
+			hot := make([]string, 50)
+			for i := range hot {
+				hot[i] = fmt.Sprintf("hot%02d", i)
+				mustPut(t, s, hot[i], value, time.Hour)
+			}
+			for round := 0; round < 5; round++ {
+				for _, key := range hot {
+					s.Get(key)
+				}
+			}
+
+			// A batch job scans many keys once
+			for i := 0; i < 500; i++ {
+				s.Put(fmt.Sprintf("scn%02d", i%100)+fmt.Sprint(i/100), value, time.Hour)
+			}
+
+			survivors := 0
+			for _, key := range hot {
+				if _, err := s.Get(key); err == nil {
+					survivors++
+				}
+			}
+			if tt.wantHot && survivors < 45 {
+				t.Errorf("%d of 50 hot keys survived the scan, want >= 45", survivors)
+			}
+			if !tt.wantHot && survivors > 5 {
+				t.Errorf("%d of 50 hot keys survived the scan, want <= 5", survivors)
+			}
+		})
+	}
+}
+
+func TestWTinyLFU_WindowOverflowsToProbation(t *testing.T) {
+	p := newTinyLFUPolicy(0)
+	for i := 0; i < 200; i++ {
+		p.OnInsert(newTestObject(fmt.Sprintf("key-%d", i), "v"))
+	}
+
+	if p.windowLen != 2 {
+		t.Errorf("windowLen = %d, want 2 (1%% of 200)", p.windowLen)
+	}
+	if p.probationLen != 198 {
+		t.Errorf("probationLen = %d, want 198", p.probationLen)
+	}
+}
+
+func TestWTinyLFU_AccessPromotesToProtected(t *testing.T) {
+	p := newTinyLFUPolicy(0)
+	objs := make([]*CachedObject, 10)
+	for i := range objs {
+		objs[i] = newTestObject(fmt.Sprintf("key-%d", i), "v")
+		p.OnInsert(objs[i])
+	}
+
+	p.OnAccess(objs[0])
+	if objs[0].segment != segmentProtected {
+		t.Errorf("segment = %d, want protected", objs[0].segment)
+	}
+
+	// Protected is capped at 80% of the main space
+	for _, obj := range objs {
+		p.OnAccess(obj)
+	}
+	if max := (p.probationLen + p.protectedLen) * 80 / 100; p.protectedLen > max {
+		t.Errorf("protectedLen = %d, exceeds %d", p.protectedLen, max)
+	}
+}
+
+func TestCountMinSketch_Estimates(t *testing.T) {
+	s := newCountMinSketch(0)
+
+	for i := 0; i < 5; i++ {
+		s.increment("hot")
+	}
+	s.increment("warm")
+
+	if got := s.estimate("hot"); got < 5 {
+		t.Errorf("estimate(hot) = %d, want >= 5", got)
+	}
+	if got := s.estimate("warm"); got < 1 {
+		t.Errorf("estimate(warm) = %d, want >= 1", got)
+	}
+	if s.estimate("hot") <= s.estimate("cold") {
+		t.Error("hot key should be estimated above an unseen key")
+	}
+}
+
+func TestCountMinSketch_Saturates(t *testing.T) {
+	s := newCountMinSketch(0)
+	for i := 0; i < 100; i++ {
+		s.increment("key")
+	}
+	if got := s.estimate("key"); got != sketchMaxCount {
+		t.Errorf("estimate = %d, want %d", got, sketchMaxCount)
+	}
+}
+
+func TestCountMinSketch_ResetHalves(t *testing.T) {
+	s := newCountMinSketch(0)
+	for i := 0; i < 8; i++ {
+		s.increment("key")
+	}
+	s.reset()
+	if got := s.estimate("key"); got != 4 {
+		t.Errorf("estimate after reset = %d, want 4", got)
+	}
+}
+
+func TestCountMinSketch_WidthFromCapacity(t *testing.T) {
+	s := newCountMinSketch(5000)
+	if len(s.rows[0]) != 8192 {
+		t.Errorf("width = %d, want 8192", len(s.rows[0]))
+	}
+}
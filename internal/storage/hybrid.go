@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// Number of key-striped locks ordering tier moves in a HybridStorage
+	hybridLockStripes = 64
+
+	// Maximum number of evicted entries waiting to be written to disk. Entries
+	// evicted while the queue is full are dropped instead of demoted.
+	maxQueuedDemotions = 4096
+)
+
+// DiskOptions configures the disk tier of a HybridStorage.
+type DiskOptions struct {
+	// Path is the log file backing the disk tier. It is created if missing,
+	// and its entries are reloaded when the storage is reopened.
+	Path string
+	// MaxBytes is the byte budget of the log file, including space that
+	// compaction hasn't reclaimed yet.
+	MaxBytes uint64
+}
+
+// tieredMemory is a memory tier that hands its evictions to a lower tier
+type tieredMemory interface {
+	LocalStorage
+	Peeker
+	Snapshotter
+	StatsReporter
+	setEvictionHook(fn func(evicted []*CachedObject))
+	contains(key string) bool
+}
+
+// HybridStorage is a local storage implementation with two tiers: an in-memory
+// storage in front of a log-structured store on local disk.
+//
+// Entries evicted from memory to make room are demoted to disk instead of
+// being dropped, and a read that finds an entry on disk promotes it back to
+// memory. Demoted entries are written to disk by a background goroutine, so
+// reads and writes don't wait on disk I/O for other keys; entries still
+// waiting are served from the queue. Expired entries are not demoted. The
+// disk tier has its own byte budget; when it's full, its oldest entries are
+// dropped.
+//
+// A Listener in the options observes the memory tier only, so entries demoted
+// to disk are reported as evicted.
+//
+// Reserver is not implemented, so uploads are buffered before they're stored.
+type HybridStorage struct {
+	memory tieredMemory
+	disk   *diskStore
+
+	// locks order promotions, demotions and writes of the same key
+	locks [hybridLockStripes]sync.Mutex
+
+	// demotions queues evicted entries, oldest first, until they're written
+	// to disk. demotionIndex holds the queued entry of each key.
+	demotionsMu   sync.Mutex
+	demotions     *list.List
+	demotionIndex map[string]*list.Element
+
+	// flush wakes the flusher, done stops it, and flushed is closed once it
+	// has returned
+	flush     chan struct{}
+	done      chan struct{}
+	flushed   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHybridStorage creates a HybridStorage with a memory tier of maxMemory
+// bytes, selected by opts as in NewStorage, and a disk tier configured by disk.
+// Entries already in the disk log are served after a restart.
+func NewHybridStorage(maxMemory uint64, disk DiskOptions, opts ...StorageOptions) (*HybridStorage, error) {
+	store, err := openDiskStore(disk.Path, disk.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HybridStorage{
+		memory:        NewStorage(maxMemory, opts...).(tieredMemory),
+		disk:          store,
+		demotions:     list.New(),
+		demotionIndex: make(map[string]*list.Element),
+		flush:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		flushed:       make(chan struct{}),
+	}
+	h.memory.setEvictionHook(h.queueDemotions)
+	go h.flushLoop()
+	return h, nil
+}
+
+// Get returns the entry from memory, or promotes it from disk.
+func (h *HybridStorage) Get(key string) (*CacheEntry, error) {
+	entry, err := h.memory.Get(key)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return entry, err
+	}
+
+	return h.promote(key)
+}
+
+// Peek returns the entry like Get without counting it in Stats. An entry
+// found on disk is still promoted to memory.
+func (h *HybridStorage) Peek(key string) (*CacheEntry, error) {
+	entry, err := h.memory.Peek(key)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return entry, err
+	}
+
+	return h.promote(key)
+}
+
+// promote reads the key from the demotion queue or disk and moves it to
+// memory. If memory can't take it, it goes to (or stays on) disk.
+func (h *HybridStorage) promote(key string) (*CacheEntry, error) {
+	lock := h.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another reader may have promoted it while we waited
+	if entry, err := h.memory.Peek(key); !errors.Is(err, ErrKeyNotFound) {
+		return entry, err
+	}
+
+	// An evicted entry is queued until it's written to disk
+	var value []byte
+	var expiresAt time.Time
+	queued := h.dropDemotion(key)
+	if queued != nil {
+		value, expiresAt = queued.Value, queued.ExpirationTime
+	} else {
+		var err error
+		value, expiresAt, err = h.disk.get(key)
+		if err != nil {
+			if errors.Is(err, ErrCorruptRecord) {
+				return nil, ErrKeyNotFound
+			}
+			return nil, err
+		}
+	}
+	remaining := time.Until(expiresAt)
+	if remaining <= 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	// An empty value on disk is a demoted negative entry
+	negative := len(value) == 0
+	var putErr error
+	if negative {
+		putErr = h.memory.PutNegative(key, remaining)
+	} else {
+		putErr = h.memory.Put(key, value, remaining)
+	}
+	if putErr == nil {
+		h.disk.delete(key)
+	} else if queued != nil {
+		h.disk.put(key, value, expiresAt)
+	}
+
+	return &CacheEntry{
+		Value:        value,
+		Size:         len(value),
+		RemainingTTL: remaining,
+		Negative:     negative,
+	}, nil
+}
+
+// Put stores the value in memory, replacing any copy on disk.
+func (h *HybridStorage) Put(key string, value []byte, ttl time.Duration) error {
+	lock := h.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := h.memory.Put(key, value, ttl); err != nil {
+		return err
+	}
+	h.disk.delete(key)
+	return nil
+}
+
+// PutNegative stores a negative entry in memory, replacing any copy on disk.
+func (h *HybridStorage) PutNegative(key string, ttl time.Duration) error {
+	lock := h.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := h.memory.PutNegative(key, ttl); err != nil {
+		return err
+	}
+	h.disk.delete(key)
+	return nil
+}
+
+// Delete removes the key from both tiers.
+func (h *HybridStorage) Delete(key string) error {
+	lock := h.lockFor(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	memErr := h.memory.Delete(key)
+	if memErr != nil && !errors.Is(memErr, ErrDeleteKeyNotFound) {
+		return memErr
+	}
+	dropped := h.dropDemotion(key) != nil
+	diskErr := h.disk.delete(key)
+
+	if errors.Is(memErr, ErrDeleteKeyNotFound) && errors.Is(diskErr, ErrDeleteKeyNotFound) && !dropped {
+		return ErrDeleteKeyNotFound
+	}
+	return nil
+}
+
+// CanFit checks if there's enough space to store a value of the given size.
+// New values are always written to the memory tier.
+func (h *HybridStorage) CanFit(keySize, valueSize int) bool {
+	return h.memory.CanFit(keySize, valueSize)
+}
+
+// Snapshot writes the entries of the memory tier to w. The disk tier doesn't
+// need one: its entries are reloaded when the storage is reopened.
+func (h *HybridStorage) Snapshot(w io.Writer) error {
+	return h.memory.Snapshot(w)
+}
+
+// Restore loads the entries of a snapshot into the memory tier, demoting to
+// disk what doesn't fit.
+func (h *HybridStorage) Restore(r io.Reader) error {
+	return restoreSnapshot(r, h)
+}
+
+// Close writes the queued demotions to disk and closes the disk log. Entries
+// evicted after Close are dropped.
+func (h *HybridStorage) Close() error {
+	h.closeOnce.Do(func() { close(h.done) })
+	<-h.flushed
+	return h.disk.close()
+}
+
+// queueDemotions is the memory tier's eviction hook. It only queues the
+// entries for the flusher: the caller may hold the lock of another key in the
+// same stripe. A queued entry of the same key is replaced.
+func (h *HybridStorage) queueDemotions(evicted []*CachedObject) {
+	select {
+	case <-h.done:
+		return
+	default:
+	}
+
+	h.demotionsMu.Lock()
+	for _, obj := range evicted {
+		if elem, ok := h.demotionIndex[obj.Key]; ok {
+			h.demotions.Remove(elem)
+		} else if h.demotions.Len() >= maxQueuedDemotions {
+			continue
+		}
+		h.demotionIndex[obj.Key] = h.demotions.PushBack(obj)
+	}
+	h.demotionsMu.Unlock()
+
+	select {
+	case h.flush <- struct{}{}:
+	default:
+	}
+}
+
+// flushLoop writes queued demotions to disk whenever entries are queued,
+// until Close
+func (h *HybridStorage) flushLoop() {
+	defer close(h.flushed)
+	for {
+		select {
+		case <-h.flush:
+			h.flushDemotions()
+		case <-h.done:
+			h.flushDemotions()
+			return
+		}
+	}
+}
+
+// flushDemotions writes queued evictions to disk. An entry is skipped if it
+// has expired or a newer value for its key has been stored in memory since.
+// Entries are only dequeued under their key lock, so a concurrent Delete or
+// promotion either takes the entry first or sees it on disk.
+// Must be called without holding any key lock.
+func (h *HybridStorage) flushDemotions() {
+	for {
+		h.demotionsMu.Lock()
+		front := h.demotions.Front()
+		h.demotionsMu.Unlock()
+		if front == nil {
+			return
+		}
+		obj := front.Value.(*CachedObject)
+
+		lock := h.lockFor(obj.Key)
+		lock.Lock()
+		if h.dequeueDemotion(obj) && obj.ExpirationTime.After(time.Now()) && !h.memory.contains(obj.Key) {
+			h.disk.put(obj.Key, obj.Value, obj.ExpirationTime)
+		}
+		lock.Unlock()
+	}
+}
+
+// dequeueDemotion removes the entry from the demotion queue. Returns false if
+// it was already taken, e.g. by a Delete of its key, or replaced.
+// The key lock must be held by caller.
+func (h *HybridStorage) dequeueDemotion(obj *CachedObject) bool {
+	h.demotionsMu.Lock()
+	defer h.demotionsMu.Unlock()
+
+	elem, ok := h.demotionIndex[obj.Key]
+	if !ok || elem.Value != obj {
+		return false
+	}
+	h.demotions.Remove(elem)
+	delete(h.demotionIndex, obj.Key)
+	return true
+}
+
+// dropDemotion removes the queued demotion of the key, so a deleted entry
+// isn't written to disk afterwards. Returns the removed entry, or nil.
+// The key lock must be held by caller.
+func (h *HybridStorage) dropDemotion(key string) *CachedObject {
+	h.demotionsMu.Lock()
+	defer h.demotionsMu.Unlock()
+
+	elem, ok := h.demotionIndex[key]
+	if !ok {
+		return nil
+	}
+	h.demotions.Remove(elem)
+	delete(h.demotionIndex, key)
+	return elem.Value.(*CachedObject)
+}
+
+// lockFor returns the lock stripe of the key
+func (h *HybridStorage) lockFor(key string) *sync.Mutex {
+	return &h.locks[xxh3.HashString(key)%hybridLockStripes]
+}
+
+// setEvictionHook sets the function that receives evicted entries
+func (s *InMemoryStorage) setEvictionHook(fn func(evicted []*CachedObject)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onEvict = fn
+}
+
+// setEvictionHook sets the function that receives evicted entries on every shard
+func (s *ShardedStorage) setEvictionHook(fn func(evicted []*CachedObject)) {
+	for _, shard := range s.shards {
+		shard.setEvictionHook(fn)
+	}
+}
+
+// contains reports whether the shard that owns the key stores it
+func (s *ShardedStorage) contains(key string) bool {
+	return s.shardFor(key).contains(key)
+}
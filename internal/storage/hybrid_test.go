@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestHybridStorage(t *testing.T, path string, maxMemory uint64, opts ...StorageOptions) *HybridStorage {
+	t.Helper()
+	h, err := NewHybridStorage(maxMemory, DiskOptions{Path: path, MaxBytes: 1 << 20}, opts...)
+	if err != nil {
+		t.Fatalf("NewHybridStorage() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestHybridStorage_EvictionDemotesToDisk(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 300)
+	value := bytes.Repeat([]byte("x"), 95)
+
+	for i := 0; i < 5; i++ {
+		if err := h.Put(fmt.Sprintf("key-%d", i), value, time.Hour); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// Demotions are written in the background; flush to check the disk now
+	h.flushDemotions()
+	if _, _, err := h.disk.get("key-0"); err != nil {
+		t.Fatalf("evicted key-0 not on disk: %v", err)
+	}
+
+	entry, err := h.Get("key-0")
+	if err != nil {
+		t.Fatalf("Get() of demoted key error = %v", err)
+	}
+	if !bytes.Equal(entry.Value, value) || entry.RemainingTTL <= 0 || entry.RemainingTTL > time.Hour {
+		t.Errorf("Get() = %d bytes, ttl %v", len(entry.Value), entry.RemainingTTL)
+	}
+
+	// Promotion moves the entry back to memory
+	if !h.memory.contains("key-0") {
+		t.Error("key-0 not promoted to memory")
+	}
+	if _, _, err := h.disk.get("key-0"); err != ErrKeyNotFound {
+		t.Errorf("promoted key-0 still on disk: %v", err)
+	}
+
+	// Every key is still readable from one tier or the other
+	for i := 0; i < 5; i++ {
+		if _, err := h.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("Get(key-%d) error = %v", i, err)
+		}
+	}
+}
+
+func TestHybridStorage_ExpiredNotDemoted(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 200)
+	value := bytes.Repeat([]byte("x"), 95)
+
+	h.Put("short", value, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	h.Put("a", value, time.Hour)
+	h.Put("b", value, time.Hour)
+	h.flushDemotions()
+
+	if _, err := h.Get("short"); err != ErrKeyNotFound {
+		t.Errorf("Get() of expired key error = %v, want ErrKeyNotFound", err)
+	}
+	if _, _, err := h.disk.get("short"); err != ErrKeyNotFound {
+		t.Errorf("expired key demoted to disk: %v", err)
+	}
+}
+
+func TestHybridStorage_PutReplacesDiskCopy(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000)
+
+	h.disk.put("key", []byte("old"), time.Now().Add(time.Hour))
+	if err := h.Put("key", []byte("new"), time.Hour); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if _, _, err := h.disk.get("key"); err != ErrKeyNotFound {
+		t.Errorf("stale disk copy kept: %v", err)
+	}
+	entry, _ := h.Get("key")
+	if string(entry.Value) != "new" {
+		t.Errorf("Get() = %q, want %q", entry.Value, "new")
+	}
+}
+
+func TestHybridStorage_DeleteBothTiers(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000)
+
+	h.Put("key", []byte("memory"), time.Hour)
+	h.disk.put("key", []byte("disk"), time.Now().Add(time.Hour))
+	h.disk.put("disk-only", []byte("disk"), time.Now().Add(time.Hour))
+
+	if err := h.Delete("key"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := h.Delete("disk-only"); err != nil {
+		t.Errorf("Delete() of disk-only key error = %v", err)
+	}
+	for _, key := range []string{"key", "disk-only"} {
+		if _, err := h.Get(key); err != ErrKeyNotFound {
+			t.Errorf("Get(%q) after delete error = %v, want ErrKeyNotFound", key, err)
+		}
+	}
+
+	if err := h.Delete("missing"); err != ErrDeleteKeyNotFound {
+		t.Errorf("Delete() of missing key error = %v, want ErrDeleteKeyNotFound", err)
+	}
+}
+
+func TestHybridStorage_DeleteDuringFlush(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000)
+	h.queueDemotions([]*CachedObject{{Key: "key", Value: []byte("old"), ExpirationTime: time.Now().Add(time.Hour)}})
+
+	// The flush picks the entry, then waits for the key lock held by a Delete
+	lock := h.lockFor("key")
+	lock.Lock()
+	flushed := make(chan struct{})
+	go func() {
+		h.flushDemotions()
+		close(flushed)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if h.dropDemotion("key") == nil {
+		t.Error("Delete should find the queued demotion")
+	}
+	lock.Unlock()
+	<-flushed
+
+	if _, err := h.Get("key"); err != ErrKeyNotFound {
+		t.Errorf("Get() after delete error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestHybridStorage_FlushesInBackground(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000)
+	expiresAt := time.Now().Add(time.Hour)
+	h.queueDemotions([]*CachedObject{
+		{Key: "key", Value: []byte("old"), ExpirationTime: expiresAt},
+		{Key: "key", Value: []byte("new"), ExpirationTime: expiresAt},
+	})
+
+	// A key is queued once, with its latest entry
+	h.demotionsMu.Lock()
+	queued := h.demotions.Len()
+	h.demotionsMu.Unlock()
+	if queued > 1 {
+		t.Errorf("queued demotions = %d, want at most 1", queued)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		value, _, err := h.disk.get("key")
+		if err == nil {
+			if string(value) != "new" {
+				t.Errorf("disk value = %q, want %q", value, "new")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queued demotion was not written to disk")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHybridStorage_StaleEntryKeepsOlderDemotionOffDisk(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000, StorageOptions{StaleGrace: time.Hour})
+
+	// A newer value is in memory in its stale window when the older one is flushed
+	h.Put("key", []byte("new"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	h.queueDemotions([]*CachedObject{{Key: "key", Value: []byte("old"), ExpirationTime: time.Now().Add(time.Hour)}})
+	h.flushDemotions()
+
+	if _, _, err := h.disk.get("key"); err != ErrKeyNotFound {
+		t.Errorf("older value demoted to disk: %v", err)
+	}
+	entry, err := h.Get("key")
+	if err != nil || string(entry.Value) != "new" || !entry.Stale {
+		t.Errorf("Get() = %+v, %v, want the stale newer value", entry, err)
+	}
+}
+
+func TestHybridStorage_GetFindsQueuedDemotion(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000)
+	h.queueDemotions([]*CachedObject{{Key: "key", Value: []byte("value"), ExpirationTime: time.Now().Add(time.Hour)}})
+
+	entry, err := h.Get("key")
+	if err != nil || string(entry.Value) != "value" {
+		t.Fatalf("Get() = %+v, %v, want the queued value", entry, err)
+	}
+	if !h.memory.contains("key") {
+		t.Error("queued entry should be promoted to memory")
+	}
+}
+
+func TestHybridStorage_ServesDiskAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	value := bytes.Repeat([]byte("x"), 95)
+
+	h, err := NewHybridStorage(200, DiskOptions{Path: path, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewHybridStorage() error = %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		h.Put(fmt.Sprintf("key-%d", i), value, time.Hour)
+	}
+	h.Close()
+
+	// Only what was demoted survives; memory starts empty
+	h = newTestHybridStorage(t, path, 200)
+	for i := 0; i < 2; i++ {
+		if _, err := h.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("Get(key-%d) after restart error = %v", i, err)
+		}
+	}
+}
+
+func TestHybridStorage_ShardedMemory(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 800, StorageOptions{Shards: 4})
+	value := bytes.Repeat([]byte("x"), 95)
+
+	for i := 0; i < 40; i++ {
+		if err := h.Put(fmt.Sprintf("key-%d", i), value, time.Hour); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	for i := 0; i < 40; i++ {
+		if _, err := h.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("Get(key-%d) error = %v", i, err)
+		}
+	}
+}
+
+func TestHybridStorage_Concurrent(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 1000, StorageOptions{Shards: 2})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key-%d", (w*7+i)%30)
+				switch i % 4 {
+				case 0, 1:
+					h.Put(key, []byte(key+"-value-padding-padding"), time.Hour)
+				case 2:
+					if entry, err := h.Get(key); err == nil && string(entry.Value) != key+"-value-padding-padding" {
+						t.Errorf("Get(%q) = %q", key, entry.Value)
+					}
+				case 3:
+					h.Delete(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestHybridStorage_NegativeEntryDemotedAndPromoted(t *testing.T) {
+	h := newTestHybridStorage(t, filepath.Join(t.TempDir(), "log"), 300)
+
+	if err := h.PutNegative("negative", time.Hour); err != nil {
+		t.Fatalf("PutNegative() error = %v", err)
+	}
+	value := bytes.Repeat([]byte("x"), 95)
+	for i := 0; i < 4; i++ {
+		h.Put(fmt.Sprintf("key-%d", i), value, time.Hour)
+	}
+	if h.memory.contains("negative") {
+		t.Fatal("negative entry should have been evicted from memory")
+	}
+
+	entry, err := h.Get("negative")
+	if err != nil {
+		t.Fatalf("Get() of demoted negative entry error = %v", err)
+	}
+	if !entry.Negative || len(entry.Value) != 0 {
+		t.Errorf("Get() = %+v, want a negative entry", entry)
+	}
+	if entry, _ := h.memory.Get("negative"); entry == nil || !entry.Negative {
+		t.Error("negative entry not promoted to memory as negative")
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"math"
+	"sort"
+)
+
+// lfuPolicy is an O(1) LFU: entries are kept in one LRU list per access count,
+// and the victim is the least recently used entry of the lowest count.
+type lfuPolicy struct {
+	buckets map[uint32]*lruList
+	minFreq uint32
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: make(map[uint32]*lruList)}
+}
+
+func (p *lfuPolicy) OnInsert(obj *CachedObject) {
+	obj.freq = 1
+	p.bucket(1).append(obj)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) OnAccess(obj *CachedObject) {
+	if obj.freq == math.MaxUint32 {
+		p.buckets[obj.freq].moveToTail(obj)
+		return
+	}
+	p.unlink(obj)
+	obj.freq++
+	p.bucket(obj.freq).append(obj)
+}
+
+func (p *lfuPolicy) OnRemove(obj *CachedObject) {
+	p.unlink(obj)
+	obj.freq = 0
+}
+
+func (p *lfuPolicy) Victim() *CachedObject {
+	if len(p.buckets) == 0 {
+		return nil
+	}
+	b, ok := p.buckets[p.minFreq]
+	if !ok {
+		// The minimum bucket was emptied by a removal; find the new one
+		p.minFreq = math.MaxUint32
+		for freq := range p.buckets {
+			if freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+		b = p.buckets[p.minFreq]
+	}
+	return b.front()
+}
+
+func (p *lfuPolicy) Walk(fn func(obj *CachedObject) bool) {
+	freqs := make([]uint32, 0, len(p.buckets))
+	for freq := range p.buckets {
+		freqs = append(freqs, freq)
+	}
+	sort.Slice(freqs, func(i, j int) bool { return freqs[i] < freqs[j] })
+
+	for _, freq := range freqs {
+		b, ok := p.buckets[freq]
+		if !ok {
+			continue
+		}
+		if !walkList(b, fn) {
+			return
+		}
+	}
+}
+
+// bucket returns the list for the given access count, creating it if needed
+func (p *lfuPolicy) bucket(freq uint32) *lruList {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = &lruList{}
+		p.buckets[freq] = b
+	}
+	return b
+}
+
+// unlink removes the object from its bucket, dropping the bucket if it empties
+func (p *lfuPolicy) unlink(obj *CachedObject) {
+	b := p.buckets[obj.freq]
+	b.remove(obj)
+	if b.empty() {
+		delete(p.buckets, obj.freq)
+		if p.minFreq == obj.freq {
+			p.minFreq++
+		}
+	}
+}
@@ -8,9 +8,19 @@ type CachedObject struct {
 	Value          []byte
 	ExpirationTime time.Time
 
-	// Linked list pointers for LRU tracking
+	// Linked list pointers, used by the eviction policy that tracks this object
 	prev *CachedObject
 	next *CachedObject
+
+	// Eviction policy bookkeeping
+	freq    uint32 // LFU access count
+	visited bool   // SIEVE visited bit
+	segment uint8  // W-TinyLFU segment
+}
+
+// IsNegative reports whether this is a negative entry (see PutNegative).
+func (c *CachedObject) IsNegative() bool {
+	return len(c.Value) == 0
 }
 
 // GetBytesUsed returns the total bytes used by the key and value.
@@ -77,3 +87,12 @@ func (l *lruList) front() *CachedObject {
 	return l.head
 }
 
+// back returns the tail of the list (most recently used).
+func (l *lruList) back() *CachedObject {
+	return l.tail
+}
+
+// empty reports whether the list has no nodes.
+func (l *lruList) empty() bool {
+	return l.head == nil
+}
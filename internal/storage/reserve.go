@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// Reserver is implemented by storages that can set aside room for a value
+// before its bytes are available. This lets a server decide whether an upload
+// fits (evicting as needed) before reading the request body.
+type Reserver interface {
+	// Reserve sets aside room for a key and a value of the given size.
+	// The reservation must be either committed or released.
+	Reserve(key string, valueSize int) (*Reservation, error)
+}
+
+// Reservation is room set aside in an InMemoryStorage for a pending value.
+// Reserved bytes count against the memory limit until the reservation is
+// committed or released.
+type Reservation struct {
+	storage *InMemoryStorage
+	key     string
+	bytes   uint64
+	// done is set once committed or released. Guarded by storage.mutex.
+	done bool
+}
+
+// Reserve sets aside room for a key and a value of the given size, deleting
+// ttl'ed keys and evicting as needed. Returns the same errors as Put.
+func (s *InMemoryStorage) Reserve(key string, valueSize int) (*Reservation, error) {
+	// Validate before acquiring lock to reduce lock hold time
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	if valueSize <= 0 {
+		return nil, ErrValueTooShort
+	}
+
+	size := uint64(len(key) + valueSize)
+
+	if size > s.maxMemory {
+		return nil, ErrObjectTooLarge
+	}
+
+	s.mutex.Lock()
+	// An existing value for the key stays readable until the commit replaces
+	// it, so the reservation needs room of its own.
+	fits := s.makeRoomUnlocked(size) && s.budget.tryAcquire(size)
+	pending := s.takePendingUnlocked()
+	s.mutex.Unlock()
+
+	s.deliver(pending)
+	if !fits {
+		return nil, ErrMemoryLimitExceeded
+	}
+	return &Reservation{storage: s, key: key, bytes: size}, nil
+}
+
+// Commit stores the value in the reserved room.
+// The value may differ in size from the reservation; the difference is
+// accounted for as in Put. Commit fails if the reservation was already used.
+func (r *Reservation) Commit(value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		r.Release()
+		return ErrInvalidTTL
+	}
+
+	if len(value) == 0 {
+		r.Release()
+		return ErrValueTooShort
+	}
+
+	r.storage.mutex.Lock()
+	if r.done {
+		r.storage.mutex.Unlock()
+		return ErrReservationDone
+	}
+	// The reserved room goes to the value rather than back to the budget
+	r.done = true
+	err := r.storage.putUnlocked(r.key, value, ttl, r.bytes)
+	pending := r.storage.takePendingUnlocked()
+	r.storage.mutex.Unlock()
+
+	r.storage.deliver(pending)
+	return err
+}
+
+// Release returns the reserved room to the storage.
+// It is a no-op if the reservation was already committed or released.
+func (r *Reservation) Release() {
+	r.storage.mutex.Lock()
+	defer r.storage.mutex.Unlock()
+
+	if !r.done {
+		r.releaseUnlocked()
+	}
+}
+
+// releaseUnlocked returns the reserved bytes. Lock must be held by caller.
+func (r *Reservation) releaseUnlocked() {
+	r.done = true
+	r.storage.budget.release(r.bytes)
+}
+
+// Reserve sets aside room in the shard that owns the key
+func (s *ShardedStorage) Reserve(key string, valueSize int) (*Reservation, error) {
+	shard := s.shardFor(key)
+	r, err := shard.Reserve(key, valueSize)
+	if errors.Is(err, ErrMemoryLimitExceeded) && s.reclaimOutside(shard, uint64(len(key)+valueSize)) {
+		r, err = shard.Reserve(key, valueSize)
+	}
+	return r, err
+}
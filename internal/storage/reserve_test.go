@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// assertBudgetUsed checks the bytes held against the memory limit, which
+// include reservations
+func assertBudgetUsed(t *testing.T, s *InMemoryStorage, expected uint64) {
+	t.Helper()
+	if used := s.budget.used.Load(); used != expected {
+		t.Errorf("budget used = %d, want %d", used, expected)
+	}
+}
+
+func TestReserve_CommitStoresValue(t *testing.T) {
+	s := newStorage(1000)
+
+	r, err := s.Reserve("key", 5)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	// The reservation counts against the limit before anything is stored
+	assertBudgetUsed(t, s, 8)
+	assertMemoryUsed(t, s, 0)
+
+	// The reserved room goes to the value
+	if err := r.Commit([]byte("value"), time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	assertBudgetUsed(t, s, 8)
+	assertMemoryUsed(t, s, 8)
+
+	entry, err := s.Get("key")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(entry.Value) != "value" {
+		t.Errorf("Get() = %q, want %q", entry.Value, "value")
+	}
+
+	// A reservation can only be used once
+	if err := r.Commit([]byte("again"), time.Hour); err != ErrReservationDone {
+		t.Errorf("second Commit() error = %v, want ErrReservationDone", err)
+	}
+	r.Release()
+	assertBudgetUsed(t, s, 8)
+}
+
+func TestReserve_ReleaseReturnsRoom(t *testing.T) {
+	s := newStorage(100)
+
+	r, err := s.Reserve("key", 90)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	// Reserved bytes are not available to other writers
+	if err := s.Put("other", make([]byte, 50), time.Hour); err != ErrMemoryLimitExceeded {
+		t.Errorf("Put() while reserved error = %v, want ErrMemoryLimitExceeded", err)
+	}
+	if _, err := s.Reserve("other", 50); err != ErrMemoryLimitExceeded {
+		t.Errorf("Reserve() while reserved error = %v, want ErrMemoryLimitExceeded", err)
+	}
+
+	r.Release()
+	if err := s.Put("other", make([]byte, 50), time.Hour); err != nil {
+		t.Errorf("Put() after Release error = %v", err)
+	}
+}
+
+func TestReserve_EvictsToMakeRoom(t *testing.T) {
+	s := newStorage(100)
+	mustPut(t, s, "a", make([]byte, 39), time.Hour) // 40 bytes
+	mustPut(t, s, "b", make([]byte, 39), time.Hour) // 40 bytes
+
+	r, err := s.Reserve("key", 47) // 50 bytes
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	defer r.Release()
+
+	if _, err := s.Get("a"); err != ErrKeyNotFound {
+		t.Errorf("Get(a) error = %v, want ErrKeyNotFound (evicted)", err)
+	}
+	if _, err := s.Get("b"); err != nil {
+		t.Errorf("Get(b) error = %v, want hit", err)
+	}
+}
+
+func TestReserve_Errors(t *testing.T) {
+	s := newStorage(100)
+
+	if _, err := s.Reserve("", 10); err != ErrKeyTooShort {
+		t.Errorf("Reserve(\"\") error = %v, want ErrKeyTooShort", err)
+	}
+	if _, err := s.Reserve("key", 0); err != ErrValueTooShort {
+		t.Errorf("Reserve(0) error = %v, want ErrValueTooShort", err)
+	}
+	if _, err := s.Reserve("key", 100); err != ErrObjectTooLarge {
+		t.Errorf("Reserve(100) error = %v, want ErrObjectTooLarge", err)
+	}
+}
+
+func TestReserve_CommitInvalidValueReleases(t *testing.T) {
+	s := newStorage(100)
+
+	r, _ := s.Reserve("key", 10)
+	if err := r.Commit(nil, time.Hour); err != ErrValueTooShort {
+		t.Errorf("Commit(nil) error = %v, want ErrValueTooShort", err)
+	}
+	assertBudgetUsed(t, s, 0)
+}
+
+func TestShardedStorage_Reserve(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	r, err := s.Reserve("key", 5)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if err := r.Commit([]byte("value"), time.Hour); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if entry, err := s.Get("key"); err != nil || string(entry.Value) != "value" {
+		t.Errorf("Get() = %v, %v", entry, err)
+	}
+}
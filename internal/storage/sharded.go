@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+// ShardedStorage is a local storage implementation that hashes keys with xxh3
+// into independent InMemoryStorage shards, so that operations on different keys
+// don't serialize on a single mutex.
+//
+// Each shard has its own map and LRU list, and all shards take memory from one
+// shared budget of maxMemory bytes, so the global limit is never exceeded and
+// any object up to maxMemory fits. A write evicts from its own shard first and
+// only evicts from other shards when that doesn't free enough.
+type ShardedStorage struct {
+	shards    []*InMemoryStorage
+	maxMemory uint64
+}
+
+// NewShardedStorage creates a ShardedStorage with opts.Shards shards
+// (at least one) sharing maxMemory.
+func NewShardedStorage(maxMemory uint64, opts ...StorageOptions) *ShardedStorage {
+	var opt StorageOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	numShards := opt.Shards
+	if numShards < 1 {
+		numShards = 1
+	}
+
+	shardOpt := opt
+	shardOpt.InitialCapacity = opt.InitialCapacity / numShards
+	shardOpt.Shards = 0
+
+	s := &ShardedStorage{
+		shards:    make([]*InMemoryStorage, numShards),
+		maxMemory: maxMemory,
+	}
+	budget := &memoryBudget{max: maxMemory}
+	for i := range s.shards {
+		s.shards[i] = NewInMemoryStorage(maxMemory, shardOpt)
+		s.shards[i].budget = budget
+	}
+	return s
+}
+
+// NewStorage creates the local storage selected by the options: a
+// ShardedStorage if opts.Shards > 1, otherwise a single InMemoryStorage.
+func NewStorage(maxMemory uint64, opts ...StorageOptions) LocalStorage {
+	if len(opts) > 0 && opts[0].Shards > 1 {
+		return NewShardedStorage(maxMemory, opts...)
+	}
+	return NewInMemoryStorage(maxMemory, opts...)
+}
+
+func (s *ShardedStorage) Get(key string) (*CacheEntry, error) {
+	return s.shardFor(key).Get(key)
+}
+
+// Peek returns the entry from the shard that owns the key without counting it
+func (s *ShardedStorage) Peek(key string) (*CacheEntry, error) {
+	return s.shardFor(key).Peek(key)
+}
+
+func (s *ShardedStorage) Put(key string, value []byte, ttl time.Duration) error {
+	shard := s.shardFor(key)
+	err := shard.Put(key, value, ttl)
+	if errors.Is(err, ErrMemoryLimitExceeded) && s.reclaimOutside(shard, uint64(len(key)+len(value))) {
+		err = shard.Put(key, value, ttl)
+	}
+	return err
+}
+
+func (s *ShardedStorage) PutNegative(key string, ttl time.Duration) error {
+	shard := s.shardFor(key)
+	err := shard.PutNegative(key, ttl)
+	if errors.Is(err, ErrMemoryLimitExceeded) && s.reclaimOutside(shard, uint64(len(key))) {
+		err = shard.PutNegative(key, ttl)
+	}
+	return err
+}
+
+func (s *ShardedStorage) Delete(key string) error {
+	return s.shardFor(key).Delete(key)
+}
+
+// CanFit checks if there's enough space to store a value of the given size.
+// Every shard can take up to the whole shared budget, so any shard answers
+// for all keys.
+func (s *ShardedStorage) CanFit(keySize, valueSize int) bool {
+	return s.shards[0].CanFit(keySize, valueSize)
+}
+
+// reclaimOutside frees memory in the shards other than the given one until
+// an object of the given size fits in the shared budget.
+// Returns false if nothing could be freed.
+func (s *ShardedStorage) reclaimOutside(shard *InMemoryStorage, size uint64) bool {
+	freed := false
+	for _, other := range s.shards {
+		available := shard.budget.available()
+		if size <= available {
+			break
+		}
+		if other != shard && other.reclaim(size-available) > 0 {
+			freed = true
+		}
+	}
+	return freed
+}
+
+// shardFor returns the shard that owns the key
+func (s *ShardedStorage) shardFor(key string) *InMemoryStorage {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	return s.shards[xxh3.HashString(key)%uint64(len(s.shards))]
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// shardedMemoryUsed sums the memory used across all shards
+func shardedMemoryUsed(s *ShardedStorage) uint64 {
+	total := uint64(0)
+	for _, shard := range s.shards {
+		shard.mutex.Lock()
+		total += shard.memoryUsedBytes
+		shard.mutex.Unlock()
+	}
+	return total
+}
+
+func TestNewShardedStorage_SharesBudget(t *testing.T) {
+	s := NewShardedStorage(1003, StorageOptions{Shards: 4})
+
+	if len(s.shards) != 4 {
+		t.Fatalf("shards = %d, want 4", len(s.shards))
+	}
+
+	for _, shard := range s.shards {
+		if shard.budget != s.shards[0].budget {
+			t.Error("shards should share one budget")
+		}
+	}
+	if s.shards[0].budget.max != 1003 {
+		t.Errorf("budget = %d, want 1003", s.shards[0].budget.max)
+	}
+}
+
+func TestNewShardedStorage_ZeroShards(t *testing.T) {
+	s := NewShardedStorage(1000)
+	if len(s.shards) != 1 {
+		t.Errorf("shards = %d, want 1", len(s.shards))
+	}
+}
+
+func TestNewStorage_SelectsMode(t *testing.T) {
+	if _, ok := NewStorage(1000).(*InMemoryStorage); !ok {
+		t.Error("NewStorage() without options should return *InMemoryStorage")
+	}
+	if _, ok := NewStorage(1000, StorageOptions{Shards: 1}).(*InMemoryStorage); !ok {
+		t.Error("NewStorage() with 1 shard should return *InMemoryStorage")
+	}
+	if _, ok := NewStorage(1000, StorageOptions{Shards: 8}).(*ShardedStorage); !ok {
+		t.Error("NewStorage() with 8 shards should return *ShardedStorage")
+	}
+}
+
+func TestShardedStorage_PutGetDelete(t *testing.T) {
+	s := NewShardedStorage(100000, StorageOptions{Shards: 8})
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if err := s.Put(key, []byte(key), time.Hour); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		entry, err := s.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		if string(entry.Value) != key {
+			t.Errorf("Get(%q) = %q", key, entry.Value)
+		}
+	}
+
+	if err := s.Delete("key-0"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := s.Get("key-0"); err != ErrKeyNotFound {
+		t.Errorf("Get() after Delete error = %v, want ErrKeyNotFound", err)
+	}
+	if err := s.Delete("key-0"); err != ErrDeleteKeyNotFound {
+		t.Errorf("second Delete() error = %v, want ErrDeleteKeyNotFound", err)
+	}
+}
+
+func TestShardedStorage_KeysSpreadAcrossShards(t *testing.T) {
+	s := NewShardedStorage(1000000, StorageOptions{Shards: 4})
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if err := s.Put(key, []byte("v"), time.Hour); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+
+	for i, shard := range s.shards {
+		if n := len(shard.store); n < 150 || n > 350 {
+			t.Errorf("shard %d holds %d keys, want roughly 250", i, n)
+		}
+	}
+}
+
+func TestShardedStorage_ValidatesKeys(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	if _, err := s.Get(""); err != ErrKeyTooShort {
+		t.Errorf("Get(\"\") error = %v, want ErrKeyTooShort", err)
+	}
+	if err := s.Put("", []byte("v"), time.Hour); err != ErrKeyTooShort {
+		t.Errorf("Put(\"\") error = %v, want ErrKeyTooShort", err)
+	}
+}
+
+func TestShardedStorage_CanFit(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	if !s.CanFit(10, 500) {
+		t.Error("CanFit should return true for an object larger than a quarter of the budget")
+	}
+	if s.CanFit(10, 1000) {
+		t.Error("CanFit should return false for an object larger than the budget")
+	}
+}
+
+func TestShardedStorage_ObjectLargerThanShare(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	if err := s.Put("key", make([]byte, 900), time.Hour); err != nil {
+		t.Errorf("Put() error = %v, want nil", err)
+	}
+	if err := s.Put("key", make([]byte, 1000), time.Hour); err != ErrObjectTooLarge {
+		t.Errorf("Put() error = %v, want ErrObjectTooLarge", err)
+	}
+}
+
+func TestShardedStorage_EvictsFromOtherShards(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	// Fill the budget through every shard
+	for i := 0; i < 10; i++ {
+		if err := s.Put(fmt.Sprintf("key-%d", i), make([]byte, 95), time.Hour); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// A large value needs room held by other shards
+	if err := s.Put("large", make([]byte, 600), time.Hour); err != nil {
+		t.Fatalf("Put() error = %v, want other shards to make room", err)
+	}
+	if _, err := s.Get("large"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if used := shardedMemoryUsed(s); used > 1000 {
+		t.Errorf("memory used = %d, want at most 1000", used)
+	}
+}
+
+func TestShardedStorage_MemoryLimitEnforcedGlobally(t *testing.T) {
+	s := NewShardedStorage(10000, StorageOptions{Shards: 8})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				key := fmt.Sprintf("key-%d-%d", id, j)
+				s.Put(key, make([]byte, 50), time.Hour)
+				s.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if used := shardedMemoryUsed(s); used > 10000 {
+		t.Errorf("memory used = %d, exceeds maxMemory", used)
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+// sievePolicy implements SIEVE (Zhang et al., NSDI '24).
+//
+// Entries sit in a FIFO queue (oldest at the head). Accesses only set a visited
+// bit. To find a victim, a hand sweeps from where it last stopped toward newer
+// entries, clearing visited bits, and stops at the first unvisited entry.
+type sievePolicy struct {
+	list lruList
+	hand *CachedObject
+}
+
+func (p *sievePolicy) OnInsert(obj *CachedObject) {
+	obj.visited = false
+	p.list.append(obj)
+}
+
+func (p *sievePolicy) OnAccess(obj *CachedObject) {
+	obj.visited = true
+}
+
+func (p *sievePolicy) OnRemove(obj *CachedObject) {
+	if p.hand == obj {
+		p.hand = obj.next
+	}
+	p.list.remove(obj)
+}
+
+func (p *sievePolicy) Victim() *CachedObject {
+	ptr := p.hand
+	if ptr == nil {
+		ptr = p.list.front()
+	}
+	// Terminates: every visited entry passed is cleared, so a full sweep finds one
+	for ptr != nil && ptr.visited {
+		ptr.visited = false
+		ptr = ptr.next
+		if ptr == nil {
+			ptr = p.list.front()
+		}
+	}
+	p.hand = ptr
+	return ptr
+}
+
+func (p *sievePolicy) Walk(fn func(obj *CachedObject) bool) {
+	walkList(&p.list, fn)
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/satmihir/justcache/internal/constants"
+)
+
+// Snapshot layout: a magic and version header, one record per entry from the
+// coldest to the hottest, an end record with an empty key, and a CRC of
+// everything before it. A record with an empty value is a negative entry.
+//
+//	magic "JCSN" | version (uint8)
+//	expiresAt (int64 unix nanos) | keyLen (uint16) | valueLen (uint32) | key | value
+//	...
+//	0 (int64) | 0 (uint16) | 0 (uint32)
+//	crc (uint32)
+const (
+	snapshotMagic      = "JCSN"
+	snapshotVersion    = 1
+	snapshotRecordSize = 8 + 2 + 4
+)
+
+var (
+	ErrSnapshotCorrupt     = errors.New("corrupt snapshot")
+	ErrUnsupportedSnapshot = errors.New("unsupported snapshot version")
+)
+
+// Snapshotter is implemented by storages that can save their entries and load
+// them back, so a restarted server doesn't start cold.
+type Snapshotter interface {
+	// Snapshot writes the live entries to w.
+	Snapshot(w io.Writer) error
+	// Restore loads the entries of a snapshot. Nothing is loaded if the
+	// snapshot is corrupt.
+	Restore(r io.Reader) error
+}
+
+// snapshotEntry is an entry copied out of a storage for a snapshot
+type snapshotEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// Snapshot writes the live entries to w, from the coldest to the hottest, so
+// that Restore rebuilds the eviction order. Expiry is saved as an absolute
+// time: the time spent down counts against the TTL.
+func (s *InMemoryStorage) Snapshot(w io.Writer) error {
+	return writeSnapshot(w, s.snapshotEntries())
+}
+
+// Restore loads the entries of a snapshot, dropping those that have expired.
+// Entries that don't fit the storage are skipped; as they're loaded from the
+// coldest, the hottest ones are kept.
+func (s *InMemoryStorage) Restore(r io.Reader) error {
+	return restoreSnapshot(r, s)
+}
+
+// snapshotEntries copies the live entries in eviction order. The values are
+// shared, not copied: stored values are never modified in place.
+func (s *InMemoryStorage) snapshotEntries() []snapshotEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	entries := make([]snapshotEntry, 0, len(s.store))
+	s.policy.Walk(func(obj *CachedObject) bool {
+		if obj.ExpirationTime.After(now) {
+			entries = append(entries, snapshotEntry{key: obj.Key, value: obj.Value, expiresAt: obj.ExpirationTime})
+		}
+		return true
+	})
+	return entries
+}
+
+// Snapshot writes the live entries of every shard to w.
+// Each shard is copied under its own lock, so the snapshot isn't a single
+// point in time across shards.
+func (s *ShardedStorage) Snapshot(w io.Writer) error {
+	var entries []snapshotEntry
+	for _, shard := range s.shards {
+		entries = append(entries, shard.snapshotEntries()...)
+	}
+	return writeSnapshot(w, entries)
+}
+
+// Restore loads the entries of a snapshot into the shards that own them.
+// A snapshot taken with a different number of shards can be restored.
+func (s *ShardedStorage) Restore(r io.Reader) error {
+	return restoreSnapshot(r, s)
+}
+
+// writeSnapshot encodes the entries to w
+func writeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+
+	header := make([]byte, snapshotRecordSize)
+	for _, entry := range entries {
+		binary.BigEndian.PutUint64(header[0:], uint64(entry.expiresAt.UnixNano()))
+		binary.BigEndian.PutUint16(header[8:], uint16(len(entry.key)))
+		binary.BigEndian.PutUint32(header[10:], uint32(len(entry.value)))
+		bw.Write(header)
+		bw.WriteString(entry.key)
+		if _, err := bw.Write(entry.value); err != nil {
+			return err
+		}
+	}
+
+	// End record
+	clear(header)
+	bw.Write(header)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// restoreSnapshot decodes a snapshot from r and stores its unexpired entries
+// in the storage, from the coldest to the hottest. The whole snapshot is
+// checked before anything is stored.
+func restoreSnapshot(r io.Reader, store LocalStorage) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		ttl := entry.expiresAt.Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		// Entries that don't fit are skipped
+		if len(entry.value) == 0 {
+			store.PutNegative(entry.key, ttl)
+		} else {
+			store.Put(entry.key, entry.value, ttl)
+		}
+	}
+	return nil
+}
+
+// readSnapshot decodes and verifies a snapshot
+func readSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(r)
+	body := io.TeeReader(br, crc)
+
+	magic := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(body, magic); err != nil {
+		return nil, ErrSnapshotCorrupt
+	}
+	if string(magic[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotCorrupt
+	}
+	if magic[len(snapshotMagic)] != snapshotVersion {
+		return nil, ErrUnsupportedSnapshot
+	}
+
+	var entries []snapshotEntry
+	header := make([]byte, snapshotRecordSize)
+	for {
+		if _, err := io.ReadFull(body, header); err != nil {
+			return nil, ErrSnapshotCorrupt
+		}
+		expiresAt := int64(binary.BigEndian.Uint64(header[0:]))
+		keyLen := int(binary.BigEndian.Uint16(header[8:]))
+		valueLen := binary.BigEndian.Uint32(header[10:])
+		if keyLen == 0 {
+			break
+		}
+		if keyLen > constants.MaxKeySizeBytes || valueLen > constants.MaxValueSizeBytes {
+			return nil, ErrSnapshotCorrupt
+		}
+
+		record := make([]byte, keyLen+int(valueLen))
+		if _, err := io.ReadFull(body, record); err != nil {
+			return nil, ErrSnapshotCorrupt
+		}
+		entries = append(entries, snapshotEntry{
+			key:       string(record[:keyLen]),
+			value:     record[keyLen:],
+			expiresAt: time.Unix(0, expiresAt),
+		})
+	}
+
+	if !checkSnapshotCRC(br, crc) {
+		return nil, ErrSnapshotCorrupt
+	}
+	return entries, nil
+}
+
+// checkSnapshotCRC reads the trailing CRC and compares it to the one computed
+func checkSnapshotCRC(r io.Reader, crc hash.Hash32) bool {
+	var expected uint32
+	if err := binary.Read(r, binary.BigEndian, &expected); err != nil {
+		return false
+	}
+	return expected == crc.Sum32()
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+	s.Put("a", []byte("alpha"), time.Hour)
+	s.Put("b", []byte("beta"), time.Minute)
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	restored := NewInMemoryStorage(1000)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	for key, expected := range map[string]string{"a": "alpha", "b": "beta"} {
+		entry, err := restored.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		if string(entry.Value) != expected {
+			t.Errorf("Get(%q) = %q, want %q", key, entry.Value, expected)
+		}
+	}
+
+	entry, _ := restored.Get("b")
+	if entry.RemainingTTL > time.Minute || entry.RemainingTTL < 59*time.Second {
+		t.Errorf("RemainingTTL = %v, want about 1m", entry.RemainingTTL)
+	}
+	if restored.memoryUsedBytes != s.memoryUsedBytes {
+		t.Errorf("memoryUsedBytes = %d, want %d", restored.memoryUsedBytes, s.memoryUsedBytes)
+	}
+}
+
+func TestSnapshot_PreservesLRUOrder(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+	for i := 0; i < 5; i++ {
+		s.Put(fmt.Sprintf("key-%d", i), []byte("value"), time.Hour)
+	}
+	// key-0 becomes the hottest
+	s.Get("key-0")
+
+	var buf bytes.Buffer
+	s.Snapshot(&buf)
+
+	restored := NewInMemoryStorage(1000)
+	restored.Restore(&buf)
+
+	var order []string
+	restored.policy.Walk(func(obj *CachedObject) bool {
+		order = append(order, obj.Key)
+		return true
+	})
+	expected := []string{"key-1", "key-2", "key-3", "key-4", "key-0"}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("LRU order = %v, want %v", order, expected)
+	}
+}
+
+func TestSnapshot_SmallerStorageKeepsHottest(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+	for i := 0; i < 5; i++ {
+		s.Put(fmt.Sprintf("key-%d", i), []byte("value"), time.Hour)
+	}
+
+	var buf bytes.Buffer
+	s.Snapshot(&buf)
+
+	// Room for two entries of 10 bytes
+	restored := NewInMemoryStorage(20)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := restored.Get(fmt.Sprintf("key-%d", i)); err != ErrKeyNotFound {
+			t.Errorf("cold key-%d error = %v, want evicted", i, err)
+		}
+	}
+	for i := 3; i < 5; i++ {
+		if _, err := restored.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("hot key-%d error = %v", i, err)
+		}
+	}
+}
+
+func TestSnapshot_DropsExpired(t *testing.T) {
+	var buf bytes.Buffer
+	writeSnapshot(&buf, []snapshotEntry{
+		{key: "expired", value: []byte("value"), expiresAt: time.Now().Add(-time.Second)},
+		{key: "live", value: []byte("value"), expiresAt: time.Now().Add(time.Hour)},
+	})
+
+	s := NewInMemoryStorage(1000)
+	if err := s.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := s.Get("expired"); err != ErrKeyNotFound {
+		t.Errorf("Get(expired) error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := s.Get("live"); err != nil {
+		t.Errorf("Get(live) error = %v", err)
+	}
+}
+
+func TestSnapshot_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewInMemoryStorage(1000).Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := NewInMemoryStorage(1000).Restore(&buf); err != nil {
+		t.Errorf("Restore() of empty snapshot error = %v", err)
+	}
+}
+
+func TestSnapshot_RejectsBadSnapshots(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+	s.Put("key", []byte("value"), time.Hour)
+	var buf bytes.Buffer
+	s.Snapshot(&buf)
+	good := buf.Bytes()
+
+	flipped := bytes.Clone(good)
+	flipped[len(flipped)-6] ^= 0xff
+
+	badVersion := bytes.Clone(good)
+	badVersion[len(snapshotMagic)] = 99
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", nil, ErrSnapshotCorrupt},
+		{"bad magic", []byte("NOPE\x01"), ErrSnapshotCorrupt},
+		{"bad version", badVersion, ErrUnsupportedSnapshot},
+		{"truncated", good[:len(good)-10], ErrSnapshotCorrupt},
+		{"missing crc", good[:len(good)-4], ErrSnapshotCorrupt},
+		{"flipped byte", flipped, ErrSnapshotCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := NewInMemoryStorage(1000)
+			if err := restored.Restore(bytes.NewReader(tt.data)); err != tt.expected {
+				t.Errorf("Restore() error = %v, want %v", err, tt.expected)
+			}
+			// Nothing is loaded from a bad snapshot
+			if len(restored.store) != 0 {
+				t.Errorf("store has %d entries, want 0", len(restored.store))
+			}
+		})
+	}
+}
+
+func TestSnapshot_ShardedRoundTrip(t *testing.T) {
+	s := NewShardedStorage(10000, StorageOptions{Shards: 4})
+	for i := 0; i < 50; i++ {
+		s.Put(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)), time.Hour)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	// Restoring into a different shard count rehashes the keys
+	restored := NewShardedStorage(10000, StorageOptions{Shards: 3})
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		entry, err := restored.Get(fmt.Sprintf("key-%d", i))
+		if err != nil || string(entry.Value) != fmt.Sprintf("value-%d", i) {
+			t.Errorf("Get(key-%d) = %v, %v", i, entry, err)
+		}
+	}
+}
+
+func TestSnapshot_NegativeEntries(t *testing.T) {
+	src := NewInMemoryStorage(1000)
+	src.Put("value", []byte("v"), time.Hour)
+	src.PutNegative("negative", time.Hour)
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	dst := NewInMemoryStorage(1000)
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	entry, err := dst.Get("negative")
+	if err != nil || !entry.Negative {
+		t.Errorf("Get(negative) = %+v, %v; want a negative entry", entry, err)
+	}
+	if entry, err := dst.Get("value"); err != nil || entry.Negative {
+		t.Errorf("Get(value) = %+v, %v; want the value", entry, err)
+	}
+}
@@ -0,0 +1,137 @@
+package storage
+
+import "math/bits"
+
+// Number of power-of-two size buckets: one for each bit length of a uint32
+const sizeBuckets = 33
+
+// Stats is a point-in-time view of a storage's counters and contents.
+// Counters are cumulative since the storage was created.
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Puts        uint64 `json:"puts"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Deletes     uint64 `json:"deletes"`
+
+	Items           int    `json:"items"`
+	MemoryUsedBytes uint64 `json:"memory_used_bytes"`
+	MaxMemoryBytes  uint64 `json:"max_memory_bytes"`
+	// KeyBytes and ValueBytes split MemoryUsedBytes between keys and values
+	KeyBytes   uint64 `json:"key_bytes"`
+	ValueBytes uint64 `json:"value_bytes"`
+
+	// KeySizes and ValueSizes are the size distributions of the stored entries
+	KeySizes   []HistogramBucket `json:"key_sizes"`
+	ValueSizes []HistogramBucket `json:"value_sizes"`
+}
+
+// HistogramBucket counts the sizes up to UpperBound that are larger than the
+// previous bucket's bound. Buckets are powers of two; empty ones are omitted.
+type HistogramBucket struct {
+	UpperBound uint64 `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+// StatsReporter is implemented by storages that keep Stats.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// storageCounters are the counters behind Stats. Guarded by the storage mutex.
+type storageCounters struct {
+	hits, misses, puts              uint64
+	evictions, expirations, deletes uint64
+	keySizes, valueSizes            sizeHistogram
+	// keyBytes is the part of memoryUsedBytes taken by keys
+	keyBytes uint64
+}
+
+// add sums other into c
+func (c *storageCounters) add(other *storageCounters) {
+	c.hits += other.hits
+	c.misses += other.misses
+	c.puts += other.puts
+	c.evictions += other.evictions
+	c.expirations += other.expirations
+	c.deletes += other.deletes
+	c.keyBytes += other.keyBytes
+	for i := range c.keySizes {
+		c.keySizes[i] += other.keySizes[i]
+		c.valueSizes[i] += other.valueSizes[i]
+	}
+}
+
+// sizeHistogram counts sizes by bit length: bucket i holds sizes in [2^(i-1), 2^i)
+type sizeHistogram [sizeBuckets]uint64
+
+func (h *sizeHistogram) add(size int) {
+	h[bits.Len32(uint32(size))]++
+}
+
+func (h *sizeHistogram) remove(size int) {
+	h[bits.Len32(uint32(size))]--
+}
+
+// buckets returns the non-empty buckets
+func (h *sizeHistogram) buckets() []HistogramBucket {
+	buckets := []HistogramBucket{}
+	for i, count := range h {
+		if count > 0 {
+			buckets = append(buckets, HistogramBucket{UpperBound: 1<<i - 1, Count: count})
+		}
+	}
+	return buckets
+}
+
+// Stats returns the storage's counters and current contents.
+func (s *InMemoryStorage) Stats() Stats {
+	s.mutex.Lock()
+	counters := s.counters
+	items := len(s.store)
+	used := s.memoryUsedBytes
+	s.mutex.Unlock()
+
+	return newStats(&counters, items, used, s.maxMemory)
+}
+
+// Stats returns the counters and contents summed over all shards.
+// Each shard is read under its own lock.
+func (s *ShardedStorage) Stats() Stats {
+	var counters storageCounters
+	var items int
+	var used uint64
+	for _, shard := range s.shards {
+		shard.mutex.Lock()
+		counters.add(&shard.counters)
+		items += len(shard.store)
+		used += shard.memoryUsedBytes
+		shard.mutex.Unlock()
+	}
+	return newStats(&counters, items, used, s.maxMemory)
+}
+
+// Stats returns the stats of the memory tier. Reads served from disk count
+// as misses, and entries demoted to disk as evictions.
+func (h *HybridStorage) Stats() Stats {
+	return h.memory.Stats()
+}
+
+func newStats(counters *storageCounters, items int, used, maxMemory uint64) Stats {
+	return Stats{
+		Hits:            counters.hits,
+		Misses:          counters.misses,
+		Puts:            counters.puts,
+		Evictions:       counters.evictions,
+		Expirations:     counters.expirations,
+		Deletes:         counters.deletes,
+		Items:           items,
+		MemoryUsedBytes: used,
+		MaxMemoryBytes:  maxMemory,
+		KeyBytes:        counters.keyBytes,
+		ValueBytes:      used - counters.keyBytes,
+		KeySizes:        counters.keySizes.buckets(),
+		ValueSizes:      counters.valueSizes.buckets(),
+	}
+}
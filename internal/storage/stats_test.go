@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats_Counters(t *testing.T) {
+	s := NewInMemoryStorage(30)
+
+	s.Put("a", []byte("123456789"), time.Hour)
+	s.Put("b", []byte("123456789"), 10*time.Millisecond)
+	s.Get("a")
+	s.Get("missing")
+	time.Sleep(20 * time.Millisecond)
+	s.Get("b") // expired
+	s.Put("c", []byte("123456789"), time.Hour)
+	s.Put("d", []byte("123456789"), time.Hour)
+	s.Put("e", []byte("123456789"), time.Hour) // evicts a
+	s.Delete("c")
+
+	stats := s.Stats()
+	expected := Stats{
+		Hits: 1, Misses: 2, Puts: 5, Evictions: 1, Expirations: 1, Deletes: 1,
+		Items: 2, MemoryUsedBytes: 20, MaxMemoryBytes: 30, KeyBytes: 2, ValueBytes: 18,
+	}
+	stats.KeySizes, stats.ValueSizes = nil, nil
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats() = %+v, want %+v", stats, expected)
+	}
+}
+
+func TestStats_SizeHistograms(t *testing.T) {
+	s := NewInMemoryStorage(10000)
+
+	s.Put("k", []byte("v"), time.Hour)
+	s.Put("key", make([]byte, 100), time.Hour)
+	s.Put("key2", make([]byte, 127), time.Hour)
+	s.Put("gone", make([]byte, 1000), time.Hour)
+	s.Delete("gone")
+
+	stats := s.Stats()
+	assertBuckets(t, "key", stats.KeySizes, HistogramBucket{1, 1}, HistogramBucket{3, 1}, HistogramBucket{7, 1})
+	assertBuckets(t, "value", stats.ValueSizes, HistogramBucket{1, 1}, HistogramBucket{127, 2})
+}
+
+func TestStats_Sharded(t *testing.T) {
+	s := NewShardedStorage(1000, StorageOptions{Shards: 4})
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		s.Put(key, []byte("value"), time.Hour)
+		s.Get(key)
+	}
+
+	stats := s.Stats()
+	if stats.Puts != 8 || stats.Hits != 8 || stats.Items != 8 {
+		t.Errorf("Stats() = %+v, want 8 puts, hits and items", stats)
+	}
+	if stats.MemoryUsedBytes != 48 || stats.MaxMemoryBytes != 1000 {
+		t.Errorf("memory = %d/%d, want 48/1000", stats.MemoryUsedBytes, stats.MaxMemoryBytes)
+	}
+	assertBuckets(t, "value", stats.ValueSizes, HistogramBucket{7, 8})
+}
+
+func assertBuckets(t *testing.T, name string, got []HistogramBucket, expected ...HistogramBucket) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("%s buckets = %v, want %v", name, got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("%s bucket %d = %+v, want %+v", name, i, got[i], expected[i])
+		}
+	}
+}
+
+func TestStats_PeekNotCounted(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+	s.Put("a", []byte("value"), time.Hour)
+
+	if entry, err := s.Peek("a"); err != nil || string(entry.Value) != "value" {
+		t.Errorf("Peek() = %+v, %v, want the value", entry, err)
+	}
+	if _, err := s.Peek("missing"); err != ErrKeyNotFound {
+		t.Errorf("Peek() of missing key error = %v, want ErrKeyNotFound", err)
+	}
+
+	if stats := s.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v, want no hits or misses", stats)
+	}
+}
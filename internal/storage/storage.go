@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/satmihir/justcache/internal/constants"
@@ -17,6 +18,7 @@ var (
 	ErrObjectTooLarge      = errors.New("value exceeds maximum size")
 	ErrValueTooShort       = errors.New("value is too short")
 	ErrInvalidTTL          = errors.New("TTL must be greater than zero")
+	ErrReservationDone     = errors.New("reservation already committed or released")
 )
 
 // CacheEntry contains value and metadata for a cached item
@@ -24,6 +26,11 @@ type CacheEntry struct {
 	Value        []byte
 	Size         int
 	RemainingTTL time.Duration
+	// Negative means the origin has no value for the key; Value is empty
+	Negative bool
+	// Stale means the entry has expired and is served from its stale grace
+	// window (see StorageOptions.StaleGrace); RemainingTTL is 0
+	Stale bool
 }
 
 // Local storage with key-value store with caching semantics
@@ -32,6 +39,9 @@ type LocalStorage interface {
 	Get(key string) (*CacheEntry, error)
 	// Put the given value for the given key.
 	Put(key string, value []byte, ttl time.Duration) error
+	// PutNegative stores a negative entry for the key: a record that the
+	// origin has no value for it. It takes only the key's bytes.
+	PutNegative(key string, ttl time.Duration) error
 	// Delete the given key.
 	Delete(key string) error
 	// CanFit checks if there's enough space to store a value of the given size.
@@ -40,6 +50,13 @@ type LocalStorage interface {
 	CanFit(keySize, valueSize int) bool
 }
 
+// Peeker is implemented by storages that can read an entry without counting
+// the read in their Stats, e.g. for existence checks that aren't client GETs.
+type Peeker interface {
+	// Peek returns the entry for the key like Get, without counting it.
+	Peek(key string) (*CacheEntry, error)
+}
+
 // InMemoryStorage is a local storage implementation that uses in-memory storage
 // and bounded memory usage.
 type InMemoryStorage struct {
@@ -49,10 +66,24 @@ type InMemoryStorage struct {
 	memoryUsedBytes uint64
 	// We set a maximum memory limit for the storage.
 	maxMemory uint64
+	// budget holds the used and reserved bytes against the memory limit. It
+	// is shared by the shards of a ShardedStorage.
+	budget *memoryBudget
 	// We use a map to store the keys and values.
 	store map[string]*CachedObject
-	// LRU tracking list.
-	lru lruList
+	// Eviction policy tracking entry recency/frequency.
+	policy EvictionPolicy
+	// listener, if set, receives removal events after the lock is released.
+	listener EventListener
+	// onEvict, if set, receives the entries evicted to make room, after the
+	// lock is released. Used to demote entries to a lower tier.
+	onEvict func(evicted []*CachedObject)
+	// pending collects removals made under the lock for delivery.
+	pending pendingEvents
+	// counters back Stats.
+	counters storageCounters
+	// staleGrace is how long expired entries are still served, marked stale.
+	staleGrace time.Duration
 }
 
 func (s *InMemoryStorage) Get(key string) (*CacheEntry, error) {
@@ -62,26 +93,64 @@ func (s *InMemoryStorage) Get(key string) (*CacheEntry, error) {
 	}
 
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	node, ok := s.store[key]
 	if !ok {
+		s.counters.misses++
+		s.mutex.Unlock()
 		return nil, ErrKeyNotFound
 	}
 
 	now := time.Now()
-	if node.ExpirationTime.Before(now) {
+	if !s.servable(node, now) {
+		s.counters.misses++
 		s.deleteUnlocked(key)
+		s.recordUnlocked(node, ReasonExpiredOnRead)
+		pending := s.takePendingUnlocked()
+		s.mutex.Unlock()
+
+		s.deliver(pending)
 		return nil, ErrKeyNotFound
 	}
+	defer s.mutex.Unlock()
+
+	s.counters.hits++
+	s.policy.OnAccess(node)
 
-	// Move the node to the tail of the list (most recently used).
-	s.lru.moveToTail(node)
+	return newCacheEntry(node, now), nil
+}
+
+// Peek returns the entry for the key like Get, but doesn't count as a hit or
+// miss in Stats or as an access for eviction.
+func (s *InMemoryStorage) Peek(key string) (*CacheEntry, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, ok := s.store[key]
+	now := time.Now()
+	if !ok || !s.servable(node, now) {
+		return nil, ErrKeyNotFound
+	}
+	return newCacheEntry(node, now), nil
+}
+
+// newCacheEntry returns the entry for a stored object read at now
+func newCacheEntry(node *CachedObject, now time.Time) *CacheEntry {
+	stale := node.ExpirationTime.Before(now)
+	var remaining time.Duration
+	if !stale {
+		remaining = node.ExpirationTime.Sub(now)
+	}
 	return &CacheEntry{
 		Value:        node.Value,
 		Size:         len(node.Value),
-		RemainingTTL: node.ExpirationTime.Sub(now),
-	}, nil
+		RemainingTTL: remaining,
+		Negative:     node.IsNegative(),
+		Stale:        stale,
+	}
 }
 
 func (s *InMemoryStorage) Put(key string, value []byte, ttl time.Duration) error {
@@ -99,13 +168,46 @@ func (s *InMemoryStorage) Put(key string, value []byte, ttl time.Duration) error
 	}
 
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	err := s.putUnlocked(key, value, ttl, 0)
+	pending := s.takePendingUnlocked()
+	s.mutex.Unlock()
+
+	s.deliver(pending)
+	return err
+}
 
+// PutNegative stores a negative entry for the key, replacing any value.
+// Negative entries are stored with an empty value, which Put never accepts,
+// so they only take the key's bytes.
+func (s *InMemoryStorage) PutNegative(key string, ttl time.Duration) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	s.mutex.Lock()
+	err := s.putUnlocked(key, nil, ttl, 0)
+	pending := s.takePendingUnlocked()
+	s.mutex.Unlock()
+
+	s.deliver(pending)
+	return err
+}
+
+// putUnlocked stores the value, evicting as needed. Lock must be held by caller.
+// Memory reserved for pending uploads is not available to the new object.
+// credit is room already taken from the budget for this value (a committed
+// reservation); it is used up or returned either way.
+func (s *InMemoryStorage) putUnlocked(key string, value []byte, ttl time.Duration, credit uint64) error {
 	// Calculate the size this new object will use (key + value)
 	newObjectSize := uint64(len(key) + len(value))
 
 	// This check needs the lock since maxMemory could theoretically be dynamic
 	if newObjectSize > s.maxMemory {
+		s.budget.release(credit)
 		return ErrObjectTooLarge
 	}
 
@@ -116,20 +218,9 @@ func (s *InMemoryStorage) Put(key string, value []byte, ttl time.Duration) error
 	}
 
 	// Only need additional memory if new object is larger than existing
-	var additionalMemoryNeeded uint64
-	if newObjectSize > existingObjectSize {
-		additionalMemoryNeeded = newObjectSize - existingObjectSize
-	}
-
-	if s.memoryUsedBytes+additionalMemoryNeeded > s.maxMemory {
-		// Try to free up some memory by deleting ttl'ed keys.
-		freedBytes := s.limitedTtlCleanup(additionalMemoryNeeded)
-		if freedBytes < additionalMemoryNeeded {
-			// Try to free up some memory by evicting LRU items.
-			freedBytes += s.limitedEviction(additionalMemoryNeeded - freedBytes)
-		}
-
-		if freedBytes < additionalMemoryNeeded {
+	if newObjectSize > existingObjectSize+credit {
+		if !s.makeRoomUnlocked(newObjectSize - existingObjectSize - credit) {
+			s.budget.release(credit)
 			return ErrMemoryLimitExceeded
 		}
 
@@ -141,15 +232,20 @@ func (s *InMemoryStorage) Put(key string, value []byte, ttl time.Duration) error
 		}
 	}
 
-	// Delete old key if it still exists.
-	if existingObjectSize > 0 {
-		s.deleteUnlocked(key)
+	// Take the rest of the room from the budget. This catches other shards
+	// having taken the room freed above.
+	held := existingObjectSize + credit
+	if !s.budget.tryAcquire(newObjectSize - min(newObjectSize, held)) {
+		s.budget.release(credit)
+		return ErrMemoryLimitExceeded
+	}
+	if held > newObjectSize {
+		s.budget.release(held - newObjectSize)
 	}
 
-	// Final memory check: ensure we have space for the new object.
-	// This catches edge cases where eviction deleted our key but we still don't have room.
-	if s.memoryUsedBytes+newObjectSize > s.maxMemory {
-		return ErrMemoryLimitExceeded
+	// Replace the old object; its bytes were counted toward the new one.
+	if existing, ok := s.store[key]; ok {
+		s.removeUnlocked(existing)
 	}
 
 	cachedObject := &CachedObject{
@@ -160,9 +256,12 @@ func (s *InMemoryStorage) Put(key string, value []byte, ttl time.Duration) error
 
 	s.store[key] = cachedObject
 	s.memoryUsedBytes += cachedObject.GetBytesUsed()
+	s.counters.puts++
+	s.counters.keySizes.add(len(key))
+	s.counters.keyBytes += uint64(len(key))
+	s.counters.valueSizes.add(len(value))
 
-	// Add to tail of LRU list (most recently used).
-	s.lru.append(cachedObject)
+	s.policy.OnInsert(cachedObject)
 
 	return nil
 }
@@ -174,9 +273,16 @@ func (s *InMemoryStorage) Delete(key string) error {
 	}
 
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	node := s.store[key]
+	err := s.deleteUnlocked(key)
+	if err == nil {
+		s.recordUnlocked(node, ReasonDeleted)
+	}
+	pending := s.takePendingUnlocked()
+	s.mutex.Unlock()
 
-	return s.deleteUnlocked(key)
+	s.deliver(pending)
+	return err
 }
 
 // CanFit checks if there's enough space to store a value of the given size.
@@ -195,78 +301,153 @@ func (s *InMemoryStorage) CanFit(keySize, valueSize int) bool {
 	return true
 }
 
-// deleteUnlocked removes the key from storage. Lock must be held by caller.
+// deleteUnlocked removes the key from storage and returns its bytes to the
+// budget. Lock must be held by caller.
 func (s *InMemoryStorage) deleteUnlocked(key string) error {
 	node, ok := s.store[key]
 	if !ok {
 		return ErrDeleteKeyNotFound
 	}
 
-	s.lru.remove(node)
+	s.removeUnlocked(node)
+	s.budget.release(node.GetBytesUsed())
+	return nil
+}
+
+// removeUnlocked removes the object from storage, leaving its bytes taken
+// from the budget. Lock must be held by caller.
+func (s *InMemoryStorage) removeUnlocked(node *CachedObject) {
+	s.policy.OnRemove(node)
 	delete(s.store, node.Key)
 	s.memoryUsedBytes -= node.GetBytesUsed()
+	s.counters.keySizes.remove(len(node.Key))
+	s.counters.keyBytes -= uint64(len(node.Key))
+	s.counters.valueSizes.remove(len(node.Value))
+}
 
-	return nil
+// makeRoomUnlocked frees memory until the given amount fits alongside the used
+// and reserved bytes, deleting ttl'ed keys first and then evicting items chosen
+// by the policy. Returns false if not enough could be freed. Lock must be held by caller.
+func (s *InMemoryStorage) makeRoomUnlocked(needed uint64) bool {
+	available := s.budget.available()
+	if needed <= available {
+		return true
+	}
+	shortfall := needed - available
+
+	// Try to free up some memory by deleting ttl'ed keys.
+	freedBytes := s.limitedTtlCleanup(shortfall)
+	if freedBytes < shortfall {
+		// Try to free up some memory by evicting items chosen by the policy.
+		freedBytes += s.limitedEviction(shortfall - freedBytes)
+	}
+
+	return freedBytes >= shortfall
+}
+
+// reclaim frees up to the given amount of memory for use by other shards
+// sharing the budget, deleting ttl'ed keys first and then evicting items
+// chosen by the policy. Returns the amount of memory freed up.
+func (s *InMemoryStorage) reclaim(minimumReclaimBytes uint64) uint64 {
+	s.mutex.Lock()
+	freedBytes := s.limitedTtlCleanup(minimumReclaimBytes)
+	if freedBytes < minimumReclaimBytes {
+		freedBytes += s.limitedEviction(minimumReclaimBytes - freedBytes)
+	}
+	pending := s.takePendingUnlocked()
+	s.mutex.Unlock()
+
+	s.deliver(pending)
+	return freedBytes
 }
 
 // limitedTtlCleanup attempts to free up only the given amount of memory by deleting ttl'ed keys.
 // Returns the amount of memory freed up. Lock must be held by caller.
+// Entries are scanned from coldest to hottest as ordered by the eviction policy.
 func (s *InMemoryStorage) limitedTtlCleanup(minimumReclaimBytes uint64) uint64 {
-	ptr := s.lru.front()
 	freedBytes := uint64(0)
 	now := time.Now()
 
-	for ptr != nil {
-		next := ptr.next // Save next before potential deletion
-		if ptr.ExpirationTime.Before(now) {
-			freedBytes += ptr.GetBytesUsed()
-			s.deleteUnlocked(ptr.Key)
-			if freedBytes >= minimumReclaimBytes {
-				break
-			}
+	s.policy.Walk(func(obj *CachedObject) bool {
+		if obj.ExpirationTime.Before(now) {
+			freedBytes += obj.GetBytesUsed()
+			s.deleteUnlocked(obj.Key)
+			s.recordUnlocked(obj, ReasonExpiredOnCleanup)
 		}
-		ptr = next
-	}
+		return freedBytes < minimumReclaimBytes
+	})
 
 	return freedBytes
 }
 
-// limitedEviction evicts LRU items from the head just enough to free up the given amount of memory.
+// limitedEviction evicts the policy's victims just enough to free up the given amount of memory.
 // Returns the amount of memory freed up. Lock must be held by caller.
 func (s *InMemoryStorage) limitedEviction(minimumReclaimBytes uint64) uint64 {
-	ptr := s.lru.front()
 	freedBytes := uint64(0)
 
-	for ptr != nil {
-		next := ptr.next // Save next before deletion
-		freedBytes += ptr.GetBytesUsed()
-		s.deleteUnlocked(ptr.Key)
-		if freedBytes >= minimumReclaimBytes {
+	for freedBytes < minimumReclaimBytes {
+		victim := s.policy.Victim()
+		if victim == nil {
 			break
 		}
-		ptr = next
+		freedBytes += victim.GetBytesUsed()
+		s.deleteUnlocked(victim.Key)
+		s.recordUnlocked(victim, ReasonEvicted)
 	}
 
 	return freedBytes
 }
 
+// contains reports whether an entry for the key is stored that Get would
+// return, live or stale, without counting as an access.
+func (s *InMemoryStorage) contains(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, ok := s.store[key]
+	return ok && s.servable(node, time.Now())
+}
+
+// servable reports whether the entry is served at now: it hasn't expired, or
+// it's still in its stale grace window
+func (s *InMemoryStorage) servable(node *CachedObject, now time.Time) bool {
+	return !node.ExpirationTime.Before(now) || now.Before(node.ExpirationTime.Add(s.staleGrace))
+}
+
 // StorageOptions configures the in-memory storage.
 type StorageOptions struct {
 	// InitialCapacity is a hint for the expected number of items.
 	// Pre-allocating reduces map resizing overhead.
 	InitialCapacity int
+	// Shards is the number of independent shards keys are hashed into.
+	// Values <= 1 select a single InMemoryStorage; see NewStorage.
+	Shards int
+	// EvictionPolicy selects how entries are chosen for eviction.
+	// Default: EvictionLRU.
+	EvictionPolicy EvictionPolicyType
+	// Listener, if set, is told about entries that are evicted, expire or are
+	// deleted. See EventListener.
+	Listener EventListener
+	// StaleGrace is how long an entry is still served after it expires,
+	// marked stale, so a client can refresh it while others read the old
+	// value. Stale entries are the first to go when memory is needed.
+	// Default: 0 (expired entries are never served).
+	StaleGrace time.Duration
 }
 
 func NewInMemoryStorage(maxMemory uint64, opts ...StorageOptions) *InMemoryStorage {
-	initialCapacity := 0
+	var opt StorageOptions
 	if len(opts) > 0 {
-		initialCapacity = opts[0].InitialCapacity
+		opt = opts[0]
 	}
 
 	return &InMemoryStorage{
-		store:     make(map[string]*CachedObject, initialCapacity),
-		maxMemory: maxMemory,
-		// lru is zero-initialized correctly (head: nil, tail: nil)
+		store:      make(map[string]*CachedObject, opt.InitialCapacity),
+		maxMemory:  maxMemory,
+		budget:     &memoryBudget{max: maxMemory},
+		policy:     newEvictionPolicy(opt.EvictionPolicy, opt.InitialCapacity),
+		listener:   opt.Listener,
+		staleGrace: opt.StaleGrace,
 	}
 }
 
@@ -281,3 +462,33 @@ func validateKey(key string) error {
 
 	return nil
 }
+
+// memoryBudget is a memory limit that used and reserved bytes are taken from.
+// It is safe for concurrent use, so shards can share one.
+type memoryBudget struct {
+	max  uint64
+	used atomic.Uint64
+}
+
+// available returns the bytes left in the budget
+func (b *memoryBudget) available() uint64 {
+	return b.max - min(b.max, b.used.Load())
+}
+
+// tryAcquire takes n bytes from the budget if they're available
+func (b *memoryBudget) tryAcquire(n uint64) bool {
+	for {
+		used := b.used.Load()
+		if used+n > b.max {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			return true
+		}
+	}
+}
+
+// release returns n bytes to the budget
+func (b *memoryBudget) release(n uint64) {
+	b.used.Add(-n)
+}
@@ -91,8 +91,8 @@ func TestGet_MovesToTail(t *testing.T) {
 	// LRU order: b -> c -> a
 
 	// Verify by checking LRU front
-	if s.lru.front().Key != "b" {
-		t.Errorf("LRU front = %q, want %q", s.lru.front().Key, "b")
+	if s.policy.Victim().Key != "b" {
+		t.Errorf("LRU front = %q, want %q", s.policy.Victim().Key, "b")
 	}
 }
 
@@ -749,3 +749,113 @@ func TestTTL_AllExpired(t *testing.T) {
 	// Now store should only have "d"
 	assertStoreSize(t, s, 1)
 }
+
+func TestPutNegative(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+
+	if err := s.PutNegative("missing", time.Minute); err != nil {
+		t.Fatalf("PutNegative() error = %v", err)
+	}
+	entry, err := s.Get("missing")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !entry.Negative || len(entry.Value) != 0 || entry.Size != 0 {
+		t.Errorf("Get() = %+v, want an empty negative entry", entry)
+	}
+	if entry.RemainingTTL <= 0 || entry.RemainingTTL > time.Minute {
+		t.Errorf("RemainingTTL = %v, want up to a minute", entry.RemainingTTL)
+	}
+
+	// Only the key takes memory
+	if s.memoryUsedBytes != uint64(len("missing")) {
+		t.Errorf("memoryUsedBytes = %d, want %d", s.memoryUsedBytes, len("missing"))
+	}
+
+	// A value replaces the negative entry, and the other way around
+	s.Put("missing", []byte("found"), time.Minute)
+	if entry, _ := s.Get("missing"); entry.Negative || string(entry.Value) != "found" {
+		t.Errorf("Get() after Put = %+v, want the value", entry)
+	}
+	s.PutNegative("missing", time.Minute)
+	if entry, _ := s.Get("missing"); !entry.Negative {
+		t.Error("PutNegative should replace the value")
+	}
+	if s.memoryUsedBytes != uint64(len("missing")) {
+		t.Errorf("memoryUsedBytes = %d after replacing, want %d", s.memoryUsedBytes, len("missing"))
+	}
+}
+
+func TestPutNegative_Invalid(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+
+	if err := s.PutNegative("", time.Minute); err != ErrKeyTooShort {
+		t.Errorf("PutNegative() empty key error = %v, want ErrKeyTooShort", err)
+	}
+	if err := s.PutNegative("key", 0); err != ErrInvalidTTL {
+		t.Errorf("PutNegative() zero TTL error = %v, want ErrInvalidTTL", err)
+	}
+}
+
+func TestPutNegative_Expires(t *testing.T) {
+	s := NewInMemoryStorage(1000)
+
+	s.PutNegative("missing", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.Get("missing"); err != ErrKeyNotFound {
+		t.Errorf("Get() of expired negative entry error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestGet_StaleGrace(t *testing.T) {
+	s := NewInMemoryStorage(1000, StorageOptions{StaleGrace: time.Hour})
+	mustPut(t, s, "key", []byte("value"), 10*time.Millisecond)
+
+	entry, err := s.Get("key")
+	if err != nil || entry.Stale {
+		t.Fatalf("Get() before expiry = %+v, %v, want fresh entry", entry, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	entry, err = s.Get("key")
+	if err != nil {
+		t.Fatalf("Get() in grace window error = %v", err)
+	}
+	if !entry.Stale || entry.RemainingTTL != 0 || string(entry.Value) != "value" {
+		t.Errorf("Get() in grace window = %+v, want stale value with zero TTL", entry)
+	}
+
+	// A new value replaces the stale one
+	mustPut(t, s, "key", []byte("fresh"), time.Minute)
+	entry, _ = s.Get("key")
+	if entry.Stale || string(entry.Value) != "fresh" {
+		t.Errorf("Get() after refresh = %+v, want fresh value", entry)
+	}
+}
+
+func TestGet_StaleGraceEnds(t *testing.T) {
+	s := NewInMemoryStorage(1000, StorageOptions{StaleGrace: 10 * time.Millisecond})
+	mustPut(t, s, "key", []byte("value"), 10*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := s.Get("key"); err != ErrKeyNotFound {
+		t.Errorf("Get() after grace window error = %v, want ErrKeyNotFound", err)
+	}
+	assertStoreSize(t, s, 0)
+}
+
+func TestPut_ReclaimsStaleEntries(t *testing.T) {
+	s := NewInMemoryStorage(30, StorageOptions{StaleGrace: time.Hour})
+	mustPut(t, s, "a", []byte("0123456789"), 10*time.Millisecond)
+	mustPut(t, s, "b", []byte("0123456789"), time.Minute)
+	time.Sleep(20 * time.Millisecond)
+
+	// Stale entries are reclaimed before live ones are evicted
+	mustPut(t, s, "c", []byte("0123456789"), time.Minute)
+	if _, err := s.Get("a"); err != ErrKeyNotFound {
+		t.Errorf("Get(a) error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := s.Get("b"); err != nil {
+		t.Errorf("Get(b) error = %v, want live entry", err)
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"math/bits"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// Share of entries (percent) kept in the admission window
+	tinyLFUWindowPercent = 1
+	// Share of the main space (percent) reserved for the protected segment
+	tinyLFUProtectedPercent = 80
+	// Default number of counters per sketch row when the capacity is unknown
+	defaultSketchWidth = 1024
+	// Counters saturate here; 4 bits are enough to rank popularity
+	sketchMaxCount = 15
+	// The sketch is halved after this many increments per counter column
+	sketchSampleFactor = 10
+)
+
+// W-TinyLFU segments
+const (
+	segmentWindow uint8 = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFUPolicy implements W-TinyLFU (Einziger et al., "TinyLFU: A Highly
+// Efficient Cache Admission Policy").
+//
+// New entries land in a small LRU window. Entries pushed out of the window join
+// the probation segment of a segmented LRU as admission candidates. When an
+// entry must be evicted, the newest candidate competes with the probation
+// victim and the one the frequency sketch rates as less popular is evicted.
+// Probation entries that are accessed again are promoted to the protected
+// segment. Sizes are tracked by entry count since the storage only knows bytes.
+type tinyLFUPolicy struct {
+	sketch *countMinSketch
+
+	window    lruList
+	probation lruList
+	protected lruList
+
+	windowLen    int
+	probationLen int
+	protectedLen int
+}
+
+func newTinyLFUPolicy(capacityHint int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{sketch: newCountMinSketch(capacityHint)}
+}
+
+func (p *tinyLFUPolicy) OnInsert(obj *CachedObject) {
+	p.sketch.increment(obj.Key)
+
+	obj.segment = segmentWindow
+	p.window.append(obj)
+	p.windowLen++
+
+	// Window overflow becomes admission candidates at the tail of probation
+	for p.windowLen > p.windowTarget() {
+		candidate := p.window.front()
+		p.window.remove(candidate)
+		p.windowLen--
+		candidate.segment = segmentProbation
+		p.probation.append(candidate)
+		p.probationLen++
+	}
+}
+
+func (p *tinyLFUPolicy) OnAccess(obj *CachedObject) {
+	p.sketch.increment(obj.Key)
+
+	switch obj.segment {
+	case segmentWindow:
+		p.window.moveToTail(obj)
+	case segmentProtected:
+		p.protected.moveToTail(obj)
+	case segmentProbation:
+		// Promote, demoting the protected LRU back to probation if it overflows
+		p.probation.remove(obj)
+		p.probationLen--
+		obj.segment = segmentProtected
+		p.protected.append(obj)
+		p.protectedLen++
+
+		for p.protectedLen > p.protectedTarget() {
+			demoted := p.protected.front()
+			p.protected.remove(demoted)
+			p.protectedLen--
+			demoted.segment = segmentProbation
+			p.probation.append(demoted)
+			p.probationLen++
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) OnRemove(obj *CachedObject) {
+	switch obj.segment {
+	case segmentWindow:
+		p.window.remove(obj)
+		p.windowLen--
+	case segmentProbation:
+		p.probation.remove(obj)
+		p.probationLen--
+	case segmentProtected:
+		p.protected.remove(obj)
+		p.protectedLen--
+	}
+}
+
+func (p *tinyLFUPolicy) Victim() *CachedObject {
+	victim := p.probation.front()
+	candidate := p.probation.back()
+
+	if victim == nil {
+		if victim = p.protected.front(); victim == nil {
+			victim = p.window.front()
+		}
+		return victim
+	}
+	if candidate == victim {
+		return victim
+	}
+
+	// Admission: the candidate only survives if it is more popular than the victim
+	if p.sketch.estimate(candidate.Key) > p.sketch.estimate(victim.Key) {
+		return victim
+	}
+	return candidate
+}
+
+func (p *tinyLFUPolicy) Walk(fn func(obj *CachedObject) bool) {
+	if !walkList(&p.probation, fn) {
+		return
+	}
+	if !walkList(&p.window, fn) {
+		return
+	}
+	walkList(&p.protected, fn)
+}
+
+// windowTarget returns the maximum number of entries in the window
+func (p *tinyLFUPolicy) windowTarget() int {
+	total := p.windowLen + p.probationLen + p.protectedLen
+	return max(1, total*tinyLFUWindowPercent/100)
+}
+
+// protectedTarget returns the maximum number of entries in the protected segment
+func (p *tinyLFUPolicy) protectedTarget() int {
+	return (p.probationLen + p.protectedLen) * tinyLFUProtectedPercent / 100
+}
+
+// countMinSketch estimates access frequencies in constant space.
+// Counters are periodically halved so that the estimates favor recent popularity.
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacityHint int) *countMinSketch {
+	width := defaultSketchWidth
+	if capacityHint > width {
+		// Round up to a power of two so indexes can be masked
+		width = 1 << bits.Len(uint(capacityHint-1))
+	}
+
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		resetAt: width * sketchSampleFactor,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// increment records one occurrence of the key
+func (s *countMinSketch) increment(key string) {
+	h := xxh3.HashString(key)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+// estimate returns the (over-)estimated occurrence count of the key
+func (s *countMinSketch) estimate(key string) uint8 {
+	h := xxh3.HashString(key)
+	minCount := uint8(sketchMaxCount)
+	for i := range s.rows {
+		minCount = min(minCount, s.rows[i][s.index(h, i)])
+	}
+	return minCount
+}
+
+// reset halves every counter to age out stale popularity
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// index derives the counter index for row i from a single 64-bit hash
+func (s *countMinSketch) index(h uint64, i int) uint64 {
+	lo, hi := h&0xffffffff, h>>32
+	return (lo + uint64(i)*hi + uint64(i)) & s.mask
+}